@@ -0,0 +1,291 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/logging"
+)
+
+// NewBatch returns a batch that installs the nightlies of the given
+// installers one after the other, within a single file system transaction.
+// The transactions of the installers themselves are not used.
+func NewBatch(
+	t filesystem.Transactioner,
+	installers []*Installer,
+	log logging.Logger,
+) *Batch {
+	return &Batch{
+		transaction: t,
+		installers:  installers,
+		log:         log,
+		doneChan:    make(chan struct{}),
+		err:         &Errors{},
+	}
+}
+
+// Batch installs several nightlies in one file system transaction.
+// A nightly whose install fails before installing any RPM is skipped,
+// and the transaction is closed (i.e. published) if at least one nightly
+// was installed, else it is aborted. A nightly failing once it started
+// installing RPMs may leave a partial install, which cannot be told apart
+// from the other nightlies' installs: the remaining nightlies are then
+// skipped, and the transaction aborted.
+type Batch struct {
+	transaction filesystem.Transactioner
+	installers  []*Installer
+	log         logging.Logger
+	doneChan    chan struct{}
+	doneOnce    sync.Once
+
+	// err holds the errors not specific to any one nightly
+	err *Errors
+
+	// ready holds the nightlies complete in time, which
+	// are installed within the transaction
+	ready map[*Installer]bool
+}
+
+// Installers returns the installers of the batch nightlies, in install order
+func (b *Batch) Installers() []*Installer {
+	return b.installers
+}
+
+// Done returns a channel to wait for the batch to be done
+func (b *Batch) Done() <-chan struct{} {
+	return b.doneChan
+}
+
+// Err returns the errors that are not specific to any one nightly
+func (b *Batch) Err() *Errors {
+	return b.err
+}
+
+// IsError indicates if any errors have occured, in the batch or any nightly
+func (b *Batch) IsError() bool {
+	if len(*b.err) > 0 {
+		return true
+	}
+
+	for _, inst := range b.installers {
+		if inst.IsError() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NightlyID returns the identifiers of the batch nightlies
+func (b *Batch) NightlyID() string {
+	var ids []string
+	for _, inst := range b.installers {
+		ids = append(ids, inst.NightlyID())
+	}
+
+	return strings.Join(ids, ", ")
+}
+
+// Succeeded returns the installers whose nightly install succeeded
+func (b *Batch) Succeeded() []*Installer {
+	var ok []*Installer
+	for _, inst := range b.installers {
+		if !inst.failed() {
+			ok = append(ok, inst)
+		}
+	}
+
+	return ok
+}
+
+// Execute waits for each nightly to be complete, then installs
+// those that are in turn, within the one transaction
+func (b *Batch) Execute(ctx context.Context) {
+	for _, inst := range b.installers {
+		inst.begin()
+	}
+
+	transaction := history.TransactionOpenFailed
+
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Info("Recovered from panic", logging.F("err", r))
+			b.err.Append(PanicRecoverError{fmt.Sprintf("%v", r)})
+		}
+		b.setDone()
+	}()
+
+	// Wait for the nightlies before holding the transaction,
+	// skipping those still incomplete once the wait is over
+	b.ready = map[*Installer]bool{}
+	for _, inst := range b.installers {
+		if err := inst.waitNightly(ctx); err != nil {
+			b.log.Error("Nightly incomplete, skipping", logging.F("nightly", inst.NightlyID()), logging.ErrField(err))
+			inst.err.Append(err)
+			inst.aborted = ctx.Err() != nil
+			continue
+		}
+
+		b.ready[inst] = true
+	}
+
+	// The nightlies are only done once the transaction is
+	defer func() {
+		for _, inst := range b.installers {
+			if b.ready[inst] {
+				inst.finish(transaction)
+			} else {
+				inst.finish(history.TransactionNotOpened)
+			}
+			inst.setDone()
+		}
+	}()
+
+	if len(b.ready) == 0 {
+		return
+	}
+
+	// The transaction covers the directories written by the nightlies
+	var dirs, prefixes []string
+	for _, inst := range b.installers {
+		if b.ready[inst] {
+			dirs = append(dirs, inst.writtenDirs()...)
+			prefixes = append(prefixes, inst.nightlyPrefix())
+		}
+	}
+
+	filesystem.SnapshotDirs(b.transaction, prefixes...)
+
+	err := b.timePhase("transaction-open", func() error {
+		return openTransaction(ctx, b.transaction, b.log, dirs...)
+	})
+
+	if err != nil {
+		b.err.Append(NewTransactionOpenError(err))
+		for inst := range b.ready {
+			inst.aborted = true
+		}
+		return
+	}
+
+	// Ensure we close the transaction whatever happens
+	defer func() {
+		transaction = b.endTransaction(ctx)
+	}()
+
+	var midway *Installer
+	for i, inst := range b.installers {
+		if !b.ready[inst] {
+			continue
+		}
+
+		// Stop if the context is done, skipping the remaining nightlies
+		if ctx.Err() != nil {
+			inst.aborted = true
+			inst.err.Append(fmt.Errorf("nightly not installed (%w)", ctx.Err()))
+			continue
+		}
+
+		// The transaction is to be aborted, so skip the remaining nightlies
+		if midway != nil {
+			inst.err.Append(fmt.Errorf("nightly not installed, as %s failed mid-install", midway.NightlyID()))
+			continue
+		}
+
+		b.log.Info(
+			"Installing nightly",
+			logging.F("nightly", inst.NightlyID()),
+			logging.F("n", fmt.Sprintf("%d/%d", i+1, len(b.installers))),
+		)
+
+		inst.err.Append(inst.run(ctx))
+		inst.err.Append(inst.copyPkgManagerLog())
+		inst.err.Append(inst.writeTimeline())
+
+		if inst.failed() {
+			b.log.Error(
+				"Nightly install failed, skipping",
+				logging.F("nightly", inst.NightlyID()),
+				logging.F("nErrors", len(*inst.err)),
+			)
+		}
+
+		if inst.failedMidway() {
+			midway = inst
+		}
+	}
+}
+
+// endTransaction publishes the transaction if any nightly was installed
+// successfully, and none failed mid-install, else aborts it, returning
+// how it ended for the install history
+func (b *Batch) endTransaction(ctx context.Context) string {
+	nOK := len(b.Succeeded())
+	b.log.Info(
+		"Batch install done",
+		logging.F("nOK", nOK),
+		logging.F("nFailed", len(b.installers)-nOK),
+	)
+
+	for _, inst := range b.installers {
+		if !inst.failedMidway() {
+			continue
+		}
+
+		// The nightlies installed are not published either
+		for _, ok := range b.Succeeded() {
+			ok.err.Append(fmt.Errorf("nightly not published, as %s failed mid-install", inst.NightlyID()))
+		}
+
+		nOK = 0
+		break
+	}
+
+	if nOK == 0 || len(*b.err) > 0 {
+		err := b.timePhase("transaction-abort", func() error {
+			return b.transaction.Kill(ctx)
+		})
+
+		if err != nil {
+			b.err.Append(NewTransactionAbortError(err))
+			return history.TransactionAbortFailed
+		}
+		return history.TransactionAborted
+	}
+
+	err := b.timePhase("transaction-close", func() error {
+		return b.transaction.Close(ctx)
+	})
+
+	if err != nil {
+		b.err.Append(NewTransactionCloseError(err))
+		return history.TransactionCloseFailed
+	}
+
+	return history.TransactionClosed
+}
+
+// timePhase runs the batch phase, recording it in the timeline
+// of each nightly installed within the transaction
+func (b *Batch) timePhase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	end := time.Now()
+
+	for inst := range b.ready {
+		inst.recordPhase(name, start, end, err)
+	}
+
+	return err
+}
+
+func (b *Batch) setDone() {
+	b.doneOnce.Do(func() {
+		close(b.doneChan)
+	})
+}
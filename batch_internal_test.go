@@ -0,0 +1,269 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
+	"github.com/brinick/fs"
+	"github.com/brinick/logging"
+)
+
+// fakeTransaction counts the transaction calls
+type fakeTransaction struct {
+	opened, closed, killed int
+}
+
+func (t *fakeTransaction) Open(context.Context) error  { t.opened++; return nil }
+func (t *fakeTransaction) Close(context.Context) error { t.closed++; return nil }
+func (t *fakeTransaction) Kill(context.Context) error  { t.killed++; return nil }
+func (t *fakeTransaction) Start(context.Context) error { return nil }
+func (t *fakeTransaction) Stop(context.Context) error  { return nil }
+func (t *fakeTransaction) Attempts() int               { return 1 }
+
+// fakeTags accepts all tags file edits
+type fakeTags struct {
+	appended int
+}
+
+func (f *fakeTags) Src() *fs.File          { return fs.NewFile("/tags") }
+func (f *fakeTags) Remove(...string) error { return nil }
+func (f *fakeTags) Save() error            { return nil }
+
+func (f *fakeTags) Append(e *tagsfile.Entries) error {
+	f.appended += e.Size()
+	return nil
+}
+
+// makeBatchInstaller creates an installer for the nightly of the given
+// branch whose package manager install creates the nightly project
+// directory, or fails with the given error
+func makeBatchInstaller(t *testing.T, basedir, branch string, installErr error) (*Installer, *fakeTags) {
+	tags := &fakeTags{}
+	inst := makePlanInstaller(&fakePkgManager{})
+	inst.opts.Branch = branch
+	inst.opts.InstallBaseDir = basedir
+	inst.tags = tags
+	inst.pkg = &fakeInstallPkgManager{
+		fakePkgManager: &fakePkgManager{},
+		installErr:     installErr,
+		projectDir:     filepath.Join(inst.NightlyInstallDir(), inst.opts.Project, "22.0.1"),
+	}
+
+	return inst, tags
+}
+
+type fakeInstallPkgManager struct {
+	*fakePkgManager
+	installErr error
+	projectDir string
+}
+
+func (f *fakeInstallPkgManager) Install(ctx context.Context, rpms ...string) error {
+	if f.installErr != nil {
+		return f.installErr
+	}
+
+	return os.MkdirAll(f.projectDir, 0755)
+}
+
+func TestBatchSkipsFailedNightly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ok1, tags1 := makeBatchInstaller(t, dir, "master", nil)
+	bad, tags2 := makeBatchInstaller(t, dir, "21.0", nil)
+	ok2, tags3 := makeBatchInstaller(t, dir, "22.0", nil)
+
+	// The nightly fails before installing anything
+	bad.rpms.(*fakeFinder).err = errors.New("no top RPM found")
+
+	tx := &fakeTransaction{}
+	batch := NewBatch(tx, []*Installer{ok1, bad, ok2}, logging.NullLogger{})
+	batch.Execute(context.Background())
+	<-batch.Done()
+
+	if tx.opened != 1 || tx.closed != 1 || tx.killed != 0 {
+		t.Errorf(
+			"expected the transaction to be opened and closed once, got opened=%d closed=%d killed=%d",
+			tx.opened, tx.closed, tx.killed,
+		)
+	}
+
+	if n := len(batch.Succeeded()); n != 2 {
+		t.Errorf("expected 2 nightlies to succeed, got %d", n)
+	}
+
+	if !bad.failed() {
+		t.Errorf("expected the 21.0 nightly to fail")
+	}
+
+	if tags1.appended != 1 || tags2.appended != 0 || tags3.appended != 1 {
+		t.Errorf(
+			"expected tags entries for the successful nightlies only, got %d, %d, %d",
+			tags1.appended, tags2.appended, tags3.appended,
+		)
+	}
+
+	if r := bad.Record(); r.Outcome != history.OutcomeFailed || len(r.Errors) == 0 {
+		t.Errorf("expected the 21.0 nightly to be recorded as failed, got %s", r.Outcome)
+	}
+
+	if r := ok1.Record(); r.Outcome != history.OutcomeOK || r.Transaction != history.TransactionClosed {
+		t.Errorf("expected the master nightly to be recorded as ok, got %s (%s)", r.Outcome, r.Transaction)
+	}
+
+	for _, inst := range batch.Installers() {
+		select {
+		case <-inst.Done():
+		default:
+			t.Errorf("%s: installer should be done", inst.NightlyID())
+		}
+	}
+}
+
+func TestBatchAbortsIfAllFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bad1, _ := makeBatchInstaller(t, dir, "master", errors.New("install failed"))
+	bad2, _ := makeBatchInstaller(t, dir, "22.0", errors.New("install failed"))
+
+	tx := &fakeTransaction{}
+	batch := NewBatch(tx, []*Installer{bad1, bad2}, logging.NullLogger{})
+	batch.Execute(context.Background())
+
+	if tx.closed != 0 || tx.killed != 1 {
+		t.Errorf("expected the transaction to be aborted, got closed=%d killed=%d", tx.closed, tx.killed)
+	}
+
+	if !batch.IsError() {
+		t.Errorf("expected the batch to report errors")
+	}
+}
+
+func TestBatchAbortsOnFailureMidway(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ok, _ := makeBatchInstaller(t, dir, "master", nil)
+	bad, _ := makeBatchInstaller(t, dir, "21.0", errors.New("install failed"))
+	skipped, tags := makeBatchInstaller(t, dir, "22.0", nil)
+
+	tx := &fakeTransaction{}
+	batch := NewBatch(tx, []*Installer{ok, bad, skipped}, logging.NullLogger{})
+	batch.Execute(context.Background())
+
+	if tx.closed != 0 || tx.killed != 1 {
+		t.Errorf("expected the transaction to be aborted, got closed=%d killed=%d", tx.closed, tx.killed)
+	}
+
+	if tags.appended != 0 {
+		t.Errorf("expected the nightly after the failure to be skipped")
+	}
+
+	if n := len(batch.Succeeded()); n != 0 {
+		t.Errorf("expected no nightly to be published, got %d", n)
+	}
+
+	if r := ok.Record(); r.Transaction != history.TransactionAborted {
+		t.Errorf("expected the master nightly transaction to be aborted, got %s", r.Transaction)
+	}
+}
+
+// scopedTransaction records the directories to which it is scoped
+type scopedTransaction struct {
+	fakeTransaction
+	dir string
+}
+
+func (t *scopedTransaction) Scope(dirs ...string) { t.dir = filesystem.CommonDir(dirs...) }
+
+func TestBatchScopesToWrittenDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	master, _ := makeBatchInstaller(t, dir, "master", nil)
+	master.opts.PkgInstallDir = filepath.Join(dir, "master")
+	rel, _ := makeBatchInstaller(t, dir, "22.0", nil)
+	rel.opts.PkgInstallDir = filepath.Join(dir, "22.0")
+
+	// The RPMs are relocated below the install base directory
+	tx := &scopedTransaction{}
+	batch := NewBatch(tx, []*Installer{master, rel}, logging.NullLogger{})
+	batch.Execute(context.Background())
+
+	if tx.dir != dir {
+		t.Errorf("expected the transaction to be scoped to %s, got %s", dir, tx.dir)
+	}
+}
+
+// incompleteFinder is a finder whose nightly is never complete
+type incompleteFinder struct {
+	*fakeFinder
+}
+
+func (f *incompleteFinder) Wait(context.Context, string, string) (time.Duration, error) {
+	return time.Hour, errors.New("timed out")
+}
+
+func TestIncompleteNightlyNotInTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ok, _ := makeBatchInstaller(t, dir, "master", nil)
+	incomplete, tags := makeBatchInstaller(t, dir, "22.0", nil)
+	incomplete.rpms = &incompleteFinder{incomplete.rpms.(*fakeFinder)}
+
+	tx := &fakeTransaction{}
+	batch := NewBatch(tx, []*Installer{ok, incomplete}, logging.NullLogger{})
+	batch.Execute(context.Background())
+
+	if tx.opened != 1 || tx.closed != 1 {
+		t.Errorf("expected the transaction to be opened and closed once, got opened=%d closed=%d", tx.opened, tx.closed)
+	}
+
+	if tags.appended != 0 || lastPhase(incomplete, "transaction-open") != nil {
+		t.Errorf("expected the incomplete nightly to be skipped before the transaction")
+	}
+
+	if r := incomplete.Record(); r.Outcome != history.OutcomeFailed || r.Transaction != history.TransactionNotOpened {
+		t.Errorf("expected the incomplete nightly to fail without a transaction, got %s (%s)", r.Outcome, r.Transaction)
+	}
+
+	// Alone, the nightly has the transaction never opened
+	single, _ := makeBatchInstaller(t, dir, "21.0", nil)
+	single.rpms = &incompleteFinder{single.rpms.(*fakeFinder)}
+	single.transaction = &fakeTransaction{}
+	single.Execute(context.Background())
+
+	if n := single.transaction.(*fakeTransaction).opened; n != 0 {
+		t.Errorf("expected the transaction not to be opened, got opened=%d", n)
+	}
+
+	if r := single.Record(); r.Transaction != history.TransactionNotOpened {
+		t.Errorf("expected the transaction not to be opened, got %s", r.Transaction)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/atlas-rpm-installer/pkg/notify"
+)
+
+// firstDigestPeriod is the period covered by the
+// first digest, when there was no previous digest
+const firstDigestPeriod = 24 * time.Hour
+
+// sendDigest runs the digest command, notifying about all installs
+// since the last digest, and returns the exit code. It is meant to
+// be run daily, e.g. from cron.
+func sendDigest() int {
+	until := time.Now()
+	since, err := lastDigest()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitCode.PreInstallError
+	}
+
+	if since.IsZero() {
+		since = until.Add(-firstDigestPeriod)
+	}
+
+	db, err := history.Open(cfg.History.DB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitCode.PreInstallError
+	}
+
+	entries, err := db.Query(&history.Filter{Since: since, Until: until}, 0)
+	db.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error querying the install history: %v\n", err)
+		return ExitCode.PreInstallError
+	}
+
+	digest := &notify.Digest{Since: since, Until: until, Installs: entries}
+	if err := send(notify.KindDigest, digest); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending the digest: %v\n", err)
+		return ExitCode.InstallerError
+	}
+
+	if err := saveLastDigest(until); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitCode.InstallerError
+	}
+
+	return ExitCode.OK
+}
+
+// lastDigest returns the time of the last digest, or the zero time if none
+func lastDigest() (time.Time, error) {
+	data, err := ioutil.ReadFile(cfg.Admin.DigestStateFile)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read the last digest time (%w)", err)
+	}
+
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad last digest time in %s (%w)", cfg.Admin.DigestStateFile, err)
+	}
+
+	return last, nil
+}
+
+// saveLastDigest records the time up to which the digest was sent
+func saveLastDigest(t time.Time) error {
+	path := cfg.Admin.DigestStateFile
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create the digest state directory (%w)", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(t.Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return fmt.Errorf("unable to record the last digest time (%w)", err)
+	}
+
+	return nil
+}
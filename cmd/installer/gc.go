@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
+	"github.com/brinick/logging"
+)
+
+// collectGarbage runs the gc command, removing the old nightlies,
+// or only listing them in dry run mode, and returns the exit code
+func collectGarbage(
+	signalChan chan os.Signal,
+	t filesystem.Transactioner,
+	tmpDir string,
+	log logging.Logger,
+) int {
+	collector := installer.NewCollector(
+		cfg.GC.Opts(cfg.Dirs.InstallBase),
+		t,
+		tagsfile.New(cfg.Install.TagsFile, tmpDir),
+		log,
+	)
+
+	if cfg.DryRun.Enabled {
+		expired, err := collector.Expired()
+		if err != nil {
+			log.Error("Unable to list the nightlies to garbage collect", logging.ErrField(err))
+			return ExitCode.InstallerError
+		}
+
+		for _, n := range expired {
+			fmt.Println(n.Dir)
+		}
+
+		return ExitCode.OK
+	}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	if cfg.Global.TimeOut > 0 {
+		var timeoutFn context.CancelFunc
+		ctx, timeoutFn = context.WithTimeout(ctx, time.Duration(cfg.Global.TimeOut)*time.Second)
+		defer timeoutFn()
+	}
+
+	go func() {
+		if sig, ok := <-signalChan; ok {
+			log.Info("Signal trapped, stopping the garbage collection", logging.F("sig", sig))
+			cancelCtx()
+		}
+	}()
+
+	removed, err := collector.Execute(ctx)
+	if err != nil {
+		log.Error("Garbage collection FAIL", logging.ErrField(err))
+		return ExitCode.InstallerError
+	}
+
+	log.Info("Garbage collection OK", logging.F("nRemoved", len(removed)))
+	return ExitCode.OK
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/logging"
+)
+
+// printHistory runs the history command, printing the recorded
+// installs that pass the query filter, and returns the exit code
+func printHistory() int {
+	db, err := history.Open(cfg.History.DB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitCode.PreInstallError
+	}
+	defer db.Close()
+
+	entries, err := db.Query(cfg.History.Filter(), cfg.History.Limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error querying the install history: %v\n", err)
+		return ExitCode.PreInstallError
+	}
+
+	if cfg.History.Format == "json" {
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error printing the install history: %v\n", err)
+			return ExitCode.PreInstallError
+		}
+
+		fmt.Println(string(out))
+		return ExitCode.OK
+	}
+
+	for _, e := range entries {
+		fmt.Println(e)
+	}
+
+	return ExitCode.OK
+}
+
+// recordHistory adds the installs to the history database, if enabled.
+// The database is only held open while writing, as it is locked meanwhile.
+func recordHistory(installers []*installer.Installer, log logging.Logger) {
+	if cfg.History.Disabled {
+		return
+	}
+
+	db, err := history.Open(cfg.History.DB)
+	if err != nil {
+		log.Error("Unable to record the install history", logging.ErrField(err))
+		return
+	}
+	defer db.Close()
+
+	for _, inst := range installers {
+		if err := db.Add(inst.Record()); err != nil {
+			log.Error(
+				"Unable to record the install history",
+				logging.F("nightly", inst.NightlyID()),
+				logging.ErrField(err),
+			)
+		}
+	}
+}
@@ -1,7 +1,5 @@
 package main
 
-//TODO: .keep file in nightlies to indicate we don't delete after 30 days
-
 import (
 	"context"
 	_ "expvar" // register the /debug/vars endpoint for metrics
@@ -17,14 +15,15 @@ import (
 	installer "github.com/brinick/atlas-rpm-installer"
 	"github.com/brinick/atlas-rpm-installer/config"
 
-	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller"
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/afs"
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/cvmfs"
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/localfs"
-	"github.com/brinick/atlas-rpm-installer/pkg/notify"
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/overlay"
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller"
 	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
 	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
+	"github.com/brinick/logging"
 )
 
 var (
@@ -47,10 +46,17 @@ var (
 )
 
 func main() {
-	var (
-		log           logging.Logger
-		pkgManagerLog logging.Logger
-	)
+	// Query the install history, if requested
+	if cfg.Command == "history" {
+		os.Exit(printHistory())
+	}
+
+	// Notify about the installs since the last digest, if requested
+	if cfg.Command == "digest" {
+		os.Exit(sendDigest())
+	}
+
+	var log logging.Logger
 
 	// TODO: should this be a statsd timer?
 	// Time the execution of this main function i.e. of the whole install process
@@ -68,15 +74,23 @@ func main() {
 	signalChan := trap()
 	defer close(signalChan)
 
-	// Create the main and the package manager loggers
-	logname := makeLogName(cfg.Logging.OutFile, cfg.Install, startEpoch)
+	// The gc and watch commands have no nightlies to install up front
+	nightlies := cfg.Nightlies()
+	logOpts := cfg.Install
+	if len(nightlies) > 0 {
+		logOpts = nightlies[0].Install
+	}
+
+	// Create the main logger
+	logname := makeLogName(cfg.Logging.OutFile, logOpts, startEpoch)
 	log = createLogger(filepath.Join(cfg.Dirs.Logs, logname+".log"), cfg.Logging)
-	pkgManagerLog = createLogger(filepath.Join(cfg.Dirs.Logs, logname+"ayum.log"), cfg.Logging)
 
 	log.Debug(fmt.Sprintf("\n--- Configuration Dump ---\n\n%s\n", cfg.String()))
 
+	serveMetrics(log)
+	setState(stateIdle)
+
 	fsTransactioner := makeTransactioner(fsSelector(cfg.Dirs.InstallBase), log)
-	os.Exit(0)
 
 	// Make a temporary directory for storing the tagsfile editable copy
 	tmpDir, err := ioutil.TempDir("", "AMITags")
@@ -87,27 +101,27 @@ func main() {
 	// Clean up the temp tagsfile dir before we exit
 	defer os.RemoveAll(tmpDir)
 
-	// Instantiate the installer with all the required plumbing
-	inst := installer.New(
-		// installation options
-		&cfg.Install.Opts,
-
-		// file system transaction handler
-		fsTransactioner,
-
-		// ayum handler
-		pkginstaller.select()
-		ayum.New(&cfg.Ayum.Opts, ayumlog),
+	// Remove old nightlies, if requested
+	if cfg.Command == "gc" {
+		os.Exit(collectGarbage(signalChan, fsTransactioner, tmpDir, log))
+	}
 
-		// rpm/dependency finder
-		rpm.NewFinder(cfg.Dirs.RPMSrcBase),
+	// Watch for, and install, new nightlies until stopped, if requested
+	if cfg.Command == "watch" {
+		os.Exit(watchNightlies(signalChan, fsTransactioner, tmpDir, log))
+	}
 
-		// tagsfile updater
-		tagsfile.New(cfg.Install.TagsFile, tmpDir),
+	// Instantiate an installer, with all the required plumbing, per nightly
+	var installers []*installer.Installer
+	for _, nightly := range nightlies {
+		inst, err := makeInstaller(nightly, len(nightlies) > 1, fsTransactioner, tmpDir, log)
+		if err != nil {
+			log.Error("failed to create the installer", logging.ErrField(err))
+			os.Exit(ExitCode.PreInstallError)
+		}
 
-		// Use the same log handler everywhere
-		log,
-	)
+		installers = append(installers, inst)
+	}
 
 	// Prepare a context to allow for cancelling the installation
 	ctx := context.Background()
@@ -122,8 +136,21 @@ func main() {
 		defer timeoutFn()
 	}
 
+	// Only print what the install would do, if requested,
+	// without sending any metrics
+	if cfg.DryRun.Enabled {
+		os.Exit(printPlans(ctx, installers, log))
+	}
+
+	// Send the package manager metrics, if monitoring
+	statsd.start(log)
+
+	// The nightlies are installed within a single file system transaction
+	batch := installer.NewBatch(fsTransactioner, installers, log)
+
 	// Launch the install in the background
-	// go inst.Execute(ctx)
+	setState(stateInstalling)
+	go batch.Execute(ctx)
 
 	// And now, we wait...
 	select {
@@ -131,105 +158,218 @@ func main() {
 		log.Info("Signal trapped", logging.F("sig", sig))
 		log.Info("Install ABORT")
 		cancelCtx()
-		<-inst.Done()
-
-		// Do not _not_ send email...er...ok, so send email
-		if !cfg.Admin.DontSendEmail {
-			log.Info("Email requested on failure, sending...")
-			email := notify.NewEmail(cfg.Admin.EmailFrom, cfg.Admin.EmailTo)
-			res := email.WithTimeout(30).Send(
-				fmt.Sprintf("ABORTED: nightly install %s", inst.NightlyID()),
-				fmt.Sprintf(
-					"The install process with PID %d was terminated "+
-						"(signal %s was trapped)\n"+
-						"The nightly:\n"+
-						"\t%s\n"+
-						"was thus not installed.\n\n"+
-						"Full output available in the log file:\n"+
-						"%s\n",
-					os.Getpid(),
-					sig,
-					inst.NightlyID(),
-					log.Path(),
-				),
-			)
+		<-batch.Done()
+		statsd.stop()
+		recordHistory(installers, log)
+		setState(stateIdle)
+		observeInstalls(installers, log)
 
-			if res.IsError() {
-				log.Error(
-					"Failed to send email about nightly install being aborted",
-					logging.ErrField(res.Err()),
-				)
-			}
-		}
+		notifyAbort(batch.NightlyID(), sig, log)
 
 		os.Exit(ExitCode.SignalEvent)
 
-	case <-inst.Done():
+	case <-batch.Done():
 		log.Info("Installation done, checking outcome")
 	case <-ctx.Done():
 		log.Info("Context is done, installation was stopped")
-		<-inst.Done()
+		<-batch.Done()
 	}
 
+	statsd.stop()
+	recordHistory(installers, log)
+	setState(stateIdle)
+	observeInstalls(installers, log)
+
 	// All ok, no errors, exit normally
-	if !inst.IsError() {
+	if !batch.IsError() {
 		log.Info("Install OK")
+		for _, inst := range installers {
+			notifyInstall(inst, log)
+		}
+
 		os.Exit(ExitCode.OK)
 	}
 
 	// TODO: push errors to metrics counts
 
 	// Something went wrong, log errors and send notification, if configured
-	log.Error("Install FAIL")
+	log.Error(
+		"Install FAIL",
+		logging.F("nOK", len(batch.Succeeded())),
+		logging.F("nNightlies", len(installers)),
+	)
 
-	for _, err := range *inst.Err() {
+	for _, err := range *batch.Err() {
 		log.Error(fmt.Sprintf("%v", err))
 	}
 
-	// Send an email, if requested
-	if !cfg.Admin.DontSendEmail {
-		log.Info("Email requested on failure, sending...")
-		errs := *inst.Err()
-		res := notify.NewEmail(cfg.Admin.EmailFrom, cfg.Admin.EmailTo).Send(
-			fmt.Sprintf("FAILED: nightly install %s", inst.NightlyID()),
-			fmt.Sprintf(
-				"The installation for nightly:\n"+
-					"\t%s\n"+
-					"failed. %d error(s) reported:\n\n"+
-					"%s",
-				inst.NightlyID(),
-				len(errs),
-				errs.String(),
-			),
-		)
-
-		if res.IsError() {
+	if len(*batch.Err()) > 0 {
+		notifyFailure(batch.NightlyID(), batch.Err(), log)
+	}
+
+	for _, inst := range installers {
+		for _, err := range *inst.Err() {
+			log.Error(fmt.Sprintf("%s: %v", inst.NightlyID(), err))
+		}
+
+		notifyInstall(inst, log)
+	}
+
+	os.Exit(ExitCode.InstallerError)
+}
+
+// makeInstaller instantiates the installer of the nightly, with its own
+// package manager log, whose name includes the nightly if distinct is set
+func makeInstaller(
+	nightly *config.Nightly,
+	distinct bool,
+	t filesystem.Transactioner,
+	tmpDir string,
+	log logging.Logger,
+) (*installer.Installer, error) {
+	pkgManagerLogName := makeLogName(cfg.Logging.OutFile, nightly.Install, startEpoch)
+	if distinct {
+		pkgManagerLogName += "." + nightlyLogID(nightly.Install)
+	}
+
+	pkgManagerLog := createLogger(
+		filepath.Join(
+			cfg.Dirs.Logs,
+			fmt.Sprintf("%s.%s.log", pkgManagerLogName, cfg.Install.PkgManager),
+		),
+		cfg.Logging,
+	)
+
+	pkgManager, err := makePkgManager(nightly, pkgManagerLog)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the package manager (%w)", err)
+	}
+
+	finder, err := makeFinder(nightly.RPMSrcDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the RPM finder (%w)", err)
+	}
+
+	nightly.Install.PkgInstallDir = nightly.PkgInstallDir(cfg.Install.PkgManager)
+	return installer.New(
+		// installation options
+		&nightly.Install.Opts,
+
+		// file system transaction handler
+		t,
+
+		// package manager handler
+		pkgManager,
+
+		// rpm/dependency finder
+		finder,
+
+		// tagsfile updater
+		tagsfile.New(cfg.Install.TagsFile, tmpDir),
+
+		// Use the same log handler everywhere
+		log,
+	), nil
+}
+
+// nightlyLogID identifies the nightly in log file names
+func nightlyLogID(opts *config.InstallOpts) string {
+	return strings.Join([]string{opts.Branch, opts.Project, opts.Platform, opts.Timestamp}, "_")
+}
+
+// printPlans prints the install plan of each nightly to stdout,
+// in the configured format, returning the exit code
+func printPlans(ctx context.Context, installers []*installer.Installer, log logging.Logger) int {
+	for _, inst := range installers {
+		plan, err := inst.Plan(ctx)
+		if err != nil {
 			log.Error(
-				"Failed to send email about nightly install failure",
-				logging.ErrField(res.Err()),
+				"Unable to plan the install",
+				logging.F("nightly", inst.NightlyID()),
+				logging.ErrField(err),
 			)
+			return ExitCode.InstallerError
+		}
+
+		out := plan.String()
+		if cfg.DryRun.Format == "json" {
+			if out, err = plan.JSON(); err != nil {
+				log.Error("Unable to print the install plan", logging.ErrField(err))
+				return ExitCode.InstallerError
+			}
 		}
+
+		fmt.Print(out)
 	}
 
-	os.Exit(ExitCode.InstallerError)
+	return ExitCode.OK
 }
 
 // makeTransactioner instantiates the appropriate file system transactioner
 func makeTransactioner(is func(string) bool, log logging.Logger) filesystem.Transactioner {
 	var t filesystem.Transactioner
+	onAttempt := observeTransactionAttempt(log)
 
 	switch {
 	case is("/cvmfs"):
-		t = cvmfs.NewTransaction(&cfg.CVMFS.Opts, log)
+		cfg.CVMFS.OnAttempt = onAttempt
+		if cfg.CVMFS.Backend == cvmfs.BackendGateway {
+			t = cvmfs.NewGatewayTransaction(&cfg.CVMFS.Opts, log)
+		} else {
+			t = cvmfs.NewTransaction(&cfg.CVMFS.Opts, log)
+		}
 	case is("/afs"):
+		cfg.AFS.OnAttempt = onAttempt
 		t = afs.NewTransaction(&cfg.AFS.Opts, log)
+	case cfg.Overlay.Selects(is):
+		cfg.Overlay.OnAttempt = onAttempt
+		t = overlay.NewTransaction(&cfg.Overlay.Opts, log)
 	default:
+		cfg.LocalFS.OnAttempt = onAttempt
 		t = localfs.NewTransaction(&cfg.LocalFS.Opts, log)
 	}
 
 	return t
 }
 
+// makePkgManager instantiates, for the nightly, the package
+// manager chosen in the configuration
+func makePkgManager(nightly *config.Nightly, log logging.Logger) (pkginstaller.PkgInstaller, error) {
+	return pkginstaller.New(
+		cfg.Install.PkgManager,
+		&pkginstaller.Opts{
+			Ayum: nightly.Ayum,
+			Dnf:  nightly.Dnf,
+		},
+		log,
+	)
+}
+
+// makeFinder instantiates the RPM finder for the nightly RPM directory
+func makeFinder(srcDir string) (*rpm.Finder, error) {
+	finder := rpm.NewFinder(srcDir)
+
+	// A dry run leaves the RPM directory untouched
+	if cfg.EOS.GenerateRepodata && !cfg.DryRun.Enabled {
+		finder = finder.WithRepodataGeneration()
+	}
+
+	checker, err := cfg.EOS.Checker()
+	if err != nil {
+		return nil, err
+	}
+
+	if checker != nil {
+		finder = finder.WithChecks(checker)
+	}
+
+	if cfg.EOS.Wait {
+		finder = finder.WithWait(&cfg.EOS.WaitOpts)
+	}
+
+	return finder, nil
+}
+
 func fsSelector(installdir string) func(string) bool {
 	return func(name string) bool {
 		return strings.HasPrefix(installdir, name)
@@ -243,6 +383,17 @@ func getConfig() *config.Config {
 		os.Exit(ExitCode.ParserError)
 	}
 
+	if cfg.File.Dump {
+		out, err := cfg.Dump()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error dumping configuration: %v\n", err)
+			os.Exit(ExitCode.ParserError)
+		}
+
+		fmt.Print(out)
+		os.Exit(ExitCode.OK)
+	}
+
 	return cfg
 }
 
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/metric"
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/ayum"
+	"github.com/brinick/logging"
+)
+
+// statsd sends the ayum metrics, if monitoring
+var statsd = &metricsSender{}
+
+// metricsSender drains the ayum metrics queue to StatsD in the background
+type metricsSender struct {
+	once   sync.Once
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start starts sending the metrics, if monitoring. As the ayum metrics
+// queue only exists once an ayum instance is created, it is a no-op
+// until then, and once started.
+func (m *metricsSender) start(log logging.Logger) {
+	if !cfg.Admin.Monitor {
+		return
+	}
+
+	queue := ayum.Metrics()
+	if queue == nil {
+		return
+	}
+
+	m.once.Do(func() {
+		sender, err := metric.NewSender(cfg.Admin.StatsDAddr)
+		if err != nil {
+			log.Error("Unable to send metrics", logging.ErrField(err))
+			return
+		}
+
+		var ctx context.Context
+		ctx, m.cancel = context.WithCancel(context.Background())
+		m.done = make(chan struct{})
+
+		go func() {
+			defer close(m.done)
+			defer sender.Close()
+			sender.Drain(ctx, queue.Items())
+
+			if n := sender.Failed(); n > 0 {
+				log.Error("Failed to send some metrics", logging.F("nFailed", n))
+			}
+		}()
+	})
+}
+
+// stop sends the metrics still queued, and stops the sender
+func (m *metricsSender) stop() {
+	if m.cancel == nil {
+		return
+	}
+
+	m.cancel()
+	<-m.done
+}
+
+// ---------------------------------------------------------------------
+
+// Installer states, exposed as a metric
+const (
+	stateIdle       = "idle"
+	stateInstalling = "installing"
+)
+
+// setState sets the current state of the installer
+func setState(state string) {
+	for _, s := range []string{stateIdle, stateInstalling} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+
+		metric.Default.Set(
+			"atlas_rpm_installer_state",
+			"Current state of the installer.",
+			value,
+			metric.Labels{"state": s},
+		)
+	}
+}
+
+// serveMetrics serves, in the background, the Prometheus metrics
+// at /metrics, along with the expvar /debug/vars, if requested
+func serveMetrics(log logging.Logger) {
+	if cfg.Admin.MetricsAddr == "" {
+		return
+	}
+
+	http.Handle("/metrics", metric.Default)
+	go func() {
+		if err := http.ListenAndServe(cfg.Admin.MetricsAddr, nil); err != nil {
+			log.Error(
+				"Unable to serve metrics",
+				logging.F("addr", cfg.Admin.MetricsAddr),
+				logging.ErrField(err),
+			)
+		}
+	}()
+}
+
+// observeInstalls records the metrics of the installs, from their history
+// entries, then writes the metrics textfile, if requested
+func observeInstalls(installers []*installer.Installer, log logging.Logger) {
+	for _, inst := range installers {
+		r := inst.Record()
+		labels := metric.Labels{"nightly": r.NightlyID}
+
+		// An install may have several install phases
+		phases := map[string]float64{}
+		for _, p := range r.Phases {
+			phases[p.Name] += p.Duration.Seconds()
+		}
+
+		for name, secs := range phases {
+			metric.Default.Set(
+				"atlas_rpm_installer_phase_duration_seconds",
+				"Duration of each phase of the last install of the nightly.",
+				secs,
+				metric.Labels{"nightly": r.NightlyID, "phase": name},
+			)
+		}
+
+		if secs, ok := phases["wait-nightly"]; ok {
+			metric.Default.Set(
+				"atlas_rpm_installer_nightly_wait_seconds",
+				"Time spent waiting for the nightly RPMs to be copied, before the last install.",
+				secs,
+				labels,
+			)
+		}
+
+		metric.Default.Set(
+			"atlas_rpm_installer_install_duration_seconds",
+			"Duration of the last install of the nightly.",
+			r.Duration().Seconds(),
+			labels,
+		)
+
+		metric.Default.Set(
+			"atlas_rpm_installer_install_errors",
+			"Number of errors in the last install of the nightly.",
+			float64(len(r.Errors)),
+			labels,
+		)
+
+		metric.Default.Set(
+			"atlas_rpm_installer_last_install_timestamp_seconds",
+			"End time of the last install of the nightly.",
+			float64(r.End.Unix()),
+			labels,
+		)
+
+		metric.Default.Add(
+			"atlas_rpm_installer_installs_total",
+			"Number of nightly installs, by outcome.",
+			1,
+			metric.Labels{"outcome": r.Outcome},
+		)
+	}
+
+	if cfg.Admin.MetricsTextFile == "" {
+		return
+	}
+
+	if err := metric.Default.WriteTextFile(cfg.Admin.MetricsTextFile); err != nil {
+		log.Error("Unable to write the metrics textfile", logging.ErrField(err))
+	}
+}
+
+// observeTransactionAttempt returns the callback logging, and metering,
+// each attempt to open the file system transaction, to follow contention
+func observeTransactionAttempt(log logging.Logger) func(filesystem.Attempt) {
+	return func(a filesystem.Attempt) {
+		outcome := "ok"
+		if a.Err != nil {
+			outcome = "failed"
+			log.Error(
+				"Failed to open the transaction",
+				logging.F("attempt", a.Number),
+				logging.F("retry", a.Retry),
+				logging.F("retryIn", a.Delay.String()),
+				logging.ErrField(a.Err),
+			)
+		} else if a.Number > 1 {
+			log.Info(
+				"Opened the transaction",
+				logging.F("attempt", a.Number),
+				logging.F("elapsed", a.Elapsed.Round(time.Second).String()),
+			)
+		}
+
+		metric.Default.Add(
+			"atlas_rpm_installer_transaction_open_attempts_total",
+			"Number of attempts to open the file system transaction, by outcome.",
+			1,
+			metric.Labels{"outcome": outcome},
+		)
+
+		if !a.Retry {
+			metric.Default.Set(
+				"atlas_rpm_installer_transaction_open_wait_seconds",
+				"Time spent opening the last file system transaction, retries included.",
+				a.Elapsed.Seconds(),
+				nil,
+			)
+		}
+	}
+}
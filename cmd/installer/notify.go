@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/atlas-rpm-installer/pkg/notify"
+	"github.com/brinick/logging"
+)
+
+// notifyTimeout bounds the time taken sending notifications
+const notifyTimeout = 30 * time.Second
+
+// notifyInstall notifies about the failed, or successful, nightly install
+func notifyInstall(inst *installer.Installer, log logging.Logger) {
+	r := inst.Record()
+	kind := notify.KindSuccess
+	if inst.IsError() {
+		kind = notify.KindFailure
+	} else if !cfg.Admin.NotifySuccess {
+		return
+	}
+
+	sendNotification(
+		kind,
+		&notify.Install{
+			NightlyID:     inst.NightlyID(),
+			Opts:          inst.Opts(),
+			Outcome:       r.Outcome,
+			Errors:        r.Errors,
+			Timeline:      inst.Timeline(),
+			Log:           log.Path(),
+			PkgManagerLog: inst.PkgManagerLog(),
+			InstallDir:    inst.NightlyInstallDir(),
+		},
+		log,
+	)
+}
+
+// notifyFailure notifies about errors of the batch as a whole
+func notifyFailure(nightlyID string, errs *installer.Errors, log logging.Logger) {
+	var msgs []string
+	for _, err := range *errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	sendNotification(
+		notify.KindFailure,
+		&notify.Install{
+			NightlyID: nightlyID,
+			Outcome:   history.OutcomeFailed,
+			Errors:    msgs,
+			Log:       log.Path(),
+		},
+		log,
+	)
+}
+
+// notifyAbort notifies that the install was aborted by the signal
+func notifyAbort(nightlyID string, sig os.Signal, log logging.Logger) {
+	sendNotification(
+		notify.KindAbort,
+		&notify.Install{
+			NightlyID: nightlyID,
+			Outcome:   history.OutcomeAborted,
+			Log:       log.Path(),
+			PID:       os.Getpid(),
+			Signal:    sig.String(),
+		},
+		log,
+	)
+}
+
+// sendNotification renders the kind of notification and sends it with the
+// configured notifiers, unless notifications are switched off, or only
+// sent as a digest
+func sendNotification(kind string, data interface{}, log logging.Logger) {
+	if cfg.Admin.DontSendEmail || cfg.Admin.Digest {
+		return
+	}
+
+	log.Info(
+		"Notification requested, sending...",
+		logging.F("kind", kind),
+		logging.F("notifiers", cfg.Admin.Notify),
+	)
+
+	if err := send(kind, data); err != nil {
+		log.Error("Failed to send notification", logging.F("kind", kind), logging.ErrField(err))
+	}
+}
+
+// send renders the kind of notification and sends it
+func send(kind string, data interface{}) error {
+	templates, err := notify.NewTemplates(cfg.Admin.Templates)
+	if err != nil {
+		return err
+	}
+
+	subject, body, err := templates.Render(kind, data)
+	if err != nil {
+		return err
+	}
+
+	notifier, err := cfg.Admin.Notifier()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	return notifier.Send(ctx, subject, body)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/watch"
+	"github.com/brinick/logging"
+)
+
+// maxNightlyAge is the age beyond which nightlies are no longer installed
+const maxNightlyAge = 30 * 24 * time.Hour
+
+// watchNightlies polls the nightly base directory, installing each new
+// nightly of the project in its own transaction, until a signal is trapped.
+// It returns the exit code.
+func watchNightlies(
+	signalChan chan os.Signal,
+	t filesystem.Transactioner,
+	tmpDir string,
+	log logging.Logger,
+) int {
+	state, err := watch.LoadState(cfg.Watch.StateFile)
+	if err != nil {
+		log.Error("Unable to load the watch state", logging.ErrField(err))
+		return ExitCode.PreInstallError
+	}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	go func() {
+		if sig, ok := <-signalChan; ok {
+			log.Info("Signal trapped, stopping the watch", logging.F("sig", sig))
+			cancelCtx()
+		}
+	}()
+
+	w := watch.New(
+		watch.NewScanner(cfg.EOS.NightlyBaseDir, cfg.Install.Project, maxNightlyAge, log),
+		state,
+		time.Duration(cfg.Watch.Interval)*time.Second,
+		installNightly(t, tmpDir, log),
+		log,
+	)
+
+	log.Info(
+		"Watching for new nightlies",
+		logging.F("dir", cfg.EOS.NightlyBaseDir),
+		logging.F("project", cfg.Install.Project),
+		logging.F("stateFile", cfg.Watch.StateFile),
+	)
+
+	w.Run(ctx)
+	statsd.stop()
+	log.Info("Watch stopped")
+	return ExitCode.SignalEvent
+}
+
+// installNightly returns the function with which the watcher installs
+// a nightly. Any global timeout applies to each nightly install.
+func installNightly(t filesystem.Transactioner, tmpDir string, log logging.Logger) watch.InstallFunc {
+	return func(ctx context.Context, n *watch.Nightly) error {
+		nightly, err := cfg.Nightly(n.Release(), n.Project)
+		if err != nil {
+			return err
+		}
+
+		inst, err := makeInstaller(nightly, true, t, tmpDir, log)
+		if err != nil {
+			return err
+		}
+
+		// Metrics are sent until the watch stops
+		statsd.start(log)
+
+		if cfg.Global.TimeOut > 0 {
+			var timeoutFn context.CancelFunc
+			ctx, timeoutFn = context.WithTimeout(ctx, time.Duration(cfg.Global.TimeOut)*time.Second)
+			defer timeoutFn()
+		}
+
+		setState(stateInstalling)
+		go inst.Execute(ctx)
+		<-inst.Done()
+		setState(stateIdle)
+
+		installers := []*installer.Installer{inst}
+		recordHistory(installers, log)
+		observeInstalls(installers, log)
+
+		notifyInstall(inst, log)
+		if !inst.IsError() {
+			log.Info("Install OK", logging.F("nightly", inst.NightlyID()))
+			return nil
+		}
+
+		for _, err := range *inst.Err() {
+			log.Error(fmt.Sprintf("%s: %v", inst.NightlyID(), err))
+		}
+
+		return fmt.Errorf("install failed with %d error(s)", len(*inst.Err()))
+	}
+}
@@ -3,15 +3,59 @@ package config
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/notify"
 )
 
+// Notifiers are the ways in which notifications may be sent
+var Notifiers = []string{"mailx", "smtp", "chat", "webhook"}
+
 // AdminOpts are options for certain meta variables
 type AdminOpts struct {
 	EmailTo       string
 	EmailFrom     string
 	DontSendEmail bool
 	Monitor       bool
+
+	// Notify is the comma-separated list of notifiers to use
+	Notify string
+
+	// SMTP server options, for the smtp notifier
+	SMTPAddr         string
+	SMTPStartTLS     bool
+	SMTPUser         string
+	SMTPPasswordFile string
+
+	// ChatWebhook is the Mattermost, or Slack, incoming
+	// webhook URL, for the chat notifier
+	ChatWebhook string
+
+	// Webhook is the URL to which the webhook notifier posts JSON
+	Webhook string
+
+	// Templates is the directory of <kind>.tmpl notification templates
+	Templates string
+
+	// NotifySuccess sends a notification on success too
+	NotifySuccess bool
+
+	// Digest replaces the per-install notifications with the digest
+	// sent by the digest command, covering all installs since the
+	// last digest, which is recorded in the DigestStateFile
+	Digest          bool
+	DigestStateFile string
+
+	// StatsDAddr is the UDP address to which metrics are sent
+	StatsDAddr string
+
+	// MetricsAddr is the address on which to serve Prometheus metrics
+	MetricsAddr string
+
+	// MetricsTextFile is the node exporter textfile to
+	// which Prometheus metrics are written after each run
+	MetricsTextFile string
 }
 
 func (o *AdminOpts) flags() {
@@ -22,6 +66,27 @@ func (o *AdminOpts) flags() {
 		"Switch on metrics monitoring (default false i.e. switched off)",
 	)
 
+	flag.StringVar(
+		&o.StatsDAddr,
+		"admin.statsd-addr",
+		"localhost:8125",
+		"UDP address of the StatsD server to which metrics are sent, if monitoring",
+	)
+
+	flag.StringVar(
+		&o.MetricsAddr,
+		"admin.metrics-addr",
+		"",
+		"Address, e.g. :9101, on which to serve Prometheus metrics at /metrics (default none)",
+	)
+
+	flag.StringVar(
+		&o.MetricsTextFile,
+		"admin.metrics-textfile",
+		"",
+		"Node exporter textfile (*.prom) to which Prometheus metrics are written after each run (default none)",
+	)
+
 	flag.StringVar(
 		&o.EmailFrom,
 		"admin.email-from",
@@ -44,7 +109,88 @@ func (o *AdminOpts) flags() {
 		&o.DontSendEmail,
 		"admin.no-email",
 		false,
-		"Do not send an email on failure (default false i.e do send email)",
+		"Do not send notifications on failure (default false i.e do send them)",
+	)
+
+	flag.StringVar(
+		&o.Notify,
+		"admin.notify",
+		"mailx",
+		fmt.Sprintf("Comma-separated list of notifiers to use, from: %s", strings.Join(Notifiers, ", ")),
+	)
+
+	flag.StringVar(
+		&o.SMTPAddr,
+		"admin.smtp-addr",
+		"localhost:25",
+		"host:port of the SMTP server, for the smtp notifier",
+	)
+
+	flag.BoolVar(
+		&o.SMTPStartTLS,
+		"admin.smtp-starttls",
+		false,
+		"Require STARTTLS with the SMTP server (default false)",
+	)
+
+	flag.StringVar(
+		&o.SMTPUser,
+		"admin.smtp-user",
+		"",
+		"User with which to authenticate to the SMTP server (default none)",
+	)
+
+	flag.StringVar(
+		&o.SMTPPasswordFile,
+		"admin.smtp-password-file",
+		"",
+		"File containing the password of the SMTP user",
+	)
+
+	flag.StringVar(
+		&o.ChatWebhook,
+		"admin.chat-webhook",
+		"",
+		"Mattermost, or Slack, incoming webhook URL, for the chat notifier",
+	)
+
+	flag.StringVar(
+		&o.Webhook,
+		"admin.webhook",
+		"",
+		"URL to which the webhook notifier posts JSON",
+	)
+
+	flag.StringVar(
+		&o.Templates,
+		"admin.templates",
+		"",
+		fmt.Sprintf(
+			"Directory of text/template notification templates, named <kind>.tmpl "+
+				"for the kinds: %s (default built-in templates)",
+			strings.Join(notify.Kinds, ", "),
+		),
+	)
+
+	flag.BoolVar(
+		&o.NotifySuccess,
+		"admin.notify-success",
+		false,
+		"Send a notification on success too (default false)",
+	)
+
+	flag.BoolVar(
+		&o.Digest,
+		"admin.digest",
+		false,
+		"Do not notify about each install, but only in the digest sent by the digest command (default false)",
+	)
+
+	flag.StringVar(
+		&o.DigestStateFile,
+		"admin.digest-state-file",
+		"",
+		"File recording the time of the last digest (default <dirs.work>/digest/last)",
 	)
 }
 
@@ -58,15 +204,108 @@ func (o *AdminOpts) validate() error {
 		}
 	}
 
+	for _, name := range o.notifiers() {
+		switch name {
+		case "mailx", "smtp":
+		case "chat":
+			if o.ChatWebhook == "" {
+				return fmt.Errorf("The chat notifier requires a webhook URL")
+			}
+		case "webhook":
+			if o.Webhook == "" {
+				return fmt.Errorf("The webhook notifier requires a URL")
+			}
+		default:
+			return fmt.Errorf(
+				"Unknown notifier %s, must be one of: %s",
+				name,
+				strings.Join(Notifiers, ", "),
+			)
+		}
+	}
+
+	if o.Templates != "" {
+		if _, err := notify.NewTemplates(o.Templates); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// notifiers returns the names of the notifiers to use
+func (o *AdminOpts) notifiers() []string {
+	var names []string
+	for _, name := range strings.Split(o.Notify, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Notifier returns the notifier sending with each of the requested notifiers
+func (o *AdminOpts) Notifier() (notify.Notifier, error) {
+	var multi notify.Multi
+	for _, name := range o.notifiers() {
+		switch name {
+		case "mailx":
+			if email := notify.NewEmail(o.EmailFrom, o.EmailTo); email != nil {
+				multi = append(multi, email)
+			}
+
+		case "smtp":
+			smtpOpts := &notify.SMTPOpts{
+				Addr:     o.SMTPAddr,
+				From:     o.EmailFrom,
+				To:       o.EmailTo,
+				StartTLS: o.SMTPStartTLS,
+				Username: o.SMTPUser,
+			}
+
+			if o.SMTPPasswordFile != "" {
+				password, err := ioutil.ReadFile(o.SMTPPasswordFile)
+				if err != nil {
+					return nil, fmt.Errorf("unable to read the SMTP password (%w)", err)
+				}
+				smtpOpts.Password = strings.TrimSpace(string(password))
+			}
+
+			smtp, err := notify.NewSMTP(smtpOpts)
+			if err != nil {
+				return nil, err
+			}
+			multi = append(multi, smtp)
+
+		case "chat":
+			multi = append(multi, notify.NewChatWebhook(o.ChatWebhook))
+
+		case "webhook":
+			multi = append(multi, notify.NewJSONWebhook(o.Webhook))
+		}
+	}
+
+	return multi, nil
+}
+
 func (o *AdminOpts) String() string {
 	args := []string{
 		"- Admin Options:",
 		fmt.Sprintf("   - Failure email sender = %s", o.EmailFrom),
 		fmt.Sprintf("   - Failure email recipients = %s", o.EmailTo),
-		fmt.Sprintf("   - Send email on failure: %t", !o.DontSendEmail),
+		fmt.Sprintf("   - Send notifications on failure: %t", !o.DontSendEmail),
+		fmt.Sprintf("   - Notifiers: %s", o.Notify),
+		fmt.Sprintf("   - SMTP server: %s (STARTTLS: %t, user: %s)", o.SMTPAddr, o.SMTPStartTLS, o.SMTPUser),
+		fmt.Sprintf("   - Chat webhook set: %t", o.ChatWebhook != ""),
+		fmt.Sprintf("   - Webhook: %s", o.Webhook),
+		fmt.Sprintf("   - Notification templates: %s", o.Templates),
+		fmt.Sprintf("   - Notify on success: %t", o.NotifySuccess),
+		fmt.Sprintf("   - Digest: %t (state file: %s)", o.Digest, o.DigestStateFile),
+		fmt.Sprintf("   - Monitor: %t", o.Monitor),
+		fmt.Sprintf("   - StatsD address: %s", o.StatsDAddr),
+		fmt.Sprintf("   - Metrics address: %s", o.MetricsAddr),
+		fmt.Sprintf("   - Metrics textfile: %s", o.MetricsTextFile),
 	}
 
 	return strings.Join(args, "\n")
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/afs"
 )
@@ -26,6 +27,50 @@ func (a *AfsOpts) flags() {
 		10,
 		"Max number of attempts to be made to open a transaction, before aborting",
 	)
+
+	retryFlags("afs", &a.RetryOpts)
+
+	flag.BoolVar(
+		&a.ReadWrite,
+		"afs.read-write",
+		true,
+		"Install on AFS through the read-write path, /afs/.<cell>/..., of the volume",
+	)
+
+	flag.StringVar(
+		&a.Volume,
+		"afs.volume",
+		"",
+		"AFS volume released to its read-only replicas once installed (default none i.e. no release)",
+	)
+
+	flag.StringVar(
+		&a.Path,
+		"afs.quota-path",
+		"",
+		"Path whose volume quota is checked before installing (default <dirs.install>)",
+	)
+
+	flag.IntVar(
+		&a.MinFreeQuota,
+		"afs.min-free-quota",
+		0,
+		"Free quota, in MB, needed on the volume to start installing (default 0 i.e. no check)",
+	)
+
+	flag.StringVar(
+		&a.FsBinary,
+		"afs.fs-exe",
+		"/usr/bin/fs",
+		"Path to the AFS fs executable",
+	)
+
+	flag.StringVar(
+		&a.VosBinary,
+		"afs.vos-exe",
+		"/usr/sbin/vos",
+		"Path to the AFS vos executable",
+	)
 }
 
 func (a *AfsOpts) validate() error {
@@ -37,5 +82,28 @@ func (a *AfsOpts) validate() error {
 			max,
 		)
 	}
-	return nil
+
+	if a.MinFreeQuota < 0 {
+		return fmt.Errorf("-afs.min-free-quota should be >= 0, got %d", a.MinFreeQuota)
+	}
+
+	return validateRetry("afs", &a.RetryOpts)
+}
+
+func (a *AfsOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- AFS Options:",
+			fmt.Sprintf("   - Sudo User: %s", a.SudoUser),
+			fmt.Sprintf("   - Read-Write Path: %t", a.ReadWrite),
+			fmt.Sprintf("   - Volume: %s", a.Volume),
+			fmt.Sprintf("   - Quota Path: %s", a.Path),
+			fmt.Sprintf("   - Min Free Quota: %d MB", a.MinFreeQuota),
+			fmt.Sprintf("   - fs Binary: %s", a.FsBinary),
+			fmt.Sprintf("   - vos Binary: %s", a.VosBinary),
+			fmt.Sprintf("   - Max Open Transaction Attempts: %d", a.MaxTransactionAttempts),
+			retryString(&a.RetryOpts),
+		},
+		"\n",
+	)
 }
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/brinick/atlas-rpm-installer/pkg/ayum"
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/ayum"
 )
 
 // AyumOpts are options for ayum
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/ayum"
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/dnf"
+)
+
+// nightlyList is a repeatable flag of nightlies, each of
+// the form <branch>/<platform>/<timestamp>/<project>.
+// A single flag value may also list several, comma-separated.
+type nightlyList []string
+
+func (n *nightlyList) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *nightlyList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*n = append(*n, v)
+		}
+	}
+
+	return nil
+}
+
+func (n *nightlyList) Get() interface{} {
+	return []string(*n)
+}
+
+// ------------------------------------------------------------------
+
+// BatchOpts are options for installing several nightlies in a single
+// file system transaction, in place of the -release and -project nightly
+type BatchOpts struct {
+	// Nightlies are the nightlies given on the command line
+	Nightlies nightlyList
+
+	// File is the path to a file listing nightlies, one per line
+	File string
+}
+
+func (b *BatchOpts) flags() {
+	flag.Var(
+		&b.Nightlies,
+		"batch.nightly",
+		"Nightly to install in the batch, as <branch>/<platform>/<timestamp>/<project> "+
+			"(may be repeated)",
+	)
+
+	flag.StringVar(
+		&b.File,
+		"batch.file",
+		"",
+		"File listing the nightlies to install in the batch, one "+
+			"<branch>/<platform>/<timestamp>/<project> per line",
+	)
+}
+
+func (b *BatchOpts) validate() error {
+	return nil
+}
+
+func (b *BatchOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Batch Options:",
+			fmt.Sprintf("   - Nightlies: %s", b.Nightlies.String()),
+			fmt.Sprintf("   - File: %s", b.File),
+		},
+		"\n",
+	)
+}
+
+// isEmpty indicates if no batch of nightlies was requested
+func (b *BatchOpts) isEmpty() bool {
+	return len(b.Nightlies) == 0 && b.File == ""
+}
+
+// all returns the nightlies given on the command line, followed by those
+// in the batch file. Blank lines and lines starting with # are ignored.
+func (b *BatchOpts) all() ([]string, error) {
+	nightlies := append([]string{}, b.Nightlies...)
+	if b.File == "" {
+		return nightlies, nil
+	}
+
+	f, err := os.Open(b.File)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open batch file (%w)", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		nightlies = append(nightlies, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read batch file %s (%w)", b.File, err)
+	}
+
+	return nightlies, nil
+}
+
+// ------------------------------------------------------------------
+
+// Nightly groups the options that are specific to the install of one nightly
+type Nightly struct {
+	Install   *InstallOpts
+	Ayum      *ayum.Opts
+	Dnf       *dnf.Opts
+	RPMSrcDir string
+}
+
+// PkgInstallDir returns the install directory of the nightly's package manager
+func (n *Nightly) PkgInstallDir(pkgManager string) string {
+	if pkgManager == "dnf" {
+		return n.Dnf.InstallDir
+	}
+
+	return n.Ayum.InstallDir
+}
+
+// Nightlies returns the nightlies to install: those of the batch, if one
+// was given, else the single -release and -project nightly. The install
+// and source directories of batch nightlies are derived from the base
+// directories, so -dirs.rpmsrc, -ayum.install-dir and -dnf.install-dir
+// only apply to the single nightly.
+func (c *Config) Nightlies() []*Nightly {
+	return c.nightlies
+}
+
+// validateNightlies validates the nightly, or batch of nightlies, to install
+func (c *Config) validateNightlies() error {
+	if c.Batch.isEmpty() {
+		if err := c.Install.validate(); err != nil {
+			return err
+		}
+
+		c.nightlies = []*Nightly{
+			&Nightly{
+				Install:   c.Install,
+				Ayum:      &c.Ayum.Opts,
+				Dnf:       &c.Dnf.Opts,
+				RPMSrcDir: c.Dirs.RPMSrcBase,
+			},
+		}
+
+		return nil
+	}
+
+	batch, err := c.Batch.all()
+	if err != nil {
+		return err
+	}
+
+	if len(batch) == 0 {
+		return fmt.Errorf("batch of nightlies to install is empty")
+	}
+
+	c.nightlies = nil
+	for _, nightly := range batch {
+		n, err := c.batchNightly(nightly)
+		if err != nil {
+			return fmt.Errorf("bad batch nightly %s: %w", nightly, err)
+		}
+
+		c.nightlies = append(c.nightlies, n)
+	}
+
+	return nil
+}
+
+// batchNightly creates the options for the given batch nightly
+func (c *Config) batchNightly(nightly string) (*Nightly, error) {
+	i := strings.LastIndex(nightly, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("expected <branch>/<platform>/<timestamp>/<project>")
+	}
+
+	install := *c.Install
+	install.Release, install.Project = nightly[:i], nightly[i+1:]
+	if err := install.validate(); err != nil {
+		return nil, err
+	}
+
+	ayumOpts, dnfOpts := c.Ayum.Opts, c.Dnf.Opts
+	ayumOpts.InstallDir = filepath.Join(c.Dirs.InstallBase, install.Branch)
+	dnfOpts.InstallDir = filepath.Join(c.Dirs.InstallBase, install.Branch)
+
+	return &Nightly{
+		Install:   &install,
+		Ayum:      &ayumOpts,
+		Dnf:       &dnfOpts,
+		RPMSrcDir: filepath.Join(c.EOS.NightlyBaseDir, install.Release),
+	}, nil
+}
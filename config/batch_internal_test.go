@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBatchNightlies(t *testing.T) {
+	stamp := time.Now().Add(-time.Hour).Format("2006-01-02T1504")
+	platform := "x86_64-centos7-gcc8-opt"
+
+	path, cleanup := writeConfigFile(
+		t,
+		"batch.txt",
+		fmt.Sprintf("# nightlies\n\n22.0/%s/%s/AthSimulation\n", platform, stamp),
+	)
+	defer cleanup()
+
+	var c Config
+	c.instantiate()
+	c.Install.PkgManager = "dnf"
+	c.Dirs.InstallBase = "/cvmfs/sw"
+	c.EOS.NightlyBaseDir = "/eos/nightlies"
+	c.Batch.File = path
+	c.Batch.Nightlies.Set(fmt.Sprintf("master/%s/%s/AtlasOffline", platform, stamp))
+
+	if err := c.validateNightlies(); err != nil {
+		t.Fatalf("unable to validate batch nightlies: %v", err)
+	}
+
+	nightlies := c.Nightlies()
+	if len(nightlies) != 2 {
+		t.Fatalf("expected 2 nightlies, got %d", len(nightlies))
+	}
+
+	n := nightlies[1]
+	if n.Install.Branch != "22.0" || n.Install.Project != "AthSimulation" || n.Install.Timestamp != stamp {
+		t.Errorf("unexpected batch file nightly: %+v", n.Install.Opts)
+	}
+
+	if n.Dnf.InstallDir != "/cvmfs/sw/22.0" || nightlies[0].Dnf.InstallDir != "/cvmfs/sw/master" {
+		t.Errorf("each nightly should have its own install dir, got %s", n.Dnf.InstallDir)
+	}
+
+	if expect := "/eos/nightlies/22.0/" + platform + "/" + stamp; n.RPMSrcDir != expect {
+		t.Errorf("RPM source dir should be %s, got %s", expect, n.RPMSrcDir)
+	}
+
+	c.Batch.Nightlies.Set("master/" + platform + "/AtlasOffline")
+	if err := c.validateNightlies(); err == nil {
+		t.Errorf("expected an error for a malformed batch nightly, got nil")
+	}
+}
@@ -48,6 +48,97 @@ func (c *CvmfsOpts) flags() {
 		10,
 		"Max number of attempts to be made to open a transaction, before aborting",
 	)
+
+	retryFlags("cvmfs", &c.RetryOpts)
+
+	flag.StringVar(
+		&c.Backend,
+		"cvmfs.backend",
+		cvmfs.BackendServer,
+		fmt.Sprintf(
+			"How to open the transaction: %s with the cvmfs_server binary, "+
+				"or %s by leasing the path from the cvmfs-gateway",
+			cvmfs.BackendServer,
+			cvmfs.BackendGateway,
+		),
+	)
+
+	flag.StringVar(
+		&c.GatewayURL,
+		"cvmfs.gateway-url",
+		"",
+		"cvmfs-gateway API URL, for the gateway backend (default http://<cvmfs.release-manager>:4929/api/v1)",
+	)
+
+	flag.StringVar(
+		&c.GatewayKeyFile,
+		"cvmfs.gateway-key-file",
+		"",
+		"Key file with which gateway requests are signed (default /etc/cvmfs/keys/<cvmfs.nightly-repo>.gw)",
+	)
+
+	flag.StringVar(
+		&c.LeasePath,
+		"cvmfs.lease-path",
+		"",
+		"Path within the repo leased from the gateway (default the whole repo)",
+	)
+
+	flag.BoolVar(
+		&c.ScopeTransactions,
+		"cvmfs.scope-transactions",
+		false,
+		"Scope each transaction to the deepest directory containing those written "+
+			"by the nightlies installed, so that other nightlies may be installed concurrently",
+	)
+
+	flag.IntVar(
+		&c.CatalogMaxEntries,
+		"cvmfs.catalog-max-entries",
+		200000,
+		"Number of entries in a directory tree beyond which it gets its own nested catalog (0: no limit)",
+	)
+
+	flag.BoolVar(
+		&c.CatalogDirtab,
+		"cvmfs.catalog-dirtab",
+		false,
+		"Record the nested catalogs in the repo .cvmfsdirtab, if the transaction covers the whole repo (default false)",
+	)
+
+	flag.StringVar(
+		&c.CatalogPolicy,
+		"cvmfs.catalog-policy",
+		cvmfs.CatalogPolicyWarn,
+		fmt.Sprintf(
+			"On failing to create the nested catalogs, %s the install, or only %s",
+			cvmfs.CatalogPolicyFail,
+			cvmfs.CatalogPolicyWarn,
+		),
+	)
+
+	flag.StringVar(
+		&c.SpoolDir,
+		"cvmfs.spool-dir",
+		"/var/spool/cvmfs",
+		"The cvmfs_server spool directory, holding the transaction lock files",
+	)
+
+	flag.StringVar(
+		&c.LeaseFile,
+		"cvmfs.lease-file",
+		"",
+		"File recording the installer process holding the transaction "+
+			"(default <dirs.work>/cvmfs/<cvmfs.nightly-repo>.lease)",
+	)
+
+	flag.IntVar(
+		&c.StaleTransactionAge,
+		"cvmfs.stale-transaction-age",
+		0,
+		"Age, in minutes, beyond which a transaction left open by a crashed installer "+
+			"is aborted before opening ours (default 0 i.e. never abort)",
+	)
 }
 
 func (c *CvmfsOpts) validate() error {
@@ -59,6 +150,35 @@ func (c *CvmfsOpts) validate() error {
 			max,
 		)
 	}
+
+	if !contains(c.Backend, cvmfs.Backends) {
+		return fmt.Errorf(
+			"Unknown CVMFS backend %s, must be one of: %s",
+			c.Backend,
+			strings.Join(cvmfs.Backends, ", "),
+		)
+	}
+
+	if !contains(c.CatalogPolicy, cvmfs.CatalogPolicies) {
+		return fmt.Errorf(
+			"Unknown CVMFS catalog policy %s, must be one of: %s",
+			c.CatalogPolicy,
+			strings.Join(cvmfs.CatalogPolicies, ", "),
+		)
+	}
+
+	if c.CatalogMaxEntries < 0 {
+		return fmt.Errorf("-cvmfs.catalog-max-entries should be >= 0, got %d", c.CatalogMaxEntries)
+	}
+
+	if err := validateRetry("cvmfs", &c.RetryOpts); err != nil {
+		return err
+	}
+
+	if c.StaleTransactionAge < 0 {
+		return fmt.Errorf("-cvmfs.stale-transaction-age should be >= 0, got %d", c.StaleTransactionAge)
+	}
+
 	return nil
 }
 
@@ -70,7 +190,19 @@ func (c *CvmfsOpts) String() string {
 			fmt.Sprintf("   - Binary: %s", c.Binary),
 			fmt.Sprintf("   - Gateway Node: %s", c.ReleaseManager),
 			fmt.Sprintf("   - Nightly Repo: %s", c.NightlyRepo),
+			fmt.Sprintf("   - Backend: %s", c.Backend),
+			fmt.Sprintf("   - Gateway URL: %s", c.GatewayURL),
+			fmt.Sprintf("   - Gateway Key File: %s", c.GatewayKeyFile),
+			fmt.Sprintf("   - Lease Path: %s", c.LeasePath),
+			fmt.Sprintf("   - Scope Transactions: %t", c.ScopeTransactions),
+			fmt.Sprintf("   - Catalog Max Entries: %d", c.CatalogMaxEntries),
+			fmt.Sprintf("   - Catalog Dirtab: %t", c.CatalogDirtab),
+			fmt.Sprintf("   - Catalog Policy: %s", c.CatalogPolicy),
 			fmt.Sprintf("   - Max Open Transaction Attempts: %d", c.MaxTransactionAttempts),
+			fmt.Sprintf("   - Spool Dir: %s", c.SpoolDir),
+			fmt.Sprintf("   - Lease File: %s", c.LeaseFile),
+			fmt.Sprintf("   - Stale Transaction Age: %dm", c.StaleTransactionAge),
+			retryString(&c.RetryOpts),
 		},
 		"\n",
 	)
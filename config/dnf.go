@@ -0,0 +1,77 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/dnf"
+)
+
+// DnfOpts are options for dnf
+type DnfOpts struct {
+	dnf.Opts
+}
+
+func (d *DnfOpts) flags() {
+	flag.StringVar(
+		&d.Binary,
+		"dnf.exe",
+		"/usr/bin/dnf",
+		"Path to the dnf executable",
+	)
+
+	flag.StringVar(
+		&d.RPMBinary,
+		"dnf.rpm-exe",
+		"/usr/bin/rpm",
+		"Path to the rpm executable used to install the packages resolved by dnf",
+	)
+
+	flag.StringVar(
+		&d.WorkDir,
+		"dnf.dir",
+		"",
+		"Directory in which to create the dnf configuration and cache (default is value of the -dirs.work variable + dnf)",
+	)
+
+	flag.StringVar(
+		&d.InstallDir,
+		"dnf.install-dir",
+		"",
+		"The dnf install root below which to install RPMs (default is value of the -dirs.install + <branchName>)",
+	)
+
+	flag.IntVar(
+		&d.Timeout,
+		"dnf.cmd-timeout",
+		300,
+		"Maximum number of seconds to allow for running dnf commands like makecache",
+	)
+
+	flag.IntVar(
+		&d.InstallTimeout,
+		"dnf.install-timeout",
+		3600,
+		"Maximum number of seconds to allow for running an rpm install command",
+	)
+}
+
+func (d *DnfOpts) validate() error {
+	return nil
+}
+
+func (d *DnfOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Dnf Options:",
+			fmt.Sprintf("   - Binary: %s", d.Binary),
+			fmt.Sprintf("   - RPM Binary: %s", d.RPMBinary),
+			fmt.Sprintf("   - Work Dir: %s", d.WorkDir),
+			fmt.Sprintf("   - Install Dir: %s", d.InstallDir),
+			fmt.Sprintf("   - Command TimeOut: %ds", d.Timeout),
+			fmt.Sprintf("   - Install TimeOut: %ds", d.InstallTimeout),
+		},
+		"\n",
+	)
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var planFormats = []string{"text", "json"}
+
+// DryRunOpts are options for planning, rather than doing, the install
+type DryRunOpts struct {
+	// Enabled indicates that the install plan should be
+	// printed, without opening the file system transaction
+	Enabled bool
+
+	// Format is the format of the printed plan
+	Format string
+}
+
+func (d *DryRunOpts) flags() {
+	flag.BoolVar(
+		&d.Enabled,
+		"dry-run",
+		false,
+		"Print the install plan, without installing anything",
+	)
+	flag.StringVar(
+		&d.Format,
+		"dry-run.format",
+		"text",
+		fmt.Sprintf("Format of the install plan (one of: %s)", strings.Join(planFormats, ", ")),
+	)
+}
+
+func (d *DryRunOpts) validate() error {
+	if !contains(d.Format, planFormats) {
+		return fmt.Errorf("%s: unknown dry run format", d.Format)
+	}
+
+	return nil
+}
+
+func (d *DryRunOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Dry Run Options:",
+			fmt.Sprintf("   - Enabled: %t", d.Enabled),
+			fmt.Sprintf("   - Format: %s", d.Format),
+		},
+		"\n",
+	)
+}
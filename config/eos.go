@@ -4,12 +4,29 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
 )
 
 // EosOpts are options for EOS
 type EosOpts struct {
 	BaseDir        string
 	NightlyBaseDir string
+
+	// GenerateRepodata indicates if yum repository metadata should be
+	// generated in the nightly RPM directory, if it has none up to date
+	GenerateRepodata bool
+
+	// CheckDigests has the RPM digests checked before installing
+	CheckDigests bool
+
+	// GPGKeys are the comma-separated armored public key
+	// files against which RPM signatures are checked
+	GPGKeys string
+
+	// Wait for the nightly RPMs to be fully copied before installing
+	Wait bool
+	rpm.WaitOpts
 }
 
 func (e *EosOpts) flags() {
@@ -25,10 +42,87 @@ func (e *EosOpts) flags() {
 		"/eos/project/a/atlas-software-dist/www/RPMs/nightlies/",
 		"Base directory in EOS for storing nightly RPMs",
 	)
+	flag.BoolVar(
+		&e.GenerateRepodata,
+		"eos.generate-repodata",
+		false,
+		"Generate the repodata for the nightly RPM directory, if missing or stale",
+	)
+	flag.BoolVar(
+		&e.CheckDigests,
+		"eos.check-digests",
+		true,
+		"Check the header and payload digests of the RPMs before installing them",
+	)
+	flag.StringVar(
+		&e.GPGKeys,
+		"eos.gpg-keys",
+		"",
+		"Comma-separated armored public key files against which RPM signatures, "+
+			"and so digests, are checked (default none i.e. no signature check)",
+	)
+	flag.BoolVar(
+		&e.Wait,
+		"eos.wait",
+		false,
+		"Wait for the nightly RPMs to be fully copied to EOS before installing (default false)",
+	)
+	flag.IntVar(
+		&e.Timeout,
+		"eos.wait-timeout",
+		7200,
+		"Maximum number of seconds to wait for the nightly RPMs (0: no timeout)",
+	)
+	flag.IntVar(
+		&e.Poll,
+		"eos.wait-poll",
+		60,
+		"Number of seconds between checks that the nightly RPMs are complete",
+	)
+	flag.IntVar(
+		&e.Settle,
+		"eos.wait-settle",
+		120,
+		"Number of seconds for which the RPM sizes must be stable for the copy to be complete",
+	)
+	flag.StringVar(
+		&e.Marker,
+		"eos.wait-marker",
+		".complete",
+		"File whose presence in the nightly RPM directory marks the copy as complete",
+	)
 }
 
 func (e *EosOpts) validate() error {
-	return nil
+	if e.Wait {
+		if e.Timeout < 0 || e.Settle < 0 {
+			return fmt.Errorf("-eos.wait-timeout and -eos.wait-settle should be >= 0")
+		}
+
+		if e.Poll < 1 {
+			return fmt.Errorf("-eos.wait-poll should be >= 1, got %d", e.Poll)
+		}
+	}
+
+	_, err := e.Checker()
+	return err
+}
+
+// Checker returns the checker of the RPMs found,
+// nil if they should not be checked
+func (e *EosOpts) Checker() (*rpm.Checker, error) {
+	var keys []string
+	for _, key := range strings.Split(e.GPGKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if !e.CheckDigests && len(keys) == 0 {
+		return nil, nil
+	}
+
+	return rpm.NewChecker(keys...)
 }
 
 func (e *EosOpts) String() string {
@@ -37,6 +131,17 @@ func (e *EosOpts) String() string {
 			"- EOS Options:",
 			fmt.Sprintf("   - Base Dir: %s", e.BaseDir),
 			fmt.Sprintf("   - Nightly Base Dir: %s", e.NightlyBaseDir),
+			fmt.Sprintf("   - Generate Repodata: %t", e.GenerateRepodata),
+			fmt.Sprintf("   - Check Digests: %t", e.CheckDigests),
+			fmt.Sprintf("   - GPG Keys: %s", e.GPGKeys),
+			fmt.Sprintf(
+				"   - Wait: %t (timeout: %ds, poll: %ds, settle: %ds, marker: %s)",
+				e.Wait,
+				e.Timeout,
+				e.Poll,
+				e.Settle,
+				e.Marker,
+			),
 		},
 		"\n",
 	)
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configEnvVar is the environment variable that may point to a config file
+const configEnvVar = "ATLAS_RPM_INSTALLER_CONFIG"
+
+// The flags of the config file options, which cannot be set from a config file
+const (
+	configFlag     = "config"
+	configDumpFlag = "config.dump"
+)
+
+// FileOpts are options for the configuration file. Values in the
+// file override the flag defaults, and are in turn overridden by
+// the command line. Keys are the flag names, given either dotted
+// (e.g. "cvmfs.nightly-repo") or nested (cvmfs: {nightly-repo: ...}).
+type FileOpts struct {
+	// Path is the path to the config file, if any
+	Path string
+
+	// Dump indicates that the effective configuration should be
+	// printed, in the format of the config file (JSON by default)
+	Dump bool
+
+	// Format of the config file, "json" or "yaml"
+	Format string
+}
+
+func (f *FileOpts) flags() {
+	flag.StringVar(
+		&f.Path,
+		configFlag,
+		"",
+		"Path to a JSON or YAML config file "+
+			"(default is ./config.json, else the value of $"+configEnvVar+", if set)",
+	)
+
+	flag.BoolVar(
+		&f.Dump,
+		configDumpFlag,
+		false,
+		"Print the effective configuration, in the config file format, and exit",
+	)
+}
+
+func (f *FileOpts) validate() error {
+	return nil
+}
+
+func (f *FileOpts) String() string {
+	path := f.Path
+	if path == "" {
+		path = "none"
+	}
+
+	return strings.Join(
+		[]string{
+			"- Config File Options:",
+			fmt.Sprintf("   - Path: %s", path),
+		},
+		"\n",
+	)
+}
+
+// load finds the config file, if there is one, and sets from it
+// the value of each flag that was not given on the command line
+func (f *FileOpts) load(fs *flag.FlagSet) error {
+	if f.Path == "" {
+		path, err := findConfigFile()
+		if err != nil {
+			return err
+		}
+		f.Path = path
+	}
+
+	f.Format = fileFormat(f.Path)
+	if f.Path == "" {
+		return nil
+	}
+
+	values, err := readConfigFile(f.Path, f.Format)
+	if err != nil {
+		return err
+	}
+
+	return applyConfigValues(fs, values)
+}
+
+// ------------------------------------------------------------------
+
+// findConfigFile tries to find a configuration file, and returns
+// the path to it, if successful. It checks in two places:
+//  1. in the current directory for config.json file
+//  2. in the env var ATLAS_RPM_INSTALLER_CONFIG
+func findConfigFile() (string, error) {
+	here, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(here, "config.json")
+	exists, err := fileExists(path)
+	if err != nil || exists {
+		return path, err
+	}
+
+	path, found := os.LookupEnv(configEnvVar)
+	if found {
+		return path, nil
+	}
+
+	// No config file available
+	return "", nil
+}
+
+// fileFormat returns the format of the config file from its extension
+func fileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// readConfigFile reads the config file, returning its
+// values as strings keyed by the dotted flag name
+func readConfigFile(path, format string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file (%w)", err)
+	}
+
+	var tree map[string]interface{}
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, &tree)
+	default:
+		err = json.Unmarshal(data, &tree)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s (%w)", path, err)
+	}
+
+	var values = map[string]string{}
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// flatten converts the nested config file values into
+// flag values, keyed by the dot-joined nested keys
+func flatten(key string, value interface{}, values map[string]string) error {
+	join := func(k interface{}) string {
+		if key == "" {
+			return fmt.Sprintf("%v", k)
+		}
+		return fmt.Sprintf("%s.%v", key, k)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, vv := range v {
+			if err := flatten(join(k), vv, values); err != nil {
+				return err
+			}
+		}
+
+	case map[interface{}]interface{}:
+		// yaml.v2 decodes nested mappings with interface{} keys
+		for k, vv := range v {
+			if err := flatten(join(k), vv, values); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		// Lists, such as of email addresses, are comma-separated flag values
+		var items []string
+		for _, item := range v {
+			items = append(items, scalar(item))
+		}
+		values[key] = strings.Join(items, ",")
+
+	case nil:
+		return fmt.Errorf("option %s has no value", key)
+
+	default:
+		values[key] = scalar(v)
+	}
+
+	return nil
+}
+
+// scalar formats a config file value as a flag value. JSON numbers
+// decode as floats, formatted without an exponent so that they parse
+// as integer flag values.
+func scalar(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// applyConfigValues sets the flags from the config file values,
+// except for those flags already set on the command line
+func applyConfigValues(fs *flag.FlagSet, values map[string]string) error {
+	var onCLI = map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		onCLI[f.Name] = true
+	})
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == configFlag || name == configDumpFlag {
+			return fmt.Errorf("option %s cannot be set in a config file", name)
+		}
+
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %s in config file", name)
+		}
+
+		if onCLI[name] {
+			continue
+		}
+
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("bad value for option %s in config file (%w)", name, err)
+		}
+	}
+
+	return nil
+}
+
+// dumpConfig returns the current value of all flags, keyed by
+// flag name, encoded in the given config file format
+func dumpConfig(fs *flag.FlagSet, format string) (string, error) {
+	var values = map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == configDumpFlag {
+			return
+		}
+
+		if getter, ok := f.Value.(flag.Getter); ok {
+			values[f.Name] = getter.Get()
+			return
+		}
+
+		values[f.Name] = f.Value.String()
+	})
+
+	var (
+		data []byte
+		err  error
+	)
+
+	switch format {
+	case "yaml":
+		data, err = yaml.Marshal(values)
+	default:
+		data, err = json.MarshalIndent(values, "", "  ")
+		data = append(data, '\n')
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("unable to encode configuration (%w)", err)
+	}
+
+	return string(data), nil
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testFlags struct {
+	fs      *flag.FlagSet
+	repo    string
+	timeout int
+	emails  string
+	noEmail bool
+}
+
+func newTestFlags(args ...string) *testFlags {
+	tf := &testFlags{fs: flag.NewFlagSet("test", flag.ContinueOnError)}
+	tf.fs.StringVar(&tf.repo, "cvmfs.nightly-repo", "default.cern.ch", "")
+	tf.fs.IntVar(&tf.timeout, "global.timeout", 0, "")
+	tf.fs.StringVar(&tf.emails, "admin.email-to", "", "")
+	tf.fs.BoolVar(&tf.noEmail, "admin.no-email", false, "")
+	tf.fs.Parse(args)
+	return tf
+}
+
+func writeConfigFile(t *testing.T, name, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file (%v)", err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	path, cleanup := writeConfigFile(
+		t,
+		"config.yaml",
+		"cvmfs:\n  nightly-repo: file.cern.ch\nglobal.timeout: 60\nadmin:\n  email-to:\n    - a@cern.ch\n    - b@cern.ch\n",
+	)
+	defer cleanup()
+
+	tf := newTestFlags("-global.timeout", "5")
+	opts := &FileOpts{Path: path}
+	if err := opts.load(tf.fs); err != nil {
+		t.Fatalf("unable to load config file: %v", err)
+	}
+
+	if tf.repo != "file.cern.ch" {
+		t.Errorf("config file value should override the default, got %s", tf.repo)
+	}
+
+	if tf.timeout != 5 {
+		t.Errorf("command line value should override the config file, got %d", tf.timeout)
+	}
+
+	if tf.emails != "a@cern.ch,b@cern.ch" {
+		t.Errorf("list value should be comma-separated, got %s", tf.emails)
+	}
+
+	if tf.noEmail {
+		t.Errorf("unset value should keep its default")
+	}
+}
+
+func TestConfigFileNumbers(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.json": `{"global": {"timeout": 1000000}}`,
+		"config.yaml": "global:\n  timeout: 1000000\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path, cleanup := writeConfigFile(t, name, content)
+			defer cleanup()
+
+			tf := newTestFlags()
+			opts := &FileOpts{Path: path}
+			if err := opts.load(tf.fs); err != nil {
+				t.Fatalf("unable to load config file: %v", err)
+			}
+
+			if tf.timeout != 1000000 {
+				t.Errorf("expected a timeout of 1000000, got %d", tf.timeout)
+			}
+		})
+	}
+}
+
+func TestConfigFileUnknownOption(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "config.json", `{"cvmfs": {"nightly-rep": "x"}}`)
+	defer cleanup()
+
+	opts := &FileOpts{Path: path}
+	if err := opts.load(newTestFlags().fs); err == nil {
+		t.Errorf("expected an error for an unknown option, got nil")
+	}
+}
+
+func TestConfigDumpRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		tf := newTestFlags("-cvmfs.nightly-repo", "dump.cern.ch", "-admin.no-email", "-global.timeout", "7")
+		out, err := dumpConfig(tf.fs, format)
+		if err != nil {
+			t.Fatalf("%s: unable to dump config: %v", format, err)
+		}
+
+		path, cleanup := writeConfigFile(t, "config."+format, out)
+		defer cleanup()
+
+		loaded := newTestFlags()
+		opts := &FileOpts{Path: path}
+		if err := opts.load(loaded.fs); err != nil {
+			t.Fatalf("%s: unable to load dumped config: %v\n%s", format, err, out)
+		}
+
+		if loaded.repo != "dump.cern.ch" || !loaded.noEmail || loaded.timeout != 7 {
+			t.Errorf("%s: dumped config did not round trip:\n%s", format, out)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	installer "github.com/brinick/atlas-rpm-installer"
+)
+
+// GCOpts are options for the gc command, which removes old nightlies
+type GCOpts struct {
+	// MaxAge is the number of days beyond which nightlies are removed
+	MaxAge int
+
+	// Keep is the number of most recent nightlies to keep per
+	// <branch>_<project>_<platform>
+	Keep int
+}
+
+func (g *GCOpts) flags() {
+	flag.IntVar(
+		&g.MaxAge,
+		"gc.max-age",
+		30,
+		"gc command: remove nightlies older than this number of days (0: no limit)",
+	)
+
+	flag.IntVar(
+		&g.Keep,
+		"gc.keep",
+		0,
+		"gc command: number of most recent nightlies to keep per "+
+			"<branch>_<project>_<platform> (0: no limit)",
+	)
+}
+
+func (g *GCOpts) validate() error {
+	if g.MaxAge < 0 {
+		return fmt.Errorf("-gc.max-age should be >= 0, got %d", g.MaxAge)
+	}
+
+	if g.Keep < 0 {
+		return fmt.Errorf("-gc.keep should be >= 0, got %d", g.Keep)
+	}
+
+	return nil
+}
+
+func (g *GCOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- GC Options:",
+			fmt.Sprintf("   - Max age: %d days", g.MaxAge),
+			fmt.Sprintf("   - Keep: %d", g.Keep),
+		},
+		"\n",
+	)
+}
+
+// Opts returns the garbage collector options
+func (g *GCOpts) Opts(installBaseDir string) *installer.GCOpts {
+	return &installer.GCOpts{
+		InstallBaseDir: installBaseDir,
+		MaxAge:         time.Duration(g.MaxAge) * 24 * time.Hour,
+		Keep:           g.Keep,
+	}
+}
+
+// validateGC checks that the gc command has something to collect
+func (c *Config) validateGC() error {
+	if c.GC.MaxAge == 0 && c.GC.Keep == 0 {
+		return fmt.Errorf("Please provide a -gc.max-age or -gc.keep limit to collect nightlies by")
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+)
+
+var (
+	historyFormats = []string{"text", "json"}
+
+	// historyDateLayout is the layout of the -history.since and -history.until dates
+	historyDateLayout = "2006-01-02"
+)
+
+// HistoryOpts are options for recording installs in the history
+// database, and for querying it with the history command
+type HistoryOpts struct {
+	// DB is the path to the history database
+	DB string
+
+	// Disabled turns off the recording of installs
+	Disabled bool
+
+	// Query options of the history command
+	Branch   string
+	Platform string
+	Project  string
+	Outcome  string
+	Since    string
+	Until    string
+	Limit    int
+	Format   string
+
+	// filter is the query filter, set on validation
+	filter *history.Filter
+}
+
+func (h *HistoryOpts) flags() {
+	flag.StringVar(
+		&h.DB,
+		"history.db",
+		"",
+		"Path to the install history database (default <dirs.work>/history.db)",
+	)
+	flag.BoolVar(&h.Disabled, "history.disabled", false, "Do not record installs in the history database")
+
+	flag.StringVar(&h.Branch, "history.branch", "", "history command: only show installs of this branch")
+	flag.StringVar(&h.Platform, "history.platform", "", "history command: only show installs of this platform")
+	flag.StringVar(&h.Project, "history.project", "", "history command: only show installs of this project")
+	flag.StringVar(
+		&h.Outcome,
+		"history.outcome",
+		"",
+		fmt.Sprintf(
+			"history command: only show installs with this outcome (one of: %s)",
+			strings.Join(history.Outcomes, ", "),
+		),
+	)
+	flag.StringVar(
+		&h.Since,
+		"history.since",
+		"",
+		"history command: only show installs started on or after this date (YYYY-MM-DD)",
+	)
+	flag.StringVar(
+		&h.Until,
+		"history.until",
+		"",
+		"history command: only show installs started before this date (YYYY-MM-DD)",
+	)
+	flag.IntVar(&h.Limit, "history.limit", 0, "history command: only show this many of the latest installs (0: all)")
+	flag.StringVar(
+		&h.Format,
+		"history.format",
+		"text",
+		fmt.Sprintf("history command: output format (one of: %s)", strings.Join(historyFormats, ", ")),
+	)
+}
+
+func (h *HistoryOpts) validate() error {
+	if h.Outcome != "" && !contains(h.Outcome, history.Outcomes) {
+		return fmt.Errorf("%s: unknown history outcome", h.Outcome)
+	}
+
+	if !contains(h.Format, historyFormats) {
+		return fmt.Errorf("%s: unknown history format", h.Format)
+	}
+
+	if h.Limit < 0 {
+		return fmt.Errorf("-history.limit should be >= 0, got %d", h.Limit)
+	}
+
+	h.filter = &history.Filter{
+		Branch:   h.Branch,
+		Platform: h.Platform,
+		Project:  h.Project,
+		Outcome:  h.Outcome,
+	}
+
+	var err error
+	if h.filter.Since, err = parseHistoryDate(h.Since); err != nil {
+		return fmt.Errorf("bad -history.since date (%w)", err)
+	}
+
+	if h.filter.Until, err = parseHistoryDate(h.Until); err != nil {
+		return fmt.Errorf("bad -history.until date (%w)", err)
+	}
+
+	return nil
+}
+
+func (h *HistoryOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- History Options:",
+			fmt.Sprintf("   - DB: %s", h.DB),
+			fmt.Sprintf("   - Disabled: %t", h.Disabled),
+		},
+		"\n",
+	)
+}
+
+// Filter returns the history command query filter
+func (h *HistoryOpts) Filter() *history.Filter {
+	return h.filter
+}
+
+// parseHistoryDate parses the local date, if not empty
+func parseHistoryDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation(historyDateLayout, date, time.Local)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	installer "github.com/brinick/atlas-rpm-installer"
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller"
 )
 
 // Add to this as required...
@@ -44,6 +45,9 @@ func (p *platforms) isValid(platform string) bool {
 type InstallOpts struct {
 	installer.Opts
 	Release string `json:""`
+
+	// PkgManager is the name of the package installer to use
+	PkgManager string
 }
 
 func (i *InstallOpts) String() string {
@@ -53,6 +57,13 @@ func (i *InstallOpts) String() string {
 			fmt.Sprintf("   - Release: %s", i.Release),
 			fmt.Sprintf("   - Project: %s", i.Project),
 			fmt.Sprintf("   - Tags file: %s", i.TagsFile),
+			fmt.Sprintf("   - Package manager: %s", i.PkgManager),
+			fmt.Sprintf(
+				"   - Verify: %t (digests: %t, max problems: %d)",
+				i.Verify,
+				i.VerifyDigests,
+				i.VerifyMaxProblems,
+			),
 		},
 		"\n",
 	)
@@ -68,18 +79,59 @@ func (i *InstallOpts) flags() {
 		"/cvmfs/atlas-nightlies.cern.ch/repo/sw/tags",
 		"Location of the tags file",
 	)
+
+	flag.StringVar(
+		&i.PkgManager,
+		"pkg-manager",
+		"ayum",
+		fmt.Sprintf(
+			"The package installer to use (one of: %s)",
+			strings.Join(pkginstaller.Names, ", "),
+		),
+	)
+
+	flag.BoolVar(
+		&i.Verify,
+		"verify",
+		false,
+		"Verify the payload files of the installed RPMs, failing the install "+
+			"if too many are missing or modified (default false)",
+	)
+
+	flag.BoolVar(
+		&i.VerifyDigests,
+		"verify-digests",
+		true,
+		"Also compare the digests of the installed files with those in the RPMs, if verifying",
+	)
+
+	flag.IntVar(
+		&i.VerifyMaxProblems,
+		"verify-max-problems",
+		0,
+		"Number of installed files not matching their RPMs tolerated, if verifying",
+	)
 }
 
-func (i *InstallOpts) validate() error {
+// parseRelease splits the release into its branch, platform and
+// timestamp, returning false if it is not of the expected form
+func (i *InstallOpts) parseRelease() bool {
 	tokens := strings.Split(i.Release, "/")
 	if len(tokens) != 3 {
+		return false
+	}
+
+	i.Branch, i.Platform, i.Timestamp = tokens[0], tokens[1], tokens[2]
+	return true
+}
+
+func (i *InstallOpts) validate() error {
+	if !i.parseRelease() {
 		msg := "-release argument expected of the form:\n"
 		msg += "   <branch>/<platform>/<timestamp>\n"
 		return fmt.Errorf(msg)
 	}
 
-	i.Branch, i.Platform, i.Timestamp = tokens[0], tokens[1], tokens[2]
-
 	if !legalPlatforms.isValid(i.Platform) {
 		return fmt.Errorf("%s: illegal platform", i.Platform)
 	}
@@ -88,6 +140,14 @@ func (i *InstallOpts) validate() error {
 		return err
 	}
 
+	if !contains(i.PkgManager, pkginstaller.Names) {
+		return fmt.Errorf("%s: unknown package manager", i.PkgManager)
+	}
+
+	if i.VerifyMaxProblems < 0 {
+		return fmt.Errorf("-verify-max-problems should be >= 0, got %d", i.VerifyMaxProblems)
+	}
+
 	project := strings.TrimSpace(i.Project)
 	if len(project) == 0 {
 		msg := "Please provide a -project option\n"
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/localfs"
 )
@@ -26,6 +27,15 @@ func (l *LocalfsOpts) flags() {
 		10,
 		"Max number of attempts to be made to open a transaction, before aborting",
 	)
+
+	retryFlags("localfs", &l.RetryOpts)
+
+	flag.BoolVar(
+		&l.Snapshot,
+		"localfs.snapshot",
+		false,
+		"Snapshot the directory the nightly is installed to beforehand, restoring it if the install fails (default false)",
+	)
 }
 
 func (l *LocalfsOpts) validate() error {
@@ -37,5 +47,19 @@ func (l *LocalfsOpts) validate() error {
 			max,
 		)
 	}
-	return nil
+
+	return validateRetry("localfs", &l.RetryOpts)
+}
+
+func (l *LocalfsOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Local FS Options:",
+			fmt.Sprintf("   - Sudo User: %s", l.SudoUser),
+			fmt.Sprintf("   - Snapshot: %t", l.Snapshot),
+			fmt.Sprintf("   - Max Open Transaction Attempts: %d", l.MaxTransactionAttempts),
+			retryString(&l.RetryOpts),
+		},
+		"\n",
+	)
 }
@@ -3,19 +3,22 @@ package config
 import (
 	"flag"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/afs"
 )
 
-// TODO: Provide support for a local configuration file
-// in order to reduce the length of the command line.
-// Priority for a variable's value is:
-// CommandLine > Config file > Flags default value
+// Commands are the installer commands, given as the first argument.
+// Without a command, the nightly, or batch of nightlies, is installed.
+var Commands = []string{"digest", "gc", "history", "watch"}
 
-// New creates a new Config instance
+// New creates a new Config instance, from the command line and the
+// config file, if any. Priority for a variable's value is:
+// CommandLine > Config file > Flags default value
 func New() (*Config, error) {
 	var c Config
-	// c.loadFromJSON()
 	c.instantiate()
 	c.flags()
 	err := c.parse()
@@ -24,16 +27,30 @@ func New() (*Config, error) {
 
 // Config is the full set of available command line args
 type Config struct {
+	// Command is the command to run, if any
+	Command string
+
 	Admin   *AdminOpts
 	Ayum    *AyumOpts
+	Batch   *BatchOpts
+	Dnf     *DnfOpts
 	AFS     *AfsOpts
 	CVMFS   *CvmfsOpts
 	LocalFS *LocalfsOpts
+	Overlay *OverlayOpts
 	Dirs    *DirsOpts
+	DryRun  *DryRunOpts
 	EOS     *EosOpts
+	File    *FileOpts
+	GC      *GCOpts
 	Global  *GlobalOpts
+	History *HistoryOpts
 	Install *InstallOpts
 	Logging *LoggingOpts
+	Watch   *WatchOpts
+
+	// nightlies are the nightlies to install, set on validation
+	nightlies []*Nightly
 }
 
 // String returns the config as a string representation
@@ -43,11 +60,21 @@ func (c *Config) String() string {
 			fmt.Sprintf("%s", c.Global),
 			fmt.Sprintf("%s", c.Admin),
 			fmt.Sprintf("%s", c.Ayum),
+			fmt.Sprintf("%s", c.Batch),
+			fmt.Sprintf("%s", c.Dnf),
 			fmt.Sprintf("%s", c.CVMFS),
+			fmt.Sprintf("%s", c.AFS),
+			fmt.Sprintf("%s", c.LocalFS),
+			fmt.Sprintf("%s", c.Overlay),
 			fmt.Sprintf("%s", c.Dirs),
+			fmt.Sprintf("%s", c.DryRun),
 			fmt.Sprintf("%s", c.EOS),
+			fmt.Sprintf("%s", c.File),
+			fmt.Sprintf("%s", c.GC),
+			fmt.Sprintf("%s", c.History),
 			fmt.Sprintf("%s", c.Install),
 			fmt.Sprintf("%s", c.Logging),
+			fmt.Sprintf("%s", c.Watch),
 		},
 		"\n",
 	) + "\n"
@@ -56,46 +83,96 @@ func (c *Config) String() string {
 // parse parses and validates the command line,
 // returning an error if appropriate.
 func (c *Config) parse() error {
-	flag.Parse()
-	c.postConfig()
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		c.Command, args = args[0], args[1:]
+		if !contains(c.Command, Commands) {
+			return fmt.Errorf("%s: unknown command (one of: %s)", c.Command, strings.Join(Commands, ", "))
+		}
+	}
+
+	flag.CommandLine.Parse(args)
+	if err := c.File.load(flag.CommandLine); err != nil {
+		return err
+	}
+
+	if err := c.postConfig(); err != nil {
+		return err
+	}
+
+	// The config is dumped as is, even if incomplete
+	if c.File.Dump {
+		return nil
+	}
+
 	return c.validate()
 }
 
+// Dump returns the effective configuration, in the config file format
+func (c *Config) Dump() (string, error) {
+	return dumpConfig(flag.CommandLine, c.File.Format)
+}
+
 // instantiate initialises the config member structs
 func (c *Config) instantiate() {
 	c.Admin = &AdminOpts{}
 	c.Ayum = &AyumOpts{}
+	c.Batch = &BatchOpts{}
+	c.Dnf = &DnfOpts{}
 	c.CVMFS = &CvmfsOpts{}
 	c.AFS = &AfsOpts{}
 	c.LocalFS = &LocalfsOpts{}
+	c.Overlay = &OverlayOpts{}
 	c.Dirs = &DirsOpts{}
+	c.DryRun = &DryRunOpts{}
 	c.EOS = &EosOpts{}
+	c.File = &FileOpts{}
+	c.GC = &GCOpts{}
 	c.Global = &GlobalOpts{}
+	c.History = &HistoryOpts{}
 	c.Install = &InstallOpts{}
 	c.Logging = &LoggingOpts{}
+	c.Watch = &WatchOpts{}
 }
 
 // flags defines the CLI flags for this configuration
 func (c *Config) flags() {
 	c.Admin.flags()
 	c.Ayum.flags()
+	c.Batch.flags()
+	c.Dnf.flags()
 	c.CVMFS.flags()
 	c.AFS.flags()
 	c.LocalFS.flags()
+	c.Overlay.flags()
 	c.Dirs.flags()
+	c.DryRun.flags()
 	c.EOS.flags()
+	c.File.flags()
+	c.GC.flags()
 	c.Global.flags()
+	c.History.flags()
 	c.Install.flags()
 	c.Logging.flags()
+	c.Watch.flags()
 }
 
 // postConfig adapts some variables that depend on others
 func (c *Config) postConfig() error {
+	// The branch is needed below, before validation
+	c.Install.parseRelease()
+
 	if c.Dirs.InstallBase == "" {
 		// Nothing was given, so we define the base install dir on CVMFS
 		c.Dirs.InstallBase = fmt.Sprintf("/cvmfs/%s/repo/sw", c.CVMFS.NightlyRepo)
 	}
 
+	// AFS volumes are written through their read-write path,
+	// and only published to the read-only one on release
+	if c.AFS.ReadWrite {
+		c.Dirs.InstallBase = afs.ReadWritePath(c.Dirs.InstallBase)
+	}
+
 	if c.Dirs.RPMSrcBase == "" {
 		// Note that Install.Release = branch/platform/datetime
 		c.Dirs.RPMSrcBase = filepath.Join(c.EOS.NightlyBaseDir, c.Install.Release)
@@ -105,14 +182,64 @@ func (c *Config) postConfig() error {
 		c.Ayum.InstallDir = filepath.Join(c.Dirs.InstallBase, c.Install.Branch)
 	}
 
+	// Monitoring needs the ayum metrics to be encoded
+	if c.Admin.Monitor && c.Ayum.MonitoringFormat == "" {
+		c.Ayum.MonitoringFormat = "statsd"
+	}
+
 	if c.Ayum.AyumDir == "" {
 		c.Ayum.AyumDir = c.Dirs.WorkBase
 	}
 
+	if c.Dnf.InstallDir == "" {
+		c.Dnf.InstallDir = filepath.Join(c.Dirs.InstallBase, c.Install.Branch)
+	}
+
+	if c.Dnf.WorkDir == "" {
+		c.Dnf.WorkDir = filepath.Join(c.Dirs.WorkBase, "dnf")
+	}
+
 	if err := c.ensureAbsPaths(); err != nil {
 		return err
 	}
 
+	if c.AFS.Path == "" {
+		c.AFS.Path = c.Dirs.InstallBase
+	}
+
+	c.Overlay.Lower = c.Dirs.InstallBase
+	if c.Overlay.WorkDir == "" {
+		c.Overlay.WorkDir = filepath.Join(c.Dirs.WorkBase, "overlay")
+	}
+
+	if c.History.DB == "" {
+		c.History.DB = filepath.Join(c.Dirs.WorkBase, "history.db")
+	}
+
+	if c.CVMFS.GatewayURL == "" {
+		c.CVMFS.GatewayURL = fmt.Sprintf("http://%s:4929/api/v1", c.CVMFS.ReleaseManager)
+	}
+
+	if c.CVMFS.GatewayKeyFile == "" {
+		c.CVMFS.GatewayKeyFile = filepath.Join("/etc/cvmfs/keys", c.CVMFS.NightlyRepo+".gw")
+	}
+
+	if c.CVMFS.LeaseFile == "" {
+		c.CVMFS.LeaseFile = filepath.Join(c.Dirs.WorkBase, "cvmfs", c.CVMFS.NightlyRepo+".lease")
+	}
+
+	if c.Admin.DigestStateFile == "" {
+		c.Admin.DigestStateFile = filepath.Join(c.Dirs.WorkBase, "digest", "last")
+	}
+
+	if c.Watch.StateFile == "" {
+		c.Watch.StateFile = filepath.Join(c.Dirs.WorkBase, "watch", "installed.json")
+	}
+
+	c.Install.InstallBaseDir = c.Dirs.InstallBase
+	c.Install.WorkBaseDir = c.Dirs.WorkBase
+	c.Install.StableReleasesDir = c.Dirs.StableRelsDir
+
 	// The logs directory should sit in the work base directory,
 	// so we ensure that here
 	c.Dirs.Logs = filepath.Join(c.Dirs.WorkBase, "logs")
@@ -131,6 +258,11 @@ func (c *Config) ensureAbsPaths() error {
 	if err != nil {
 		return err
 	}
+	c.Dnf.InstallDir, err = filepath.Abs(c.Dnf.InstallDir)
+	if err != nil {
+		return err
+	}
+
 	c.Dirs.RPMSrcBase, err = filepath.Abs(c.Dirs.RPMSrcBase)
 	if err != nil {
 		return err
@@ -150,13 +282,22 @@ func (c *Config) validate() error {
 	for _, fn := range []validateFn{
 		c.Admin.validate,
 		c.Ayum.validate,
+		c.Batch.validate,
+		c.Dnf.validate,
 		c.CVMFS.validate,
 		c.AFS.validate,
 		c.LocalFS.validate,
+		c.Overlay.validate,
 		c.Dirs.validate,
+		c.DryRun.validate,
 		c.EOS.validate,
+		c.File.validate,
+		c.GC.validate,
 		c.Global.validate,
-		c.Install.validate,
+		c.History.validate,
+		c.Watch.validate,
+		c.validateDigest,
+		c.validateCommand,
 	} {
 		if err := fn(); err != nil {
 			return err
@@ -165,3 +306,27 @@ func (c *Config) validate() error {
 
 	return nil
 }
+
+// validateDigest checks the install history, from which
+// the digest is made, is recorded if in digest mode
+func (c *Config) validateDigest() error {
+	if c.Admin.Digest && c.History.Disabled {
+		return fmt.Errorf("-admin.digest requires the install history, but -history.disabled is set")
+	}
+
+	return nil
+}
+
+// validateCommand validates the options specific to the command
+func (c *Config) validateCommand() error {
+	switch c.Command {
+	case "gc":
+		return c.validateGC()
+	case "digest", "history":
+		return nil
+	case "watch":
+		return c.validateWatch()
+	default:
+		return c.validateNightlies()
+	}
+}
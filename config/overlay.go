@@ -0,0 +1,120 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/overlay"
+)
+
+// OverlayOpts are options for installing through an overlay, on local disks
+type OverlayOpts struct {
+	overlay.Opts
+
+	// Paths are the comma-separated install base dirs,
+	// or their parents, installed to through an overlay
+	Paths string
+}
+
+func (o *OverlayOpts) flags() {
+	flag.StringVar(
+		&o.Paths,
+		"overlay.paths",
+		"",
+		"Comma-separated list of install base dirs, or their parents, "+
+			"installed to through an overlay (default none)",
+	)
+
+	flag.StringVar(
+		&o.Mode,
+		"overlay.mode",
+		overlay.ModeKernel,
+		fmt.Sprintf(
+			"How the overlay is made: %s overlay, %s-overlayfs, or a %s of the dir "+
+				"where neither can be mounted",
+			overlay.ModeKernel,
+			overlay.ModeFuse,
+			overlay.ModeCopy,
+		),
+	)
+
+	flag.StringVar(
+		&o.SudoUser,
+		"overlay.sudo-user",
+		"",
+		"The sudo user, if any, required to mount the overlay (default none)",
+	)
+
+	flag.StringVar(
+		&o.FuseBinary,
+		"overlay.fuse-exe",
+		"/usr/bin/fuse-overlayfs",
+		"Path to the fuse-overlayfs executable",
+	)
+
+	flag.StringVar(
+		&o.WorkDir,
+		"overlay.work-dir",
+		"",
+		"Directory holding the overlay upper layer (default <dirs.work>/overlay)",
+	)
+
+	flag.IntVar(
+		&o.MaxTransactionAttempts,
+		"overlay.max-transaction-attempts",
+		10,
+		"Max number of attempts to be made to open a transaction, before aborting",
+	)
+
+	retryFlags("overlay", &o.RetryOpts)
+}
+
+func (o *OverlayOpts) validate() error {
+	var min, max = 1, 10
+	if o.MaxTransactionAttempts < min || o.MaxTransactionAttempts > max {
+		return fmt.Errorf(
+			"Max attempts to open an overlay transaction must be in range %d-%d",
+			min,
+			max,
+		)
+	}
+
+	if !contains(o.Mode, overlay.Modes) {
+		return fmt.Errorf(
+			"Unknown overlay mode %s, must be one of: %s",
+			o.Mode,
+			strings.Join(overlay.Modes, ", "),
+		)
+	}
+
+	return validateRetry("overlay", &o.RetryOpts)
+}
+
+// Selects reports if the install base dir is installed to through an overlay
+func (o *OverlayOpts) Selects(is func(string) bool) bool {
+	for _, path := range strings.Split(o.Paths, ",") {
+		if path = strings.TrimSpace(path); path != "" && is(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *OverlayOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Overlay Options:",
+			fmt.Sprintf("   - Paths: %s", o.Paths),
+			fmt.Sprintf("   - Mode: %s", o.Mode),
+			fmt.Sprintf("   - Sudo User: %s", o.SudoUser),
+			fmt.Sprintf("   - fuse-overlayfs Binary: %s", o.FuseBinary),
+			fmt.Sprintf("   - Lower Dir: %s", o.Lower),
+			fmt.Sprintf("   - Work Dir: %s", o.WorkDir),
+			fmt.Sprintf("   - Max Open Transaction Attempts: %d", o.MaxTransactionAttempts),
+			retryString(&o.RetryOpts),
+		},
+		"\n",
+	)
+}
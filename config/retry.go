@@ -0,0 +1,73 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+)
+
+// retryFlags defines the flags of the transaction retry policy
+// of the file system with the given flag prefix
+func retryFlags(prefix string, r *filesystem.RetryOpts) {
+	flag.IntVar(
+		&r.InitialDelay,
+		prefix+".retry-initial-delay",
+		10,
+		"Number of seconds to wait before retrying to open a transaction",
+	)
+
+	flag.Float64Var(
+		&r.Multiplier,
+		prefix+".retry-multiplier",
+		2,
+		"Factor by which the wait increases after each attempt to open a transaction",
+	)
+
+	flag.Float64Var(
+		&r.Jitter,
+		prefix+".retry-jitter",
+		0.2,
+		"Fraction, in range 0-1, by which each wait randomly varies",
+	)
+
+	flag.IntVar(
+		&r.MaxDelay,
+		prefix+".retry-max-delay",
+		300,
+		"Max number of seconds to wait between attempts to open a transaction (0: no max)",
+	)
+
+	flag.IntVar(
+		&r.MaxElapsed,
+		prefix+".retry-max-elapsed",
+		0,
+		"Number of seconds after which to stop retrying to open a transaction (default 0 i.e. no limit)",
+	)
+}
+
+// validateRetry validates the transaction retry policy
+func validateRetry(prefix string, r *filesystem.RetryOpts) error {
+	switch {
+	case r.InitialDelay < 0 || r.MaxDelay < 0 || r.MaxElapsed < 0:
+		return fmt.Errorf("-%s.retry-* delays should be >= 0", prefix)
+	case r.Multiplier < 1:
+		return fmt.Errorf("-%s.retry-multiplier should be >= 1, got %g", prefix, r.Multiplier)
+	case r.Jitter < 0 || r.Jitter > 1:
+		return fmt.Errorf("-%s.retry-jitter must be in range 0-1, got %g", prefix, r.Jitter)
+	}
+
+	return nil
+}
+
+// retryString returns the retry policy as a string
+func retryString(r *filesystem.RetryOpts) string {
+	return fmt.Sprintf(
+		"   - Retry: initial delay %ds, multiplier %g, jitter %g, max delay %ds, max elapsed %ds",
+		r.InitialDelay,
+		r.Multiplier,
+		r.Jitter,
+		r.MaxDelay,
+		r.MaxElapsed,
+	)
+}
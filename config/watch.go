@@ -0,0 +1,78 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller"
+)
+
+// WatchOpts are options for the watch command, which polls the
+// nightly base directory and installs each new nightly of the project
+type WatchOpts struct {
+	// Interval is the number of seconds between polls
+	Interval int
+
+	// StateFile records the nightlies already installed, so that
+	// they are not installed again when the watcher is restarted
+	StateFile string
+}
+
+func (w *WatchOpts) flags() {
+	flag.IntVar(
+		&w.Interval,
+		"watch.interval",
+		300,
+		"Number of seconds between polls of the nightly base directory for new nightlies",
+	)
+
+	flag.StringVar(
+		&w.StateFile,
+		"watch.state-file",
+		"",
+		"File recording the nightlies already installed by the watcher "+
+			"(default <dirs.work>/watch/installed.json)",
+	)
+}
+
+func (w *WatchOpts) validate() error {
+	if w.Interval <= 0 {
+		return fmt.Errorf("-watch.interval should be > 0, got %d", w.Interval)
+	}
+
+	return nil
+}
+
+func (w *WatchOpts) String() string {
+	return strings.Join(
+		[]string{
+			"- Watch Options:",
+			fmt.Sprintf("   - Interval: %ds", w.Interval),
+			fmt.Sprintf("   - State file: %s", w.StateFile),
+		},
+		"\n",
+	)
+}
+
+// ------------------------------------------------------------------
+
+// Nightly returns the options for installing the nightly of the project
+// in the given release, deriving its directories as for batch nightlies
+func (c *Config) Nightly(release, project string) (*Nightly, error) {
+	return c.batchNightly(release + "/" + project)
+}
+
+// validateWatch validates the options needed by the watch command,
+// which is given the project to install, but not the release
+func (c *Config) validateWatch() error {
+	if len(strings.TrimSpace(c.Install.Project)) == 0 {
+		return fmt.Errorf("Please provide the -project option to watch for")
+	}
+
+	if !contains(c.Install.PkgManager, pkginstaller.Names) {
+		return fmt.Errorf("%s: unknown package manager", c.Install.PkgManager)
+	}
+
+	return nil
+}
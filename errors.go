@@ -18,6 +18,11 @@ func (r RPMFinderError) Error() string {
 
 }
 
+// Unwrap returns the underlying error, e.g. listing the RPMs failing their checks
+func (r RPMFinderError) Unwrap() error {
+	return r.err
+}
+
 // ---------------------------------------------------------------------
 
 // NewMultiError returns a MultiError, a wrapper for more than one error
@@ -38,7 +43,7 @@ func (m MultiError) Error() string {
 	return strings.Join(out, "\n")
 }
 
-func (m MultiError) add(e error) {
+func (m *MultiError) add(e error) {
 	if e != nil {
 		m.errs = append(m.errs, e)
 	}
@@ -86,6 +91,12 @@ func (t TransactionError) Error() string {
 	return fmt.Sprintf("%v", t.err)
 }
 
+// Unwrap returns the underlying error, e.g. to find why the
+// transaction could not be opened
+func (t TransactionError) Unwrap() error {
+	return t.err
+}
+
 // NewTransactionOpenError returns a TransactionOpenError
 func NewTransactionOpenError(e error) TransactionOpenError {
 	return TransactionOpenError{
@@ -152,3 +163,33 @@ func (p PkgManagerCopyLogError) Error() string {
 }
 
 // ---------------------------------------------------------------------
+
+// TimelineWriteError represents an error writing the install timeline report
+type TimelineWriteError struct {
+	msg string
+}
+
+func (t TimelineWriteError) Error() string {
+	return t.msg
+}
+
+// ---------------------------------------------------------------------
+
+// VerifyError represents too many installed RPM payload files
+// not matching their RPM headers
+type VerifyError struct {
+	Problems    int
+	MaxProblems int
+	Report      string
+}
+
+func (v VerifyError) Error() string {
+	return fmt.Sprintf(
+		"%d installed files do not match their RPMs, more than the %d allowed (see %s)",
+		v.Problems,
+		v.MaxProblems,
+		v.Report,
+	)
+}
+
+// ---------------------------------------------------------------------
@@ -0,0 +1,275 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
+	"github.com/brinick/fs"
+	"github.com/brinick/logging"
+)
+
+// KeepFile marks a nightly install directory that is never garbage collected
+const KeepFile = ".keep"
+
+// timestampLayout is the layout of nightly timestamps
+const timestampLayout = "2006-01-02T1504"
+
+type tagsEditor interface {
+	Load() error
+	GetEntries() *tagsfile.Entries
+	Remove(...string) error
+	Save() error
+}
+
+// GCOpts configures the garbage collection of old nightlies
+type GCOpts struct {
+	// Base directory below which nightlies are installed
+	InstallBaseDir string
+
+	// MaxAge is the age beyond which nightlies are removed, if > 0
+	MaxAge time.Duration
+
+	// Keep is the number of most recent nightlies to keep
+	// for each <branch>_<project>_<platform>, if > 0
+	Keep int
+}
+
+// ---------------------------------------------------------------------
+
+// ExpiredNightly is a nightly install directory to garbage collect
+type ExpiredNightly struct {
+	// NightlyID is the <branch>_<project>_<platform> of the nightly
+	NightlyID string
+	Timestamp string
+
+	// Dir is the <InstallBaseDir>/<NightlyID>/<timestamp> directory
+	Dir string
+
+	// Projects are the project directories of the nightly,
+	// each of which has an entry in the tags file
+	Projects []string
+}
+
+// tagsLines returns the tags file lines of the nightly. As both branches
+// and platforms may contain underscores, the nightly ID is not split up,
+// but matched against each entry.
+func (e *ExpiredNightly) tagsLines(entries *tagsfile.Entries) []string {
+	var lines []string
+	for _, entry := range *entries {
+		if entry.Datetime == e.Timestamp &&
+			strings.HasPrefix(e.NightlyID, entry.Branch+"_") &&
+			strings.HasSuffix(e.NightlyID, "_"+entry.Platform) &&
+			contains(entry.Project, e.Projects) {
+			lines = append(lines, entry.String())
+		}
+	}
+
+	return lines
+}
+
+// ---------------------------------------------------------------------
+
+// NewCollector returns a garbage collector of old nightlies
+func NewCollector(
+	opts *GCOpts,
+	t filesystem.Transactioner,
+	tags tagsEditor,
+	log logging.Logger,
+) *Collector {
+	return &Collector{
+		opts:        opts,
+		transaction: t,
+		tags:        tags,
+		log:         log,
+	}
+}
+
+// Collector removes, within a file system transaction, the nightly install
+// directories that are too old, or beyond the number to keep, along with
+// their tags file entries. Directories containing a .keep file are never
+// removed, nor counted amongst those to keep.
+type Collector struct {
+	opts        *GCOpts
+	transaction filesystem.Transactioner
+	tags        tagsEditor
+	log         logging.Logger
+}
+
+// Expired returns the nightlies to remove
+func (c *Collector) Expired() ([]*ExpiredNightly, error) {
+	dirs, err := filepath.Glob(filepath.Join(c.opts.InstallBaseDir, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Nightlies of each <branch>_<project>_<platform>, newest first
+	var (
+		nightlies = map[string][]*ExpiredNightly{}
+		now       = time.Now()
+		expired   []*ExpiredNightly
+	)
+
+	for _, dir := range dirs {
+		n := parseNightlyDir(dir)
+		if n == nil || isKept(dir) {
+			continue
+		}
+
+		nightlies[n.NightlyID] = append(nightlies[n.NightlyID], n)
+	}
+
+	for _, ns := range nightlies {
+		sort.Slice(ns, func(i, j int) bool { return ns[i].Timestamp > ns[j].Timestamp })
+
+		for i, n := range ns {
+			stamp, _ := time.ParseInLocation(timestampLayout, n.Timestamp, time.Local)
+			tooOld := c.opts.MaxAge > 0 && now.Sub(stamp) > c.opts.MaxAge
+			tooMany := c.opts.Keep > 0 && i >= c.opts.Keep
+			if !tooOld && !tooMany {
+				continue
+			}
+
+			if n.Projects, err = subDirs(n.Dir); err != nil {
+				return nil, err
+			}
+
+			expired = append(expired, n)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Dir < expired[j].Dir })
+	return expired, nil
+}
+
+// Execute removes the expired nightlies, and their tags file entries,
+// in a single transaction that is aborted if anything fails.
+// It returns the removed nightlies.
+func (c *Collector) Execute(ctx context.Context) ([]*ExpiredNightly, error) {
+	expired, err := c.Expired()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list expired nightlies (%w)", err)
+	}
+
+	if len(expired) == 0 {
+		c.log.Info("No nightlies to garbage collect")
+		return nil, nil
+	}
+
+	if err := openTransaction(ctx, c.transaction, c.log); err != nil {
+		return nil, NewTransactionOpenError(err)
+	}
+
+	if err := c.remove(ctx, expired); err != nil {
+		if abortErr := c.transaction.Kill(ctx); abortErr != nil {
+			return nil, NewMultiError(err, NewTransactionAbortError(abortErr))
+		}
+
+		return nil, err
+	}
+
+	if err := c.transaction.Close(ctx); err != nil {
+		return nil, NewTransactionCloseError(err)
+	}
+
+	return expired, nil
+}
+
+// remove deletes the nightly directories, and their tags file entries
+func (c *Collector) remove(ctx context.Context, expired []*ExpiredNightly) error {
+	if err := c.tags.Load(); err != nil {
+		return fmt.Errorf("unable to load the tags file (%w)", err)
+	}
+
+	var lines []string
+	for _, n := range expired {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c.log.Info("Removing nightly", logging.F("dir", n.Dir))
+		if err := fs.Dirs(n.Dir).Remove(); err != nil {
+			return fmt.Errorf("unable to remove nightly %s (%w)", n.Dir, err)
+		}
+
+		lines = append(lines, n.tagsLines(c.tags.GetEntries())...)
+	}
+
+	if err := c.tags.Remove(lines...); err != nil {
+		return err
+	}
+
+	if err := c.tags.Save(); err != nil {
+		return fmt.Errorf("unable to save the tags file (%w)", err)
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------------------------
+
+// parseNightlyDir returns the nightly of the given
+// <InstallBaseDir>/<branch>_<project>_<platform>/<timestamp>
+// directory, or nil if it is not a nightly install directory
+func parseNightlyDir(dir string) *ExpiredNightly {
+	timestamp := filepath.Base(dir)
+	if _, err := time.ParseInLocation(timestampLayout, timestamp, time.Local); err != nil {
+		return nil
+	}
+
+	// The nightly ID is of the form <branch>_<project>_<platform>
+	id := filepath.Base(filepath.Dir(dir))
+	if strings.Count(id, "_") < 2 {
+		return nil
+	}
+
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	return &ExpiredNightly{
+		NightlyID: id,
+		Timestamp: timestamp,
+		Dir:       dir,
+	}
+}
+
+// isKept indicates if the directory contains a .keep file
+func isKept(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, KeepFile))
+	return err == nil
+}
+
+// subDirs returns the names of the sub-directories of dir
+func subDirs(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func contains(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
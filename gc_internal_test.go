@@ -0,0 +1,101 @@
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
+	"github.com/brinick/logging"
+)
+
+// fakeTagsEditor removes entries in memory
+type fakeTagsEditor struct {
+	entries tagsfile.Entries
+	saved   bool
+}
+
+func (f *fakeTagsEditor) Load() error                   { return nil }
+func (f *fakeTagsEditor) GetEntries() *tagsfile.Entries { return &f.entries }
+func (f *fakeTagsEditor) Save() error                   { f.saved = true; return nil }
+
+func (f *fakeTagsEditor) Remove(values ...string) error {
+	f.entries.Remove(values)
+	return nil
+}
+
+func TestCollectorRemovesExpiredNightlies(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "gc.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basedir)
+
+	platform := "x86_64-centos7-gcc8-opt"
+	nightlyDir := filepath.Join(basedir, "master_AthSimulation_"+platform)
+	tags := &fakeTagsEditor{}
+
+	stamps := map[string]string{}
+	for name, age := range map[string]time.Duration{
+		"old":    40 * 24 * time.Hour,
+		"kept":   50 * 24 * time.Hour,
+		"newest": time.Hour,
+		"newer":  2 * time.Hour,
+		"new":    3 * time.Hour,
+	} {
+		stamp := time.Now().Add(-age).Format(timestampLayout)
+		stamps[name] = stamp
+		if err := os.MkdirAll(filepath.Join(nightlyDir, stamp, "AthSimulation"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		tags.entries.Add(&tagsfile.Entry{
+			Label:    "VO-atlas-nightly",
+			Branch:   "master",
+			Datetime: stamp,
+			Project:  "AthSimulation",
+			NextRel:  "22.0.1",
+			Platform: platform,
+		})
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(nightlyDir, stamps["kept"], KeepFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &fakeTransaction{}
+	c := NewCollector(
+		&GCOpts{InstallBaseDir: basedir, MaxAge: 30 * 24 * time.Hour, Keep: 2},
+		tx,
+		tags,
+		logging.NullLogger{},
+	)
+
+	removed, err := c.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("unable to garbage collect: %v", err)
+	}
+
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 nightlies to be removed, got %d", len(removed))
+	}
+
+	for name, stamp := range stamps {
+		_, err := os.Stat(filepath.Join(nightlyDir, stamp))
+		exists := err == nil
+		if expect := name != "old" && name != "new"; exists != expect {
+			t.Errorf("%s nightly: expected it to exist=%t, got %t", name, expect, exists)
+		}
+	}
+
+	if len(tags.entries) != 3 || !tags.saved {
+		t.Errorf("expected 3 tags file entries to be saved, got %d", len(tags.entries))
+	}
+
+	if tx.opened != 1 || tx.closed != 1 {
+		t.Errorf("expected the transaction to be opened and closed, got opened=%d closed=%d", tx.opened, tx.closed)
+	}
+}
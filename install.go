@@ -8,9 +8,11 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
 	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
 	"github.com/brinick/atlas-rpm-installer/pkg/tagsfile"
 	"github.com/brinick/fs"
@@ -35,6 +37,7 @@ type cleaner interface {
 
 type installer interface {
 	Install(context.Context, ...string) error
+	Classify(context.Context, ...string) ([]string, []string, error)
 }
 
 type rpmRepoAdder interface {
@@ -61,6 +64,12 @@ type rpmFinder interface {
 	SrcDir() string
 }
 
+// waiter is implemented by RPM finders able to wait
+// for the nightly RPMs to be fully copied
+type waiter interface {
+	Wait(ctx context.Context, project, platform string) (time.Duration, error)
+}
+
 type tagsFiler interface {
 	Src() *fs.File
 	Remove(...string) error
@@ -89,6 +98,16 @@ type Opts struct {
 
 	// TagsFile is the path to the tags file
 	TagsFile string `json:"tagsfile"`
+
+	// PkgInstallDir is the directory to which the package
+	// manager installs itself, and writes its database
+	PkgInstallDir string `json:"pkg_install_dir"`
+
+	// Verify the payload of the installed RPMs, optionally with digests,
+	// failing the install if more than VerifyMaxProblems files are wrong
+	Verify            bool `json:"verify"`
+	VerifyDigests     bool `json:"verify_digests"`
+	VerifyMaxProblems int  `json:"verify_max_problems"`
 }
 
 func (o *Opts) String() string {
@@ -122,6 +141,7 @@ func New(
 		tags:        tags,
 		doneChan:    make(chan struct{}),
 		err:         &Errors{},
+		record:      &history.Entry{},
 	}
 }
 
@@ -156,8 +176,16 @@ type Installer struct {
 	log         logging.Logger
 	tags        tagsFiler
 	aborted     bool
+	started     bool
 	doneChan    chan struct{}
+	doneOnce    sync.Once
 	err         *Errors
+
+	// record is the install history entry
+	record *history.Entry
+
+	// verification reports the verification of the installed RPMs
+	verification *rpm.Verification
 }
 
 // IsError indicates if any errors have occured
@@ -183,16 +211,32 @@ func (inst *Installer) Aborted() bool {
 
 // Execute will perform the install
 func (inst *Installer) Execute(ctx context.Context) {
+	inst.begin()
+	transaction := history.TransactionOpenFailed
+
 	defer func() {
 		if r := recover(); r != nil {
 			inst.log.Info("Recovered from panic", logging.F("err", r))
 			inst.err.Append(PanicRecoverError{fmt.Sprintf("%v", r)})
 		}
+		inst.finish(transaction)
 		inst.setDone()
 	}()
 
+	// Wait for the nightly before holding the transaction
+	if err := inst.waitNightly(ctx); err != nil {
+		inst.err.Append(err)
+		inst.aborted = true
+		transaction = history.TransactionNotOpened
+		return
+	}
+
 	// Open the file transaction
-	if err := inst.openTransaction(ctx); err != nil {
+	err := inst.timePhase("transaction-open", func() error {
+		return inst.openTransaction(ctx)
+	})
+
+	if err != nil {
 		inst.err.Append(NewTransactionOpenError(err))
 		inst.aborted = true
 		return
@@ -201,45 +245,96 @@ func (inst *Installer) Execute(ctx context.Context) {
 	// Ensure we close the transaction whatever happens
 	defer func() {
 		inst.err.Append(inst.copyPkgManagerLog())
-		inst.endTransaction(ctx)
+		inst.err.Append(inst.writeTimeline())
+		transaction = inst.endTransaction(ctx)
 	}()
 
+	inst.err.Append(inst.run(ctx))
+}
+
+// run performs the install, within an already opened transaction,
+// and waits for either the install or the context to be done.
+func (inst *Installer) run(ctx context.Context) error {
+	done := make(chan error, 1)
+
 	// Launch the install in the background
 	go func() {
-		defer inst.setDone()
-		if err := inst.doInstall(ctx); err != nil {
-			inst.err.Append(err)
-		}
+		done <- inst.doInstall(ctx)
 	}()
 
-	// Wait for either the install or the context to be done
 	select {
-	case <-inst.Done():
+	case err := <-done:
 		// we're done here, let's go home
+		return err
 	case <-ctx.Done():
 		inst.aborted = true
-		<-inst.Done()
+		return <-done
+	}
+}
+
+// failedMidway indicates if the install failed once it had started
+// installing RPMs, possibly leaving a partial install behind
+func (inst *Installer) failedMidway() bool {
+	return inst.started && inst.failed()
+}
+
+// failed indicates if the install failed: any error other than
+// failing to copy the package manager log, or to write the timeline
+func (inst *Installer) failed() bool {
+	var (
+		copyLogErr  PkgManagerCopyLogError
+		timelineErr TimelineWriteError
+	)
+
+	for _, err := range *inst.err {
+		if !errors.As(err, &copyLogErr) && !errors.As(err, &timelineErr) {
+			return true
+		}
 	}
+
+	return false
 }
 
-func (inst *Installer) endTransaction(ctx context.Context) {
-	// TODO: how to check if the transaction is still open at the end, which
-	// will mess with future installation attempts.
+// endTransaction closes, or aborts if the install failed, the
+// transaction, returning how it ended for the install history
+func (inst *Installer) endTransaction(ctx context.Context) string {
+	// A transaction left open, e.g. if we crash before the end, is
+	// detected, and if stale recovered, by the next transaction opened
 
 	// Should we end by abort, or by normal close?
-	shouldAbort := inst.IsError() &&
-		!(len(*inst.err) == 1 && errors.Is((*inst.err)[0], PkgManagerCopyLogError{}))
+	if inst.failed() {
+		err := inst.timePhase("transaction-abort", func() error {
+			return inst.abortTransaction(ctx)
+		})
 
-	switch shouldAbort {
-	case true:
-		if err := inst.abortTransaction(ctx); err != nil {
+		if err != nil {
 			inst.err.Append(NewTransactionAbortError(err))
+			return history.TransactionAbortFailed
 		}
-	case false:
-		if err := inst.closeTransaction(ctx); err != nil {
-			inst.err.Append(NewTransactionCloseError(err))
-		}
+
+		return history.TransactionAborted
 	}
+
+	err := inst.timePhase("transaction-close", func() error {
+		return inst.closeTransaction(ctx)
+	})
+
+	if err != nil {
+		inst.err.Append(NewTransactionCloseError(err))
+		return history.TransactionCloseFailed
+	}
+
+	return history.TransactionClosed
+}
+
+// Opts returns the options of the install
+func (inst *Installer) Opts() *Opts {
+	return inst.opts
+}
+
+// PkgManagerLog returns the path of the package manager log
+func (inst *Installer) PkgManagerLog() string {
+	return inst.pkg.Log().Path()
 }
 
 // NightlyID returns a string that identifies this given nightly branch
@@ -288,25 +383,37 @@ func (inst *Installer) copyPkgManagerLog() error {
 }
 
 func (inst *Installer) setDone() {
-	// Close of a closed channel panics, hence this check in case we
-	// already called this function previously
-	_, isOpen := <-inst.doneChan
-	if isOpen {
+	// Close of a closed channel panics, hence the once
+	inst.doneOnce.Do(func() {
 		close(inst.doneChan)
-	}
+	})
 }
 
-func (inst *Installer) getRPMsList() ([]*rpm.RPMs, error) {
+// getRPMsList returns the RPMs to install, split per package manager
+// install, and the requirements that no RPM in the source directory
+// provides, left to the package manager's remote repositories
+func (inst *Installer) getRPMsList() ([]*rpm.RPMs, []rpm.Unresolved, error) {
+	var unresolved rpm.UnresolvedError
 	rpms, err := inst.rpms.Find(inst.opts.Project, inst.opts.Platform)
-	if err != nil {
-		return nil, err
+	if err != nil && !errors.As(err, &unresolved) {
+		return nil, nil, err
+	}
+
+	if n := len(unresolved.Unresolved); n > 0 {
+		var lines []string
+		for _, u := range unresolved.Unresolved {
+			lines = append(lines, u.String())
+		}
+
+		inst.log.Info("Requirements left to the remote repositories", logging.F("n", n))
+		inst.log.InfoL(lines)
 	}
 
 	if inst.isCacheNightly() {
-		return []*rpm.RPMs{rpms}, nil
+		return []*rpm.RPMs{rpms}, unresolved.Unresolved, nil
 	}
 
-	return inst.splitRPMsList(rpms), nil
+	return inst.splitRPMsList(rpms), unresolved.Unresolved, nil
 }
 
 func (inst *Installer) isCacheNightly() bool {
@@ -338,23 +445,45 @@ func (inst *Installer) splitRPMsList(rpms *rpm.RPMs) []*rpm.RPMs {
 
 func (inst *Installer) doInstall(ctx context.Context) error {
 	// 1. Get the RPMs that should be installed
-	rpmsList, err := inst.getRPMs(ctx)
+	var (
+		rpmsList   []*rpm.RPMs
+		unresolved []rpm.Unresolved
+	)
+
+	err := inst.timePhase("find-rpms", func() (err error) {
+		rpmsList, unresolved, err = inst.getRPMs(ctx)
+		return err
+	})
+
 	if err != nil {
 		return err
 	}
 
+	inst.recordRPMs(rpmsList)
+
 	// 2. Download and configure the package manager
-	if err = inst.configure(ctx); err != nil {
+	err = inst.timePhase("configure", func() error {
+		return inst.configure(ctx)
+	})
+
+	if err != nil {
 		return err
 	}
 
-	// TODO: check that the number of RPMs in EOS nightly dir matches the number
-	// installed in our install directory
-
 	// 3. Use the pkg manager to (re)install the RPMs
-	var installErr = NewInstallError()
+	var (
+		installErr = NewInstallError()
+		installed  []*rpm.RPMs
+	)
+
+	inst.started = true
+
 	for _, rpms := range rpmsList {
-		installErr.add(inst.installRPMs(ctx, rpms))
+		if err := inst.installRPMs(ctx, rpms); err != nil {
+			installErr.add(err)
+		} else {
+			installed = append(installed, rpms)
+		}
 
 		// Stop if the context is done, and return its error
 		select {
@@ -367,14 +496,29 @@ func (inst *Installer) doInstall(ctx context.Context) error {
 	nErrs := installErr.length()
 	nInstalls := len(rpmsList)
 
+	// Requirements that the remote repositories were
+	// to provide may be why the package manager failed
+	if nErrs > 0 && len(unresolved) > 0 {
+		installErr.add(rpm.UnresolvedError{Unresolved: unresolved})
+	}
+
+	// 4. Check every RPM installed has its payload on disk, as expected.
+	// A failed verification fails the install, aborting the transaction.
+	installErr.add(inst.verifyRPMs(ctx, installed))
+
 	switch {
-	case nErrs == 0:
-		return nil
+	case installErr.length() == 0:
+		return inst.nestCatalogs()
 	case nErrs < nInstalls:
+		installErr.add(inst.nestCatalogs())
 		return installErr
 	default:
 		// No installs were successful
-		if err := inst.cleanDirs(ctx); err != nil {
+		err := inst.timePhase("clean-dirs", func() error {
+			return inst.cleanDirs(ctx)
+		})
+
+		if err != nil {
 			return NewMultiError(installErr, err)
 		}
 
@@ -382,47 +526,105 @@ func (inst *Installer) doInstall(ctx context.Context) error {
 	}
 }
 
-func (inst *Installer) getRPMs(ctx context.Context) ([]*rpm.RPMs, error) {
+// waitNightly waits for the nightly RPMs to be fully copied, before the
+// transaction is opened so as not to hold it meanwhile,
+// if the finder is able to, timing the wait
+func (inst *Installer) waitNightly(ctx context.Context) error {
+	w, ok := inst.rpms.(waiter)
+	if !ok {
+		return nil
+	}
+
+	return inst.timePhase("wait-nightly", func() error {
+		waited, err := w.Wait(ctx, inst.opts.Project, inst.opts.Platform)
+		if err != nil {
+			return RPMFinderError{err}
+		}
+
+		inst.log.Info("Nightly complete", logging.F("waited", waited.Round(time.Second).String()))
+		return nil
+	})
+}
+
+func (inst *Installer) getRPMs(ctx context.Context) ([]*rpm.RPMs, []rpm.Unresolved, error) {
 	var (
-		err      error
-		done     = make(chan struct{})
-		rpmsList []*rpm.RPMs
+		err        error
+		done       = make(chan struct{})
+		rpmsList   []*rpm.RPMs
+		unresolved []rpm.Unresolved
 	)
 
 	go func() {
 		defer close(done)
-		rpmsList, err = inst.getRPMsList()
+		rpmsList, unresolved, err = inst.getRPMsList()
 	}()
 
 	select {
 	case <-done:
 		if err != nil {
-			return nil, RPMFinderError{err}
+			return nil, nil, RPMFinderError{err}
 		}
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, nil, ctx.Err()
+	}
+
+	return rpmsList, unresolved, nil
+}
+
+// nestCatalogs nests, if the transactioner publishes file catalogs,
+// a catalog in the nightly install directory and in each project
+func (inst *Installer) nestCatalogs() error {
+	cataloger, ok := inst.transaction.(filesystem.Cataloger)
+	if !ok {
+		return nil
 	}
 
-	return rpmsList, nil
+	return inst.timePhase("nest-catalogs", func() error {
+		// The projects are in the directory the nightly RPMs are relocated to
+		dir := inst.nightlyPrefix()
+		projects, err := subDirs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list projects of %s (%w)", dir, err)
+		}
+
+		dirs := []string{dir}
+		for _, project := range projects {
+			dirs = append(dirs, filepath.Join(dir, project))
+		}
+
+		return cataloger.NestCatalogs(dirs...)
+	})
 }
 
-// installRPMs installs a given set of RPMs
+// installRPMs installs a given set of RPMs, timing each step
 func (inst *Installer) installRPMs(ctx context.Context, rpms *rpm.RPMs) error {
-	if err := inst.pkg.Install(ctx, rpms.Names()...); err != nil {
+	err := inst.timePhase("install", func() error {
+		return inst.pkg.Install(ctx, rpms.Names()...)
+	})
+
+	if err != nil {
 		return err
 	}
 
-	if err := inst.cleanDirs(ctx); err != nil {
+	err = inst.timePhase("clean-dirs", func() error {
+		return inst.cleanDirs(ctx)
+	})
+
+	if err != nil {
 		return err
 	}
 
-	// TODO: configure this name
-	if err := inst.pkg.CleanAll(ctx, "atlas-offline-nightly"); err != nil {
+	err = inst.timePhase("clean-all", func() error {
+		// TODO: configure this name
+		return inst.pkg.CleanAll(ctx, "atlas-offline-nightly")
+	})
+
+	if err != nil {
 		return err
 	}
 
 	inst.log.Info("Everything complete!")
-	return inst.writeTagsFile()
+	return inst.timePhase("write-tagsfile", inst.writeTagsFile)
 }
 
 func (inst *Installer) writeTagsFile() error {
@@ -452,27 +654,33 @@ func (inst *Installer) writeTagsFile() error {
 	}
 
 	nextRelease := projSubdirs.Names()[0]
+	entries := inst.tagsEntries(projectDirs.Names(), nextRelease)
+
+	if err := inst.tags.Append(entries); err != nil {
+		return err
+	}
 
-	var entries *tagsfile.Entries
-	for _, project := range *projectDirs {
+	inst.tags.Remove(".cvmfscatalog", ".ayum.log")
+	return inst.tags.Save()
+}
+
+// tagsEntries creates the tags file entries for the given nightly projects
+func (inst *Installer) tagsEntries(projects []string, nextRelease string) *tagsfile.Entries {
+	var entries = &tagsfile.Entries{}
+	for _, project := range projects {
 		entries.Add(
 			&tagsfile.Entry{
 				Label:    "VO-atlas-nightly",
 				Branch:   inst.opts.Branch,
 				Datetime: inst.opts.Timestamp,
-				Project:  project.Name(),
+				Project:  project,
 				NextRel:  nextRelease,
 				Platform: inst.opts.Platform,
 			},
 		)
 	}
 
-	if err := inst.tags.Append(entries); err != nil {
-		return err
-	}
-
-	inst.tags.Remove(".cvmfscatalog", ".ayum.log")
-	return inst.tags.Save()
+	return entries
 }
 
 // cleanDirs removes certain install directories, post install
@@ -484,18 +692,7 @@ func (inst *Installer) cleanDirs(ctx context.Context) error {
 
 	go func() {
 		defer close(done)
-		installdir := filepath.Join(inst.opts.InstallBaseDir, inst.NightlyID())
-
-		toDelete := []string{".yumcache"}
-		if inst.opts.Branch == "master" || inst.opts.Branch == "master-GAUDI" {
-			toDelete = append(toDelete, "tdaq", "tdaq-common", "dqm-common")
-		}
-
-		for i, d := range toDelete {
-			toDelete[i] = filepath.Join(installdir, d)
-		}
-
-		err = fs.Dirs(toDelete...).Remove()
+		err = fs.Dirs(inst.dirsToClean()...).Remove()
 	}()
 
 	select {
@@ -507,6 +704,22 @@ func (inst *Installer) cleanDirs(ctx context.Context) error {
 	return err
 }
 
+// dirsToClean returns the install directories that cleanDirs removes
+func (inst *Installer) dirsToClean() []string {
+	installdir := filepath.Join(inst.opts.InstallBaseDir, inst.NightlyID())
+
+	toDelete := []string{".yumcache"}
+	if inst.opts.Branch == "master" || inst.opts.Branch == "master-GAUDI" {
+		toDelete = append(toDelete, "tdaq", "tdaq-common", "dqm-common")
+	}
+
+	for i, d := range toDelete {
+		toDelete[i] = filepath.Join(installdir, d)
+	}
+
+	return toDelete
+}
+
 // configure readies the installer for installing RPMs,
 // by downloading the package manager and configuring it.
 func (inst *Installer) configure(ctx context.Context) error {
@@ -537,18 +750,44 @@ func (inst *Installer) configure(ctx context.Context) error {
 
 // openTransacation tries to open the appropriate file-system transaction
 func (inst *Installer) openTransaction(ctx context.Context) error {
-	err := inst.transaction.Open(ctx)
+	filesystem.SnapshotDirs(inst.transaction, inst.nightlyPrefix())
+	return openTransaction(ctx, inst.transaction, inst.log, inst.writtenDirs()...)
+}
+
+// writtenDirs returns the directories to which the install writes, to
+// which the transaction is scoped, if possible: that of the nightly's
+// logs, the package manager's, and the prefixes the RPMs are relocated to
+func (inst *Installer) writtenDirs() []string {
+	dirs := []string{filepath.Join(inst.opts.InstallBaseDir, inst.NightlyID())}
+	if inst.opts.PkgInstallDir != "" {
+		dirs = append(dirs, inst.opts.PkgInstallDir)
+	}
+
+	for _, repo := range inst.getRemoteRepos() {
+		if repo.Prefix != "" {
+			dirs = append(dirs, repo.Prefix)
+		}
+	}
+
+	return dirs
+}
+
+// openTransaction tries to open the given file-system transaction,
+// scoped, if possible, to the directory containing the dirs
+func openTransaction(ctx context.Context, t filesystem.Transactioner, log logging.Logger, dirs ...string) error {
+	filesystem.Scope(t, dirs...)
+	err := t.Open(ctx)
 	if err == nil {
 		return nil
 	}
 
 	// Is a context error
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		inst.log.Info("Context done, aborting file-system transaction open", logging.ErrField(err))
+		log.Info("Context done, aborting file-system transaction open", logging.ErrField(err))
 		return fmt.Errorf("context done, aborting transaction open (%w)", err)
 	}
 
-	inst.log.Error("Unable to open file system transaction", logging.ErrField(err))
+	log.Error("Unable to open file system transaction", logging.ErrField(err))
 	return fmt.Errorf("failed to open file system transaction (%w)", err)
 }
 
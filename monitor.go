@@ -1,12 +0,0 @@
-package installer
-
-var (
-// - Current state
-// - Time spent waiting for nightly
-// - Time setting up to install nightly
-// - Time installing nightly =
-// - Any errors returned = count
-// - CPU/mem usage every X seconds = gauge
-// -
-
-)
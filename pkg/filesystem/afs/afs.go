@@ -2,6 +2,10 @@ package afs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
 	"github.com/brinick/logging"
@@ -13,11 +17,29 @@ import (
 // no error was returned.
 func NewTransaction(opts *Opts, log logging.Logger) *Transaction {
 	t := Transaction{
-		attempts: opts.MaxTransactionAttempts,
+		Runner:       filesystem.NewShellRunner(log),
+		Path:         opts.Path,
+		Volume:       opts.Volume,
+		SudoUser:     opts.SudoUser,
+		FsBinary:     opts.FsBinary,
+		VosBinary:    opts.VosBinary,
+		MinFreeQuota: opts.MinFreeQuota,
+		log:          log,
+		attempts:     opts.MaxTransactionAttempts,
+	}
+
+	// A lack of quota does not resolve itself, so is not retried
+	retry := opts.RetryOpts
+	if retry.Retryable == nil {
+		retry.Retryable = func(err error) bool {
+			var quotaErr QuotaError
+			return !errors.As(err, &quotaErr)
+		}
 	}
 
 	t.Transaction.Starter = &t
 	t.Transaction.Stopper = &t
+	t.Transaction.Retry = filesystem.NewRetryPolicy(&retry, opts.MaxTransactionAttempts)
 	return &t
 }
 
@@ -28,16 +50,155 @@ type Opts struct {
 
 	// How many times we try to open our own AFS transaction
 	MaxTransactionAttempts int `json:"max_transaction_open_attempts"`
+
+	// Policy for retrying to open the transaction
+	filesystem.RetryOpts
+
+	// ReadWrite installs through the read-write path of the volume,
+	// /afs/.<cell>/..., rather than its read-only replicas
+	ReadWrite bool `json:"read_write"`
+
+	// Path is the read-write path installed to, whose quota is checked
+	Path string `json:"path"`
+
+	// Volume is the volume released on close
+	Volume string `json:"volume"`
+
+	// MinFreeQuota is the free quota, in MB, needed to start installing
+	MinFreeQuota int `json:"min_free_quota"`
+
+	// Paths to the fs and vos binaries
+	FsBinary  string `json:"fs_binary"`
+	VosBinary string `json:"vos_binary"`
+}
+
+// ReadWritePath returns the read-write path of the AFS path,
+// whose cell is prefixed with a dot, e.g. /afs/.cern.ch/...
+func ReadWritePath(path string) string {
+	const prefix = "/afs/"
+	if !strings.HasPrefix(path, prefix) || strings.HasPrefix(path, prefix+".") {
+		return path
+	}
+
+	return prefix + "." + strings.TrimPrefix(path, prefix)
+}
+
+// QuotaError is returned when the volume has too little free
+// quota for a transaction to be started
+type QuotaError struct {
+	Path   string
+	FreeMB int
+	NeedMB int
+}
+
+func (q QuotaError) Error() string {
+	return fmt.Sprintf("only %d MB of quota free on %s, need %d MB", q.FreeMB, q.Path, q.NeedMB)
 }
 
-// Transaction represents an AFS transaction
+// Transaction represents an AFS transaction: changes are made in the
+// read-write volume, and published by releasing it to its replicas
 type Transaction struct {
 	filesystem.Transaction
-	attempts int
+	Runner       filesystem.Runner
+	Path         string
+	Volume       string
+	SudoUser     string
+	FsBinary     string
+	VosBinary    string
+	MinFreeQuota int
+	log          logging.Logger
+	attempts     int
+}
+
+// Attempts provides the number of tries allowed for opening the transaction
+func (t *Transaction) Attempts() int {
+	return t.attempts
+}
+
+// Start checks the volume has enough free quota to install. If
+// not, it returns a QuotaError.
+func (t *Transaction) Start(ctx context.Context) error {
+	if t.MinFreeQuota <= 0 {
+		return nil
+	}
+
+	out, err := t.Runner.Run(ctx, t.sudo(fmt.Sprintf("%s listquota %s", t.FsBinary, t.Path)))
+	if err != nil {
+		return fmt.Errorf("unable to check the quota of %s (%w)", t.Path, err)
+	}
+
+	freeKB, err := parseFreeQuota(out)
+	if err != nil {
+		return fmt.Errorf("unable to check the quota of %s (%w)", t.Path, err)
+	}
+
+	if freeKB >= 0 && freeKB/1024 < t.MinFreeQuota {
+		return QuotaError{Path: t.Path, FreeMB: freeKB / 1024, NeedMB: t.MinFreeQuota}
+	}
+
+	return nil
+}
+
+// Stop releases the read-write volume to its read-only replicas
+func (t *Transaction) Stop(ctx context.Context) error {
+	if t.Volume == "" {
+		t.log.Info("No AFS volume to release")
+		return nil
+	}
+
+	if _, err := t.Runner.Run(ctx, t.sudo(fmt.Sprintf("%s release %s", t.VosBinary, t.Volume))); err != nil {
+		return fmt.Errorf("unable to release volume %s (%w)", t.Volume, err)
+	}
+
+	return nil
 }
 
 // Kill will halt the ongoing transaction forcefully
-// exiting without publishing
+// exiting without releasing the volume, leaving the
+// read-only replicas untouched
 func (t *Transaction) Kill(ctx context.Context) error {
+	t.log.Info("Not releasing AFS volume", logging.F("volume", t.Volume))
 	return nil
 }
+
+// sudo returns the command run as the sudo user, if any
+func (t *Transaction) sudo(cmd string) string {
+	if t.SudoUser == "" {
+		return cmd
+	}
+
+	return fmt.Sprintf("sudo -u %s %s", t.SudoUser, cmd)
+}
+
+// parseFreeQuota returns the free quota, in KB, from the output of fs
+// listquota, or -1 if there is no limit. The output is of the form:
+//
+//	Volume Name                    Quota       Used %Used   Partition
+//	atlas.nightlies             100000000   5000000    5%         60%
+func parseFreeQuota(out string) (int, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected fs listquota output: %s", out)
+	}
+
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 3 {
+		return 0, fmt.Errorf("unexpected fs listquota output: %s", out)
+	}
+
+	if fields[1] == "no" {
+		return -1, nil
+	}
+
+	quota, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("bad quota %s", fields[1])
+	}
+
+	used, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, fmt.Errorf("bad used quota %s", fields[2])
+	}
+
+	return quota - used, nil
+}
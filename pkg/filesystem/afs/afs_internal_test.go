@@ -0,0 +1,165 @@
+package afs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+// fakeRunner records the commands run, replying with the output
+// of the first command prefix matched
+type fakeRunner struct {
+	cmds    []string
+	replies map[string]string
+	fail    map[string]error
+}
+
+func (f *fakeRunner) Run(ctx context.Context, cmd string) (string, error) {
+	f.cmds = append(f.cmds, cmd)
+	for prefix, err := range f.fail {
+		if strings.Contains(cmd, prefix) {
+			return "", err
+		}
+	}
+
+	for prefix, out := range f.replies {
+		if strings.Contains(cmd, prefix) {
+			return out, nil
+		}
+	}
+
+	return "", nil
+}
+
+const listquota = `Volume Name                    Quota       Used %Used   Partition
+atlas.nightlies               10240000    9216000   90%         60%`
+
+func newTestTransaction(opts *Opts, runner *fakeRunner) *Transaction {
+	if opts.MaxTransactionAttempts == 0 {
+		opts.MaxTransactionAttempts = 3
+	}
+
+	opts.FsBinary, opts.VosBinary = "fs", "vos"
+	t := NewTransaction(opts, logging.NullLogger{})
+	t.Runner = runner
+	return t
+}
+
+func TestReadWritePath(t *testing.T) {
+	for path, expect := range map[string]string{
+		"/afs/cern.ch/atlas/sw":  "/afs/.cern.ch/atlas/sw",
+		"/afs/.cern.ch/atlas/sw": "/afs/.cern.ch/atlas/sw",
+		"/cvmfs/atlas.cern.ch":   "/cvmfs/atlas.cern.ch",
+	} {
+		if got := ReadWritePath(path); got != expect {
+			t.Errorf("%s: expected %s, got %s", path, expect, got)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	runner := &fakeRunner{replies: map[string]string{"listquota": listquota}}
+
+	// 1000 MB are free
+	opts := &Opts{Path: "/afs/.cern.ch/atlas", MinFreeQuota: 500, SudoUser: "atnight"}
+	if err := newTestTransaction(opts, runner).Open(context.Background()); err != nil {
+		t.Fatalf("expected enough quota, got %v", err)
+	}
+
+	if expect := "sudo -u atnight fs listquota /afs/.cern.ch/atlas"; runner.cmds[0] != expect {
+		t.Errorf("expected %q, got %q", expect, runner.cmds[0])
+	}
+
+	runner.cmds = nil
+	opts.MinFreeQuota = 2000
+	err := newTestTransaction(opts, runner).Open(context.Background())
+
+	var quotaErr QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.FreeMB != 1000 {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+
+	if len(runner.cmds) != 1 {
+		t.Errorf("expected the quota not to be retried, ran %v", runner.cmds)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	runner := &fakeRunner{}
+	tr := newTestTransaction(&Opts{Volume: "atlas.nightlies"}, runner)
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runner.cmds) != 1 || runner.cmds[0] != "vos release atlas.nightlies" {
+		t.Errorf("expected the volume to be released, ran %v", runner.cmds)
+	}
+
+	runner.cmds = nil
+	if err := tr.Kill(context.Background()); err != nil || len(runner.cmds) != 0 {
+		t.Errorf("expected kill to leave the volume unreleased, ran %v (%v)", runner.cmds, err)
+	}
+
+	runner.fail = map[string]error{"release": errors.New("no such volume")}
+	tr.Open(context.Background())
+	if err := tr.Close(context.Background()); err == nil {
+		t.Error("expected the failed release to be returned")
+	}
+}
+
+// writeScript writes an executable shell script to the dir
+func writeScript(t *testing.T, dir, name, body string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestShellCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "afs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	quota := filepath.Join(dir, "listquota")
+	if err := ioutil.WriteFile(quota, []byte(listquota+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Opts{
+		MaxTransactionAttempts: 1,
+		Path:                   "/afs/.cern.ch/atlas/nightlies",
+		Volume:                 "atlas.nightlies",
+		MinFreeQuota:           100,
+		FsBinary:               writeScript(t, dir, "fs", "cat "+quota+"\n"),
+		VosBinary:              writeScript(t, dir, "vos", "echo 'volume busy' >&2; exit 1\n"),
+	}
+
+	tr := NewTransaction(opts, logging.NullLogger{})
+	if err := tr.Start(context.Background()); err != nil {
+		t.Fatalf("expected the quota to be read through the shell, got %v", err)
+	}
+
+	opts.MinFreeQuota = 2000
+	var quotaErr QuotaError
+	if err := NewTransaction(opts, logging.NullLogger{}).Start(context.Background()); !errors.As(err, &quotaErr) {
+		t.Errorf("expected a QuotaError, got %v", err)
+	}
+
+	if err := tr.Stop(context.Background()); err == nil || !strings.Contains(err.Error(), "volume busy") {
+		t.Errorf("expected the failed release to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CopyTree copies the src directory tree to dst, keeping the file
+// modes and symlinks, and stopping if the context is done
+func CopyTree(ctx context.Context, src, dst string) error {
+	// Directories are kept writable until their content is copied
+	dirModes := map[string]os.FileMode{}
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			dirModes[target] = mode.Perm()
+			return os.Mkdir(target, mode.Perm()|0700)
+
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case mode.IsRegular():
+			return CopyFile(path, target, mode.Perm())
+		}
+
+		// Sockets, devices and the like are not copied
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for dir, mode := range dirModes {
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyFile copies the src file to dst, with the given mode
+func CopyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// The mode given on creation is masked by the umask
+	return os.Chmod(dst, mode)
+}
+
+// Exists reports if the path exists
+func Exists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
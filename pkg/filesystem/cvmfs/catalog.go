@@ -0,0 +1,193 @@
+package cvmfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/logging"
+)
+
+// Policies on failing to create the nested catalogs
+const (
+	CatalogPolicyFail = "fail"
+	CatalogPolicyWarn = "warn"
+)
+
+// CatalogPolicies lists the policies on failing to create nested catalogs
+var CatalogPolicies = []string{CatalogPolicyFail, CatalogPolicyWarn}
+
+const (
+	// catalogFile marks the directory as the root of a nested catalog
+	catalogFile = ".cvmfscatalog"
+
+	// dirtabFile lists, at the repo root, the directory patterns
+	// at which cvmfs_server creates nested catalogs on publish
+	dirtabFile = ".cvmfsdirtab"
+)
+
+// catalogs nests file catalogs in the directories installed, so that
+// clients only load the catalogs of the directories they use
+type catalogs struct {
+	// dirs always get a nested catalog
+	dirs []string
+
+	// maxEntries, if > 0, is the number of entries in a directory
+	// tree beyond which it gets its own nested catalog
+	maxEntries int
+
+	// dirtab records the catalog directories in the repo .cvmfsdirtab,
+	// which is only writable if the transaction is not scoped to a subpath
+	dirtab  bool
+	repo    string
+	subpath string
+
+	policy string
+	log    logging.Logger
+}
+
+// newCatalogs returns the nested catalogs handler configured by the opts
+func newCatalogs(opts *Opts, log logging.Logger, dirs ...string) catalogs {
+	return catalogs{
+		dirs:       dirs,
+		maxEntries: opts.CatalogMaxEntries,
+		dirtab:     opts.CatalogDirtab,
+		repo:       opts.NightlyRepo,
+		policy:     opts.CatalogPolicy,
+		log:        log,
+	}
+}
+
+// NestCatalogs creates nested catalogs in the directories, and in their
+// sub-directories whose trees have too many entries, to be published with
+// the transaction. Failures are returned, or only logged if the policy is
+// to warn.
+func (c *catalogs) NestCatalogs(dirs ...string) error {
+	dirs = append(append([]string{}, c.dirs...), dirs...)
+
+	var placed []string
+	for _, dir := range dirs {
+		if c.maxEntries > 0 {
+			split, err := splitCatalogs(dir, c.maxEntries)
+			if err != nil {
+				return c.failed(err)
+			}
+			placed = append(placed, split...)
+		}
+
+		placed = append(placed, dir)
+	}
+
+	for _, dir := range placed {
+		if err := fs.NewFile(filepath.Join(dir, catalogFile)).Touch(true); err != nil {
+			return c.failed(fmt.Errorf("unable to create nested catalog (%w)", err))
+		}
+	}
+
+	c.log.Info("Created nested catalogs", logging.F("n", len(placed)))
+
+	if c.dirtab && c.subpath != "" {
+		c.log.Info("Transaction scoped to a subpath, not updating the repo dirtab", logging.F("subpath", c.subpath))
+	}
+
+	if c.dirtab && c.subpath == "" {
+		if err := writeDirtab(filepath.Join(MountBase, c.repo), placed); err != nil {
+			return c.failed(err)
+		}
+	}
+
+	return nil
+}
+
+// failed applies the policy to the failure to create the nested catalogs
+func (c *catalogs) failed(err error) error {
+	if c.policy == CatalogPolicyWarn {
+		c.log.Error("Failed to create nested catalogs, publishing without", logging.ErrField(err))
+		return nil
+	}
+
+	return err
+}
+
+// splitCatalogs returns the sub-directories of the directory needing a
+// nested catalog, so that no catalog has more than maxEntries entries.
+// Sub-directories are chosen bottom up, deepest first.
+func splitCatalogs(dir string, maxEntries int) ([]string, error) {
+	var placed []string
+
+	// count returns the entries of the tree not in a nested catalog
+	var count func(string) (int, error)
+	count = func(path string) (int, error) {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return 0, fmt.Errorf("unable to count catalog entries (%w)", err)
+		}
+
+		n := len(entries)
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+
+			sub := filepath.Join(path, e.Name())
+			subN, err := count(sub)
+			if err != nil {
+				return 0, err
+			}
+
+			if subN > maxEntries {
+				placed = append(placed, sub)
+				continue
+			}
+
+			n += subN
+		}
+
+		return n, nil
+	}
+
+	if _, err := count(dir); err != nil {
+		return nil, err
+	}
+
+	return placed, nil
+}
+
+// writeDirtab adds the catalog directories, relative to the repo root,
+// to the repo .cvmfsdirtab, keeping the entries already there
+func writeDirtab(root string, dirs []string) error {
+	path := filepath.Join(root, dirtabFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s (%w)", path, err)
+	}
+
+	lines := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines[line] = true
+		}
+	}
+
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			lines["/"+rel] = true
+		}
+	}
+
+	var sorted []string
+	for line := range lines {
+		sorted = append(sorted, line)
+	}
+	sort.Strings(sorted)
+
+	if err := ioutil.WriteFile(path, []byte(strings.Join(sorted, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("unable to write %s (%w)", path, err)
+	}
+
+	return nil
+}
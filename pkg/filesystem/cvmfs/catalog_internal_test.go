@@ -0,0 +1,109 @@
+package cvmfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+// makeTree creates files in the directories, relative to root
+func makeTree(t *testing.T, root string, files map[string]int) {
+	for dir, n := range files {
+		path := filepath.Join(root, dir)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < n; i++ {
+			ioutil.WriteFile(filepath.Join(path, fmt.Sprintf("f%d", i)), nil, 0644)
+		}
+	}
+}
+
+// catalogDirs returns the directories, relative to root, with a nested catalog
+func catalogDirs(root string) []string {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == catalogFile {
+			rel, _ := filepath.Rel(root, filepath.Dir(path))
+			dirs = append(dirs, rel)
+		}
+		return nil
+	})
+
+	sort.Strings(dirs)
+	return dirs
+}
+
+func TestNestCatalogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "catalogs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	nightly := filepath.Join(root, "master_Athena_x86_64", "2020-05-01T2101")
+	makeTree(t, nightly, map[string]int{
+		"Athena/22.0.1/InstallArea/big":   8,
+		"Athena/22.0.1/InstallArea/small": 2,
+		"AthenaExternals/22.0.1":          3,
+	})
+
+	c := newCatalogs(&Opts{CatalogMaxEntries: 5, CatalogPolicy: CatalogPolicyFail}, logging.NullLogger{})
+	err = c.NestCatalogs(nightly, filepath.Join(nightly, "Athena"), filepath.Join(nightly, "AthenaExternals"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"master_Athena_x86_64/2020-05-01T2101",
+		"master_Athena_x86_64/2020-05-01T2101/Athena",
+		"master_Athena_x86_64/2020-05-01T2101/Athena/22.0.1/InstallArea/big",
+		"master_Athena_x86_64/2020-05-01T2101/AthenaExternals",
+	}
+
+	if got := catalogDirs(root); strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Errorf("expected nested catalogs in\n%v\ngot\n%v", expect, got)
+	}
+
+	// Failures are only errors if the policy is to fail
+	missing := filepath.Join(root, "missing")
+	if err := c.NestCatalogs(missing); err == nil {
+		t.Errorf("expected an error nesting a catalog in a missing directory")
+	}
+
+	c.policy = CatalogPolicyWarn
+	if err := c.NestCatalogs(missing); err != nil {
+		t.Errorf("expected no error if the policy is to warn, got %v", err)
+	}
+
+	// The dirtab, at the repo root, is outside a scoped transaction
+	c.policy, c.dirtab, c.repo, c.subpath = CatalogPolicyFail, true, "missing.repo", "sw/master"
+	if err := c.NestCatalogs(nightly); err != nil {
+		t.Errorf("expected the dirtab to be left alone in a scoped transaction, got %v", err)
+	}
+}
+
+func TestWriteDirtab(t *testing.T) {
+	root, err := ioutil.TempDir("", "dirtab.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ioutil.WriteFile(filepath.Join(root, dirtabFile), []byte("/repo/sw/*\n"), 0644)
+	if err := writeDirtab(root, []string{filepath.Join(root, "repo/sw/master/ts"), "/elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(root, dirtabFile))
+	if string(data) != "/repo/sw/*\n/repo/sw/master/ts\n" {
+		t.Errorf("unexpected .cvmfsdirtab:\n%s", data)
+	}
+}
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
-	"github.com/brinick/fs"
 	"github.com/brinick/logging"
 	"github.com/brinick/shell"
 )
 
+// MountBase is where the CVMFS repositories are mounted
+const MountBase = "/cvmfs"
+
 // Opts configures the CVMFS transaction
 type Opts struct {
 	// User with the necessary rights to install
@@ -20,6 +24,9 @@ type Opts struct {
 	// Path to the CVMFS server binary
 	Binary string `json:"cvmfs_server_binary"`
 
+	// Backend is how the transaction is opened, see Backends
+	Backend string `json:"backend"`
+
 	// Name of the nightly repo
 	NightlyRepo string `json:"nightly_repo"`
 
@@ -28,6 +35,46 @@ type Opts struct {
 
 	// How many times we try to open our own CVMFS transaction
 	MaxTransactionAttempts int `json:"max_transaction_open_attempts"`
+
+	// Policy for retrying to open the transaction
+	filesystem.RetryOpts
+
+	// GatewayURL is the cvmfs-gateway API URL, and GatewayKeyFile
+	// the key with which requests are signed, for the gateway backend
+	GatewayURL     string `json:"gateway_url"`
+	GatewayKeyFile string `json:"gateway_key_file"`
+
+	// LeasePath is the path within the repo leased
+	// from the gateway (default the whole repo)
+	LeasePath string `json:"lease_path"`
+
+	// ScopeTransactions scopes each transaction to the deepest directory
+	// containing those written by the nightlies installed, so that
+	// others may be installed concurrently
+	ScopeTransactions bool `json:"scope_transactions"`
+
+	// CatalogMaxEntries, if > 0, is the number of entries in a directory
+	// tree beyond which it gets its own nested catalog
+	CatalogMaxEntries int `json:"catalog_max_entries"`
+
+	// CatalogDirtab records the nested catalogs in the repo .cvmfsdirtab,
+	// if the transaction covers the whole repo
+	CatalogDirtab bool `json:"catalog_dirtab"`
+
+	// CatalogPolicy is what to do on failing to create the
+	// nested catalogs, see CatalogPolicies
+	CatalogPolicy string `json:"catalog_policy"`
+
+	// SpoolDir is the cvmfs_server spool directory, holding
+	// the transaction lock file of each repository
+	SpoolDir string `json:"spool_dir"`
+
+	// LeaseFile records the installer process holding the transaction
+	LeaseFile string `json:"lease_file"`
+
+	// StaleTransactionAge is the age, in minutes, beyond which a transaction
+	// left open by a crashed installer is aborted (0: never abort)
+	StaleTransactionAge int `json:"stale_transaction_age"`
 }
 
 func shellWithContext(ctx context.Context, cmd string, args ...string) error {
@@ -44,30 +91,42 @@ var (
 // NewTransaction will create a transaction object and call
 // its open() method. The transaction Close() method should
 // be deferred immediately after calling this, assuming
-// no error was returned.
+// no error was returned. The nested catalog dirs, if any,
+// always get a nested catalog, see NestCatalogs.
 func NewTransaction(opts *Opts, log logging.Logger, nestedCatalogDirs ...string) *Transaction {
 	t := Transaction{
-		Repo:        opts.NightlyRepo,
-		Binary:      opts.Binary,
-		Node:        opts.ReleaseManager,
-		attempts:    opts.MaxTransactionAttempts,
-		catalogDirs: nestedCatalogDirs,
+		catalogs:  newCatalogs(opts, log, nestedCatalogDirs...),
+		Repo:      opts.NightlyRepo,
+		Binary:    opts.Binary,
+		Node:      opts.ReleaseManager,
+		SpoolDir:  opts.SpoolDir,
+		LeaseFile: opts.LeaseFile,
+		staleAge:  time.Duration(opts.StaleTransactionAge) * time.Minute,
+		scoped:    opts.ScopeTransactions,
+		log:       log,
+		attempts:  opts.MaxTransactionAttempts,
 	}
 
 	t.Transaction.Starter = &t
 	t.Transaction.Stopper = &t
+	t.Transaction.Retry = filesystem.NewRetryPolicy(&opts.RetryOpts, opts.MaxTransactionAttempts)
 	return &t
 }
 
 // Transaction represents a CVMFS transaction
 type Transaction struct {
 	filesystem.Transaction
-	Binary      string
-	Repo        string
-	Node        string
-	log         logging.Logger
-	attempts    int
-	catalogDirs []string
+	catalogs
+	Binary    string
+	Repo      string
+	Node      string
+	SpoolDir  string
+	LeaseFile string
+	staleAge  time.Duration
+	scoped    bool
+	subpath   string
+	log       logging.Logger
+	attempts  int
 }
 
 // Attempts provides the number of tries allowed for opening the transaction
@@ -76,42 +135,133 @@ func (t *Transaction) Attempts() int {
 }
 
 // Start will open a new transaction. If one is already ongoing on
-// this node, it will return an error
+// this node, it will return a TransactionHeldError, unless it was
+// left by a crashed installer long enough ago to be aborted.
 func (t *Transaction) Start(ctx context.Context) error {
-	cmd := fmt.Sprintf("%s transaction %s", t.Binary, t.Repo)
-	res := shell.Run(cmd, shell.Context(ctx))
-	t.log.InfoL(res.Stdout().Lines())
-	t.log.ErrorL(res.Stderr().Lines())
-	return res.Err()
+	if err := t.recoverStale(ctx); err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf("%s transaction %s", t.Binary, t.Path())
+	if err := t.run(ctx, cmd); err != nil {
+		// Another process may have opened one since we looked
+		if held, _ := t.held(); held != nil {
+			return *held
+		}
+
+		return err
+	}
+
+	if err := writeLease(t.leaseFile(), t.Path()); err != nil {
+		t.log.Error("Crash of this process will not be detectable", logging.ErrField(err))
+	}
+
+	return nil
+}
+
+// Scope scopes the transaction to the deepest directory containing
+// the dirs, if scoping transactions, and that directory is within the repo
+func (t *Transaction) Scope(dirs ...string) {
+	if t.scoped {
+		t.subpath = subpath(t.Repo, filesystem.CommonDir(dirs...))
+		t.catalogs.subpath = t.subpath
+	}
+}
+
+// Path returns the repo path of the transaction: the repo,
+// or its subpath if the transaction is scoped
+func (t *Transaction) Path() string {
+	if t.subpath == "" {
+		return t.Repo
+	}
+
+	return t.Repo + "/" + t.subpath
+}
+
+// subpath returns the path of the directory within the
+// repo, or "" if it is the repo, or is not within it
+func subpath(repo, dir string) string {
+	rel, err := filepath.Rel(filepath.Join(MountBase, repo), dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return ""
+	}
+
+	return rel
+}
+
+// recoverStale aborts the transaction ongoing in the repository, if it was
+// left by a crashed installer longer ago than the stale age. Otherwise,
+// it returns the TransactionHeldError describing the ongoing transaction.
+func (t *Transaction) recoverStale(ctx context.Context) error {
+	held, err := t.held()
+	if err != nil {
+		t.log.Error("Unable to check for an ongoing transaction", logging.ErrField(err))
+		return nil
+	}
+
+	if held == nil {
+		return nil
+	}
+
+	age := time.Since(held.Since)
+	fields := []logging.Field{
+		logging.F("repo", t.Repo),
+		logging.F("path", held.Path),
+		logging.F("holder", held.Holder),
+		logging.F("pid", held.PID),
+		logging.F("host", held.Host),
+		logging.F("age", age.Round(time.Second).String()),
+	}
+
+	if held.Holder != HolderCrashed || t.staleAge == 0 || age < t.staleAge {
+		t.log.Info("Transaction already ongoing, not aborting it", fields...)
+		return *held
+	}
+
+	t.log.Info("Aborting stale transaction left by a crashed installer", fields...)
+	if err := t.Kill(ctx); err != nil {
+		return fmt.Errorf("unable to abort stale transaction (%w)", err)
+	}
+
+	// The lease may be that of a transaction on another path
+	return removeLease(held.lease)
 }
 
 // Stop will exit the transaction after publishing
 func (t *Transaction) Stop(ctx context.Context) error {
-	// TODO: should we abort publish if we cannot create catalogs? Probably not.
-	createNestedCatalogs(t.catalogDirs...)
 	cmd := fmt.Sprintf("%s publish %s", t.Binary, t.Repo)
-	res := shell.Run(cmd, shell.Context(ctx))
-	t.log.InfoL(res.Stdout().Lines())
-	t.log.ErrorL(res.Stderr().Lines())
-	return res.Err()
+	if err := t.run(ctx, cmd); err != nil {
+		return err
+	}
+
+	return removeLease(t.leaseFile())
 }
 
 // Kill will halt the ongoing transaction forcefully
 // exiting without publishing
 func (t *Transaction) Kill(ctx context.Context) error {
 	cmd := fmt.Sprintf("%s abort -f %s", t.Binary, t.Repo)
+	if err := t.run(ctx, cmd); err != nil {
+		return err
+	}
+
+	return removeLease(t.leaseFile())
+}
+
+// run runs the cvmfs_server command, logging its output, and returns
+// an error if it could not be run or exited with a non-zero code
+func (t *Transaction) run(ctx context.Context, cmd string) error {
 	res := shell.Run(cmd, shell.Context(ctx))
+	stderr := res.Stderr().Lines()
 	t.log.InfoL(res.Stdout().Lines())
-	t.log.ErrorL(res.Stderr().Lines())
-	return res.Err()
-}
+	t.log.ErrorL(stderr)
 
-func createNestedCatalogs(dirs ...string) error {
-	for _, dir := range dirs {
-		catalog := fs.NewFile(filepath.Join(dir, ".cvmfscatalog"))
-		if err := catalog.Touch(true); err != nil {
-			return err
-		}
+	if err := res.Err(); err != nil {
+		return err
+	}
+
+	if code := res.ExitCode(); code != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", cmd, code, strings.Join(stderr, "\n"))
 	}
 
 	return nil
@@ -0,0 +1,238 @@
+package cvmfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+// fakeServer is a cvmfs_server stand-in, recording its calls, which
+// creates the lock file on transaction, failing if it exists, and
+// removes it on abort or publish
+const fakeServer = `#!/bin/sh
+echo "$1" >> %[1]s/calls
+repo=$(echo "${3:-$2}" | cut -d/ -f1)
+lock=%[1]s/spool/$repo/in_transaction.lock
+case "$1" in
+    transaction) [ -e $lock ] && exit 1; mkdir -p $(dirname $lock); touch $lock ;;
+    abort|publish) rm -f $lock ;;
+esac
+`
+
+// makeTransaction returns a transaction using the fake cvmfs_server, with
+// the repo's transaction lock file, and the lease, if given, in place
+func makeTransaction(t *testing.T, dir string, l *lease, lockAge time.Duration) *Transaction {
+	binary := filepath.Join(dir, "cvmfs_server")
+	script := strings.Replace(fakeServer, "%[1]s", dir, -1)
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Opts{
+		Binary:                 binary,
+		NightlyRepo:            "atlas-nightlies.cern.ch",
+		MaxTransactionAttempts: 1,
+		SpoolDir:               filepath.Join(dir, "spool"),
+		LeaseFile:              filepath.Join(dir, "lease"),
+		StaleTransactionAge:    60,
+	}
+
+	if lockAge > 0 {
+		lock := filepath.Join(opts.SpoolDir, opts.NightlyRepo, lockFiles[0])
+		os.MkdirAll(filepath.Dir(lock), 0755)
+		ioutil.WriteFile(lock, nil, 0644)
+		since := time.Now().Add(-lockAge)
+		os.Chtimes(lock, since, since)
+	}
+
+	if l != nil {
+		data, _ := json.Marshal(l)
+		ioutil.WriteFile(opts.LeaseFile, data, 0644)
+	}
+
+	return NewTransaction(opts, logging.NullLogger{})
+}
+
+// deadPID returns the PID of a process that has exited
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd.Process.Pid
+}
+
+func TestStartRecoversStaleTransaction(t *testing.T) {
+	host, _ := os.Hostname()
+	for _, tc := range []struct {
+		name     string
+		lease    *lease
+		lockAge  time.Duration
+		staleAge int
+		holder   string
+	}{
+		{"none", nil, 0, 60, ""},
+		{"crashed and stale", &lease{deadPID(t), host, time.Now().Add(-2 * time.Hour), ""}, 2 * time.Hour, 60, ""},
+		{"crashed and recent", &lease{deadPID(t), host, time.Now().Add(-time.Minute), ""}, time.Minute, 60, HolderCrashed},
+		{"crashed, never abort", &lease{deadPID(t), host, time.Now().Add(-2 * time.Hour), ""}, 2 * time.Hour, 0, HolderCrashed},
+		{"live", &lease{os.Getpid(), host, time.Now().Add(-2 * time.Hour), ""}, 2 * time.Hour, 60, HolderLive},
+		{"other host", &lease{1, host + ".other", time.Now().Add(-2 * time.Hour), ""}, 2 * time.Hour, 60, HolderUnknown},
+		{"no lease", nil, 2 * time.Hour, 60, HolderUnknown},
+		{"lease older than lock", &lease{deadPID(t), host, time.Now().Add(-3 * time.Hour), ""}, 2 * time.Hour, 60, HolderUnknown},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cvmfs.")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			tx := makeTransaction(t, dir, tc.lease, tc.lockAge)
+			tx.staleAge = time.Duration(tc.staleAge) * time.Minute
+			err = tx.Start(context.Background())
+
+			var held TransactionHeldError
+			switch {
+			case tc.holder == "" && err != nil:
+				t.Fatalf("expected the transaction to start, got %v", err)
+			case tc.holder != "" && !errors.As(err, &held):
+				t.Fatalf("expected a TransactionHeldError, got %v", err)
+			case tc.holder != "" && held.Holder != tc.holder:
+				t.Errorf("expected the transaction to be held by a %s process, got %s", tc.holder, held.Holder)
+			}
+
+			calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+			aborted := strings.Contains(string(calls), "abort")
+			if aborted != (tc.name == "crashed and stale") {
+				t.Errorf("unexpected cvmfs_server calls:\n%s", calls)
+			}
+
+			if tc.holder != "" {
+				return
+			}
+
+			l, err := readLease(tx.LeaseFile)
+			if err != nil || l == nil || l.PID != os.Getpid() {
+				t.Errorf("expected a lease for this process, got %+v (%v)", l, err)
+			}
+
+			if err := tx.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if l, _ := readLease(tx.LeaseFile); l != nil {
+				t.Errorf("expected the lease to be removed on publish")
+			}
+		})
+	}
+}
+
+func TestStartRecoversStaleScopedTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cvmfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tx := makeTransaction(t, dir, nil, 2*time.Hour)
+	tx.scoped = true
+	tx.Scope(filepath.Join(MountBase, tx.Repo, "sw/22.0"))
+
+	// The crashed installer held a transaction on another path
+	host, _ := os.Hostname()
+	other := tx.LeaseFile + ".sw_master"
+	data, _ := json.Marshal(&lease{deadPID(t), host, time.Now().Add(-2 * time.Hour), tx.Repo + "/sw/master"})
+	if err := ioutil.WriteFile(other, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	held, err := tx.held()
+	if err != nil || held == nil || held.Holder != HolderCrashed || held.Path != tx.Repo+"/sw/master" {
+		t.Fatalf("expected the transaction to be held by the crashed installer on sw/master, got %+v (%v)", held, err)
+	}
+
+	if err := tx.Start(context.Background()); err != nil {
+		t.Fatalf("expected the transaction to start, got %v", err)
+	}
+
+	if l, _ := readLease(other); l != nil {
+		t.Errorf("expected the lease of the stale transaction to be removed")
+	}
+
+	if l, _ := readLease(tx.leaseFile()); l == nil || l.Path != tx.Repo+"/sw/22.0" {
+		t.Errorf("expected a lease on sw/22.0, got %+v", l)
+	}
+}
+
+// failingServer is a cvmfs_server stand-in whose transaction fails as
+// another process opens one first, and whose abort and publish fail
+const failingServer = `#!/bin/sh
+case "$1" in
+    transaction) mkdir -p %[1]s/spool/atlas-nightlies.cern.ch; touch %[1]s/spool/atlas-nightlies.cern.ch/in_transaction.lock; exit 1 ;;
+    *) echo "$1 refused" >&2; exit 2 ;;
+esac
+`
+
+func TestCommandFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cvmfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A crashed installer left a stale transaction
+	host, _ := os.Hostname()
+	crashed := &lease{deadPID(t), host, time.Now().Add(-2 * time.Hour), ""}
+	tx := makeTransaction(t, dir, crashed, 2*time.Hour)
+	script := strings.Replace(failingServer, "%[1]s", dir, -1)
+	if err := ioutil.WriteFile(tx.Binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	err = tx.Start(ctx)
+	if err == nil || !strings.Contains(err.Error(), "abort refused") {
+		t.Fatalf("expected the stale transaction abort to fail, got %v", err)
+	}
+
+	if l, _ := readLease(tx.LeaseFile); l == nil || l.PID != crashed.PID {
+		t.Errorf("expected the lease of the crashed installer to be kept, got %+v", l)
+	}
+
+	// Another process opens a transaction while we try to
+	os.RemoveAll(filepath.Join(dir, "spool"))
+	os.Remove(tx.LeaseFile)
+	var held TransactionHeldError
+	if err := tx.Start(ctx); !errors.As(err, &held) || held.Holder != HolderUnknown {
+		t.Fatalf("expected a TransactionHeldError, got %v", err)
+	}
+
+	if l, _ := readLease(tx.LeaseFile); l != nil {
+		t.Errorf("expected no lease on failing to start, got %+v", l)
+	}
+
+	// Our own lease is kept if the transaction is not ended
+	if err := writeLease(tx.LeaseFile, tx.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, end := range map[string]func(context.Context) error{"publish": tx.Stop, "abort": tx.Kill} {
+		if err := end(ctx); err == nil || !strings.Contains(err.Error(), name+" refused") {
+			t.Errorf("expected %s to fail, got %v", name, err)
+		}
+
+		if l, _ := readLease(tx.LeaseFile); l == nil {
+			t.Errorf("expected the lease to be kept on failing to %s", name)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package cvmfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/logging"
+)
+
+// Backends of the CVMFS transaction
+const (
+	// BackendServer uses the cvmfs_server binary, locking the whole repo
+	BackendServer = "server"
+
+	// BackendGateway leases the path from the cvmfs-gateway HTTP API
+	BackendGateway = "gateway"
+)
+
+// Backends lists the backends of the CVMFS transaction
+var Backends = []string{BackendServer, BackendGateway}
+
+// gatewayAPIVersion is the version of the gateway API we speak
+const gatewayAPIVersion = "2"
+
+// LeaseBusyError is returned when the gateway lease cannot
+// be acquired, as the path is leased by another publisher
+type LeaseBusyError struct {
+	Path      string
+	Remaining string
+}
+
+func (l LeaseBusyError) Error() string {
+	return fmt.Sprintf("gateway lease on %s is busy (time remaining: %s)", l.Path, l.Remaining)
+}
+
+// NewGatewayTransaction creates a transaction which acquires, from the
+// cvmfs-gateway, a lease on the repository path, publishing the changes
+// made under it on Close. The changes are uploaded to the gateway by
+// the publisher node we run on.
+func NewGatewayTransaction(opts *Opts, log logging.Logger) *GatewayTransaction {
+	t := GatewayTransaction{
+		catalogs: newCatalogs(opts, log),
+		URL:      strings.TrimSuffix(opts.GatewayURL, "/"),
+		KeyFile:  opts.GatewayKeyFile,
+		Repo:     opts.NightlyRepo,
+		Path:     opts.LeasePath,
+		scoped:   opts.ScopeTransactions,
+		log:      log,
+		attempts: opts.MaxTransactionAttempts,
+	}
+
+	t.catalogs.subpath = strings.Trim(t.Path, "/")
+	t.Transaction.Starter = &t
+	t.Transaction.Stopper = &t
+	t.Transaction.Retry = filesystem.NewRetryPolicy(&opts.RetryOpts, opts.MaxTransactionAttempts)
+	return &t
+}
+
+// GatewayTransaction represents a CVMFS transaction held
+// as a lease from the gateway
+type GatewayTransaction struct {
+	filesystem.Transaction
+	catalogs
+	URL      string
+	KeyFile  string
+	Repo     string
+	Path     string
+	scoped   bool
+	subpath  string
+	log      logging.Logger
+	attempts int
+	client   http.Client
+
+	// token is the session token of the lease, once acquired
+	token string
+}
+
+// gatewayReply is the reply of the gateway API
+type gatewayReply struct {
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	SessionToken  string `json:"session_token"`
+	TimeRemaining string `json:"time_remaining"`
+}
+
+// Attempts provides the number of tries allowed for opening the transaction
+func (t *GatewayTransaction) Attempts() int {
+	return t.attempts
+}
+
+// Scope scopes the lease to the deepest directory containing the
+// dirs, if scoping transactions, and that directory is within the repo
+func (t *GatewayTransaction) Scope(dirs ...string) {
+	if t.scoped {
+		t.subpath = subpath(t.Repo, filesystem.CommonDir(dirs...))
+	}
+
+	if t.subpath != "" {
+		t.catalogs.subpath = t.subpath
+	}
+}
+
+// LeasePath returns the repository path leased: the scoped
+// subpath, if any, or the configured path
+func (t *GatewayTransaction) LeasePath() string {
+	path := t.Path
+	if t.subpath != "" {
+		path = t.subpath
+	}
+
+	return strings.TrimSuffix(t.Repo+"/"+strings.Trim(path, "/"), "/")
+}
+
+// Start acquires the lease on the path. If it is already leased,
+// it returns a LeaseBusyError.
+func (t *GatewayTransaction) Start(ctx context.Context) error {
+	body, err := json.Marshal(map[string]string{
+		"path":        t.LeasePath(),
+		"api_version": gatewayAPIVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	reply, err := t.call(ctx, http.MethodPost, "/leases", body, body)
+	if err != nil {
+		return fmt.Errorf("unable to acquire gateway lease on %s (%w)", t.LeasePath(), err)
+	}
+
+	switch reply.Status {
+	case "ok":
+		t.token = reply.SessionToken
+		t.log.Info("Acquired gateway lease", logging.F("path", t.LeasePath()))
+		return nil
+	case "path_busy":
+		return LeaseBusyError{Path: t.LeasePath(), Remaining: reply.TimeRemaining}
+	default:
+		return fmt.Errorf("unable to acquire gateway lease on %s (%s)", t.LeasePath(), reply.Reason)
+	}
+}
+
+// Stop publishes the changes made under the lease, then drops it
+func (t *GatewayTransaction) Stop(ctx context.Context) error {
+	body := []byte("{}")
+	reply, err := t.call(ctx, http.MethodPost, "/leases/"+t.token, body, []byte(t.token))
+	if err == nil && reply.Status != "ok" {
+		err = fmt.Errorf("%s", reply.Reason)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to publish under gateway lease on %s (%w)", t.LeasePath(), err)
+	}
+
+	t.log.Info("Published under gateway lease", logging.F("path", t.LeasePath()))
+	return t.drop(ctx)
+}
+
+// Kill drops the lease, without publishing
+func (t *GatewayTransaction) Kill(ctx context.Context) error {
+	return t.drop(ctx)
+}
+
+// drop drops the lease, if held
+func (t *GatewayTransaction) drop(ctx context.Context) error {
+	if t.token == "" {
+		return nil
+	}
+
+	reply, err := t.call(ctx, http.MethodDelete, "/leases/"+t.token, nil, []byte(t.token))
+	if err == nil && reply.Status != "ok" {
+		err = fmt.Errorf("%s", reply.Reason)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to drop gateway lease on %s (%w)", t.LeasePath(), err)
+	}
+
+	t.token = ""
+	t.log.Info("Dropped gateway lease", logging.F("path", t.LeasePath()))
+	return nil
+}
+
+// call makes the API request, signed with the HMAC of the signed bytes
+func (t *GatewayTransaction) call(ctx context.Context, method, path string, body, signed []byte) (*gatewayReply, error) {
+	keyID, secret, err := readGatewayKey(t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(signed)
+	req.Header.Set("Authorization", keyID+" "+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("gateway replied %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var reply gatewayReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("bad gateway reply (%s): %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	return &reply, nil
+}
+
+// readGatewayKey reads the key ID and secret from the gateway key
+// file, whose format is: plain_text <key id> <secret>
+func readGatewayKey(path string) (string, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read gateway key (%w)", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 || fields[0] != "plain_text" {
+		return "", nil, fmt.Errorf("bad gateway key file %s", path)
+	}
+
+	return fields[1], []byte(fields[2]), nil
+}
@@ -0,0 +1,187 @@
+package cvmfs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+// fakeGateway is a cvmfs-gateway stand-in, leasing paths to requests
+// signed with its key, and recording the publications
+type fakeGateway struct {
+	mu        sync.Mutex
+	secret    string
+	leases    map[string]string // token -> path
+	published []string
+}
+
+func (g *fakeGateway) reply(w http.ResponseWriter, reply map[string]string) {
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	token := strings.TrimPrefix(r.URL.Path, "/api/v1/leases/")
+	signed := []byte(token)
+	if r.URL.Path == "/api/v1/leases" {
+		signed = body
+	}
+
+	mac := hmac.New(sha1.New, []byte(g.secret))
+	mac.Write(signed)
+	if r.Header.Get("Authorization") != "key1 "+base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		g.reply(w, map[string]string{"status": "error", "reason": "invalid_hmac"})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/leases":
+		var req map[string]string
+		json.Unmarshal(body, &req)
+		for _, path := range g.leases {
+			if strings.HasPrefix(req["path"]+"/", path+"/") || strings.HasPrefix(path+"/", req["path"]+"/") {
+				g.reply(w, map[string]string{"status": "path_busy", "time_remaining": "10s"})
+				return
+			}
+		}
+
+		token := req["path"] + ".token"
+		g.leases[token] = req["path"]
+		g.reply(w, map[string]string{"status": "ok", "session_token": token})
+
+	case g.leases[token] == "":
+		g.reply(w, map[string]string{"status": "error", "reason": "invalid_token"})
+
+	case r.Method == http.MethodPost:
+		g.published = append(g.published, g.leases[token])
+		g.reply(w, map[string]string{"status": "ok"})
+
+	case r.Method == http.MethodDelete:
+		delete(g.leases, token)
+		g.reply(w, map[string]string{"status": "ok"})
+	}
+}
+
+func TestGatewayTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gateway := &fakeGateway{secret: "s3cr3t", leases: map[string]string{}}
+	srv := httptest.NewServer(gateway)
+	defer srv.Close()
+
+	keyFile := filepath.Join(dir, "atlas-nightlies.cern.ch.gw")
+	if err := ioutil.WriteFile(keyFile, []byte("plain_text key1 s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newTransaction := func(path string) *GatewayTransaction {
+		return NewGatewayTransaction(&Opts{
+			NightlyRepo:            "atlas-nightlies.cern.ch",
+			GatewayURL:             srv.URL + "/api/v1/",
+			GatewayKeyFile:         keyFile,
+			LeasePath:              path,
+			MaxTransactionAttempts: 1,
+		}, logging.NullLogger{})
+	}
+
+	ctx := context.Background()
+	master := newTransaction("/master/")
+	if err := master.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another branch is leased in parallel, but not the whole repo
+	branch := newTransaction("22.0")
+	if err := branch.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var busy LeaseBusyError
+	if err := newTransaction("").Open(ctx); !errors.As(err, &busy) || busy.Path != "atlas-nightlies.cern.ch" {
+		t.Errorf("expected the whole repo lease to be busy, got %v", err)
+	}
+
+	if err := master.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := branch.Kill(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gateway.leases) != 0 {
+		t.Errorf("expected all leases to be dropped, got %v", gateway.leases)
+	}
+
+	if len(gateway.published) != 1 || gateway.published[0] != "atlas-nightlies.cern.ch/master" {
+		t.Errorf("expected only master to be published, got %v", gateway.published)
+	}
+
+	// Requests with the wrong key are refused
+	ioutil.WriteFile(keyFile, []byte("plain_text key1 wrong\n"), 0600)
+	if err := newTransaction("master").Open(ctx); err == nil || !strings.Contains(err.Error(), "invalid_hmac") {
+		t.Errorf("expected an invalid HMAC error, got %v", err)
+	}
+
+	// HTTP errors are failures, whatever the body
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer broken.Close()
+
+	ioutil.WriteFile(keyFile, []byte("plain_text key1 s3cr3t\n"), 0600)
+	tx := newTransaction("master")
+	tx.URL = broken.URL
+	if err := tx.Open(ctx); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("expected the HTTP error to fail the lease, got %v", err)
+	}
+}
+
+func TestScopedPaths(t *testing.T) {
+	for _, tc := range []struct {
+		dir, expect string
+	}{
+		{"/cvmfs/atlas-nightlies.cern.ch/repo/sw/master_Athena_x86_64", "atlas-nightlies.cern.ch/repo/sw/master_Athena_x86_64"},
+		{"/cvmfs/atlas-nightlies.cern.ch", "atlas-nightlies.cern.ch"},
+		{"/cvmfs/atlas.cern.ch/repo", "atlas-nightlies.cern.ch"},
+		{"/afs/cern.ch/atlas", "atlas-nightlies.cern.ch"},
+	} {
+		opts := &Opts{NightlyRepo: "atlas-nightlies.cern.ch", ScopeTransactions: true}
+		server := NewTransaction(opts, logging.NullLogger{})
+		server.Scope(tc.dir)
+		gateway := NewGatewayTransaction(opts, logging.NullLogger{})
+		gateway.Scope(tc.dir)
+
+		if server.Path() != tc.expect || gateway.LeasePath() != tc.expect {
+			t.Errorf("%s: expected the path %s, got %s and %s", tc.dir, tc.expect, server.Path(), gateway.LeasePath())
+		}
+	}
+
+	// Scoping can be switched off
+	server := NewTransaction(&Opts{NightlyRepo: "atlas-nightlies.cern.ch"}, logging.NullLogger{})
+	server.Scope("/cvmfs/atlas-nightlies.cern.ch/repo/sw")
+	if server.Path() != "atlas-nightlies.cern.ch" {
+		t.Errorf("expected an unscoped transaction, got %s", server.Path())
+	}
+}
@@ -0,0 +1,224 @@
+package cvmfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Holders of an ongoing transaction
+const (
+	// HolderCrashed is a transaction left open by an installer
+	// process on this node which no longer exists
+	HolderCrashed = "crashed"
+
+	// HolderLive is a transaction held by a running installer process
+	HolderLive = "live"
+
+	// HolderUnknown is a transaction opened other than by the installer,
+	// or by an installer on another node
+	HolderUnknown = "unknown"
+)
+
+// lockFiles are the files in the repository spool directory whose
+// existence, depending on the cvmfs_server version, marks a transaction
+var lockFiles = []string{"in_transaction.lock", "in_transaction"}
+
+// TransactionHeldError is returned when a transaction cannot be
+// started, as one is already ongoing in the repository
+type TransactionHeldError struct {
+	Repo   string
+	Path   string
+	Holder string
+	PID    int
+	Host   string
+	Since  time.Time
+
+	// lease is the lease file of the holder, if known
+	lease string
+}
+
+func (t TransactionHeldError) Error() string {
+	path := t.Repo
+	if t.Path != "" {
+		path = t.Path
+	}
+
+	msg := fmt.Sprintf("transaction already ongoing in %s", path)
+	if !t.Since.IsZero() {
+		msg += fmt.Sprintf(" for %s", time.Since(t.Since).Round(time.Second))
+	}
+
+	switch t.Holder {
+	case HolderCrashed:
+		return fmt.Sprintf("%s, left by crashed installer process %d on %s", msg, t.PID, t.Host)
+	case HolderLive:
+		return fmt.Sprintf("%s, held by installer process %d on %s", msg, t.PID, t.Host)
+	default:
+		return fmt.Sprintf("%s, held by an unknown process", msg)
+	}
+}
+
+// leaseSlack is the time allowed between the start
+// of a transaction and the writing of its lease
+const leaseSlack = time.Minute
+
+// lease records the installer process holding the transaction
+type lease struct {
+	PID   int       `json:"pid"`
+	Host  string    `json:"host"`
+	Start time.Time `json:"start"`
+
+	// Path is the repo path of the transaction
+	Path string `json:"path"`
+}
+
+// leaseFile returns the lease file of the transaction, which
+// is distinct per subpath for scoped transactions
+func (t *Transaction) leaseFile() string {
+	if t.subpath == "" {
+		return t.LeaseFile
+	}
+
+	return t.LeaseFile + "." + strings.Replace(t.subpath, "/", "_", -1)
+}
+
+// leaseFiles returns the lease files of the repo
+// transactions, whichever path they are scoped to
+func (t *Transaction) leaseFiles() ([]string, error) {
+	scoped, err := filepath.Glob(t.LeaseFile + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{t.LeaseFile}, scoped...), nil
+}
+
+// readLease returns the lease in the file, or nil if there is none
+func readLease(path string) (*lease, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read transaction lease (%w)", err)
+	}
+
+	var l lease
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("bad transaction lease %s (%w)", path, err)
+	}
+
+	return &l, nil
+}
+
+// writeLease records this process as holding the transaction on the repo path
+func writeLease(path, repoPath string) error {
+	host, _ := os.Hostname()
+	data, err := json.Marshal(&lease{PID: os.Getpid(), Host: host, Start: time.Now(), Path: repoPath})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create transaction lease directory (%w)", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write transaction lease (%w)", err)
+	}
+
+	return nil
+}
+
+// removeLease removes the lease, once the transaction is over
+func removeLease(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove transaction lease (%w)", err)
+	}
+
+	return nil
+}
+
+// held returns the error describing the ongoing transaction of the
+// repository, or nil if there is none. The spool lock is that of the
+// whole repository, whatever path the transaction is scoped to, so
+// the holder is looked for among the leases of all the paths.
+func (t *Transaction) held() (*TransactionHeldError, error) {
+	var since time.Time
+	for _, name := range lockFiles {
+		info, err := os.Stat(filepath.Join(t.SpoolDir, t.Repo, name))
+		if err == nil {
+			since = info.ModTime()
+			break
+		}
+	}
+
+	if since.IsZero() {
+		return nil, nil
+	}
+
+	heldErr := &TransactionHeldError{Repo: t.Repo, Holder: HolderUnknown, Since: since}
+	l, path, err := t.holderLease(since)
+	if err != nil || l == nil {
+		return heldErr, err
+	}
+
+	heldErr.Path, heldErr.lease = l.Path, path
+	heldErr.PID, heldErr.Host, heldErr.Since = l.PID, l.Host, l.Start
+	if host, _ := os.Hostname(); host != l.Host {
+		return heldErr, nil
+	}
+
+	heldErr.Holder = HolderCrashed
+	if alive(l.PID) {
+		heldErr.Holder = HolderLive
+	}
+
+	return heldErr, nil
+}
+
+// holderLease returns the most recent of the leases, and its file, which
+// may be that of the transaction locked since the given time. A lock
+// newer than a lease is not that of the lease holder, whose transaction
+// was ended without removing the lease.
+func (t *Transaction) holderLease(since time.Time) (*lease, string, error) {
+	paths, err := t.leaseFiles()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		holder *lease
+		file   string
+	)
+
+	for _, path := range paths {
+		l, err := readLease(path)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if l == nil || since.After(l.Start.Add(leaseSlack)) {
+			continue
+		}
+
+		if holder == nil || l.Start.After(holder.Start) {
+			holder, file = l, path
+		}
+	}
+
+	return holder, file, nil
+}
+
+// alive indicates if the process exists
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
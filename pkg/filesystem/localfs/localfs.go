@@ -2,6 +2,8 @@ package localfs
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
 	"github.com/brinick/logging"
@@ -13,11 +15,14 @@ import (
 // no error was returned.
 func NewTransaction(opts *Opts, log logging.Logger) *Transaction {
 	t := Transaction{
+		Snapshot: opts.Snapshot,
+		log:      log,
 		attempts: opts.MaxTransactionAttempts,
 	}
 
 	t.Transaction.Starter = &t
 	t.Transaction.Stopper = &t
+	t.Transaction.Retry = filesystem.NewRetryPolicy(&opts.RetryOpts, opts.MaxTransactionAttempts)
 	return &t
 }
 
@@ -28,16 +33,195 @@ type Opts struct {
 
 	// How many times we try to open our own localFS transaction
 	MaxTransactionAttempts int `json:"max_transaction_open_attempts"`
+
+	// Policy for retrying to open the transaction
+	filesystem.RetryOpts
+
+	// Snapshot the nightly directories, so that killing
+	// the transaction restores them as they were
+	Snapshot bool `json:"snapshot"`
 }
 
-// Transaction represents a local filesystem transaction
+// Transaction represents a local filesystem transaction. If snapshotting
+// the nightly directories, it gives all-or-nothing installs:
+// each directory is copied on start, the copies are dropped on close,
+// and swapped back in place of the directories on kill.
 type Transaction struct {
 	filesystem.Transaction
+	Snapshot bool
+	dirs     []*snapshot
+	log      logging.Logger
 	attempts int
 }
 
+// snapshot is the copy of a directory taken on start
+type snapshot struct {
+	dir     string
+	existed bool
+}
+
+// Attempts provides the number of tries allowed for opening the transaction
+func (t *Transaction) Attempts() int {
+	return t.attempts
+}
+
+// SnapshotDirs sets the directories snapshot on start: those of the
+// nightlies, rather than all those written, as snapshots are copies.
+// Directories within others are covered by their snapshot.
+func (t *Transaction) SnapshotDirs(dirs ...string) {
+	t.dirs = nil
+	for _, dir := range filesystem.OutermostDirs(dirs...) {
+		t.dirs = append(t.dirs, &snapshot{dir: dir})
+	}
+}
+
+// Start snapshots the directories to which the transaction is scoped,
+// first restoring any snapshot left by an earlier crashed transaction
+func (t *Transaction) Start(ctx context.Context) error {
+	if !t.Snapshot {
+		return nil
+	}
+
+	for i, s := range t.dirs {
+		if err := t.take(ctx, s); err != nil {
+			// Those taken are dropped, to be taken again on retrying
+			t.drop(t.dirs[:i])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// take snapshots the directory, if it exists. The copy is made under a
+// temporary name, renamed to that of the snapshot once complete, so that
+// a crash mid-copy never leaves a partial snapshot to be restored.
+func (t *Transaction) take(ctx context.Context, s *snapshot) error {
+	if err := t.recover(s.dir); err != nil {
+		return err
+	}
+
+	var err error
+	s.existed, err = filesystem.Exists(s.dir)
+	if err != nil || !s.existed {
+		return err
+	}
+
+	t.log.Info("Snapshotting", logging.F("dir", s.dir), logging.F("snapshot", snapshotDir(s.dir)))
+	partial := partialDir(s.dir)
+	if err := filesystem.CopyTree(ctx, s.dir, partial); err != nil {
+		os.RemoveAll(partial)
+		return fmt.Errorf("unable to snapshot %s (%w)", s.dir, err)
+	}
+
+	if err := os.Rename(partial, snapshotDir(s.dir)); err != nil {
+		os.RemoveAll(partial)
+		return fmt.Errorf("unable to complete the snapshot of %s (%w)", s.dir, err)
+	}
+
+	return nil
+}
+
+// Stop publishes the changes, dropping the snapshots
+func (t *Transaction) Stop(ctx context.Context) error {
+	if !t.Snapshot {
+		return nil
+	}
+
+	return t.drop(t.dirs)
+}
+
+// drop removes the snapshots of the directories
+func (t *Transaction) drop(dirs []*snapshot) error {
+	for _, s := range dirs {
+		if err := os.RemoveAll(snapshotDir(s.dir)); err != nil {
+			return fmt.Errorf("unable to remove the snapshot of %s (%w)", s.dir, err)
+		}
+	}
+
+	return nil
+}
+
 // Kill will halt the ongoing transaction forcefully
-// exiting without publishing
+// exiting without publishing: the directories are
+// restored as they were when the transaction started
 func (t *Transaction) Kill(ctx context.Context) error {
+	if !t.Snapshot {
+		return nil
+	}
+
+	var firstErr error
+	for _, s := range t.dirs {
+		if err := t.rollback(s); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// rollback restores the directory from its snapshot,
+// or removes it if it did not exist on start
+func (t *Transaction) rollback(s *snapshot) error {
+	t.log.Info("Restoring snapshot", logging.F("dir", s.dir))
+	if !s.existed {
+		if err := os.RemoveAll(s.dir); err != nil {
+			return fmt.Errorf("unable to remove %s (%w)", s.dir, err)
+		}
+		return nil
+	}
+
+	return restore(s.dir)
+}
+
+// recover restores the snapshot left by a transaction which was neither
+// closed nor killed, and so may have left the directory half-written.
+// A snapshot whose copy never completed is discarded: the directory
+// was not yet written to.
+func (t *Transaction) recover(dir string) error {
+	if err := os.RemoveAll(partialDir(dir)); err != nil {
+		return fmt.Errorf("unable to remove the partial snapshot of %s (%w)", dir, err)
+	}
+
+	found, err := filesystem.Exists(snapshotDir(dir))
+	if err != nil || !found {
+		return err
+	}
+
+	t.log.Info("Restoring the snapshot of an unfinished transaction", logging.F("dir", dir))
+	return restore(dir)
+}
+
+// restore atomically swaps the snapshot in place of the directory
+func restore(dir string) error {
+	killed := dir + ".killed"
+	if err := os.RemoveAll(killed); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, killed); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to move %s aside (%w)", dir, err)
+	}
+
+	if err := os.Rename(snapshotDir(dir), dir); err != nil {
+		return fmt.Errorf("unable to restore the snapshot of %s (%w)", dir, err)
+	}
+
+	if err := os.RemoveAll(killed); err != nil {
+		return fmt.Errorf("unable to remove %s (%w)", killed, err)
+	}
+
 	return nil
 }
+
+// snapshotDir is the directory holding the snapshot. It sits next
+// to the directory, on the same file system, so that the
+// snapshot can be renamed back in its place.
+func snapshotDir(dir string) string {
+	return dir + ".snapshot"
+}
+
+// partialDir is the directory holding the snapshot while it is copied
+func partialDir(dir string) string {
+	return snapshotDir(dir) + ".partial"
+}
@@ -0,0 +1,213 @@
+package localfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+// makeNightly creates a nightly dir with an installed release
+func makeNightly(t *testing.T, base string) string {
+	dir := filepath.Join(base, "master_Athena_x86_64")
+	old := filepath.Join(dir, "2020-04-01T2101")
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(old, "setup.sh"), []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("2020-04-01T2101", filepath.Join(dir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// install mimics the install of a new release, cleaning the old
+func install(t *testing.T, dir string) {
+	if err := os.RemoveAll(filepath.Join(dir, "2020-04-01T2101")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "2020-04-02T2101"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openTransaction(t *testing.T, dir string) *Transaction {
+	tr := NewTransaction(&Opts{MaxTransactionAttempts: 1, Snapshot: true}, logging.NullLogger{})
+	tr.SnapshotDirs(dir)
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return tr
+}
+
+func TestKillRestores(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir := makeNightly(t, base)
+	tr := openTransaction(t, dir)
+	install(t, dir)
+
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "latest", "setup.sh"))
+	if err != nil || string(data) != "old" {
+		t.Errorf("expected the old release to be restored, got %q (%v)", data, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "latest", "setup.sh"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected the file mode to be restored, got %v (%v)", info, err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "2020-04-02T2101"), snapshotDir(dir), dir + ".killed"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+}
+
+func TestCloseKeeps(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir := makeNightly(t, base)
+	tr := openTransaction(t, dir)
+	install(t, dir)
+
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2020-04-02T2101")); err != nil {
+		t.Errorf("expected the new release to be kept (%v)", err)
+	}
+
+	if _, err := os.Stat(snapshotDir(dir)); !os.IsNotExist(err) {
+		t.Errorf("expected the snapshot to be removed")
+	}
+}
+
+func TestNewDirKilled(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir := filepath.Join(base, "master_Athena_x86_64")
+	tr := openTransaction(t, dir)
+	install(t, dir)
+
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the new nightly dir to be removed")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	// A crash mid-install leaves the snapshot behind
+	dir := makeNightly(t, base)
+	openTransaction(t, dir)
+	install(t, dir)
+
+	tr := openTransaction(t, dir)
+	if _, err := os.Stat(filepath.Join(dir, "2020-04-01T2101", "setup.sh")); err != nil {
+		t.Errorf("expected the crashed install to be undone (%v)", err)
+	}
+
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverDiscardsPartialSnapshot(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	// A crash mid-copy leaves a partial snapshot behind
+	dir := makeNightly(t, base)
+	if err := os.MkdirAll(partialDir(dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := openTransaction(t, dir)
+	if _, err := os.Stat(filepath.Join(dir, "latest", "setup.sh")); err != nil {
+		t.Errorf("expected the directory to be left as it was (%v)", err)
+	}
+
+	if _, err := os.Stat(partialDir(dir)); !os.IsNotExist(err) {
+		t.Errorf("expected the partial snapshot to be removed")
+	}
+
+	if _, err := os.Stat(filepath.Join(snapshotDir(dir), "latest", "setup.sh")); err != nil {
+		t.Errorf("expected a complete snapshot (%v)", err)
+	}
+
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKillRestoresEachDir(t *testing.T) {
+	base, err := ioutil.TempDir("", "localfs.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir := makeNightly(t, base)
+	prefix := filepath.Join(base, "2020-04-02T2101")
+	tr := NewTransaction(&Opts{MaxTransactionAttempts: 1, Snapshot: true}, logging.NullLogger{})
+	tr.SnapshotDirs(dir, prefix, filepath.Join(dir, "2020-04-01T2101"))
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	install(t, dir)
+	if err := os.MkdirAll(filepath.Join(prefix, "Athena"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2020-04-01T2101", "setup.sh")); err != nil {
+		t.Errorf("expected the old release to be restored (%v)", err)
+	}
+
+	if _, err := os.Stat(prefix); !os.IsNotExist(err) {
+		t.Errorf("expected the new relocation prefix to be removed")
+	}
+}
@@ -2,8 +2,8 @@ package filesystem
 
 import (
 	"context"
-	"errors"
-	"time"
+	"path/filepath"
+	"strings"
 )
 
 // Transactioner defines the interface for file system transactions
@@ -35,6 +35,84 @@ type aborter interface {
 	Kill(context.Context) error
 }
 
+// Scoper is implemented by transactioners able to scope the transaction
+// to the directories written, rather than the whole file system
+type Scoper interface {
+	Scope(dirs ...string)
+}
+
+// Snapshotter is implemented by transactioners able to snapshot
+// directories on opening, so as to restore them if killed
+type Snapshotter interface {
+	SnapshotDirs(dirs ...string)
+}
+
+// Cataloger is implemented by transactioners publishing file catalogs,
+// which may be nested in the directories installed
+type Cataloger interface {
+	NestCatalogs(dirs ...string) error
+}
+
+// Scope scopes the transaction, if the transactioner is able to, to the dirs
+func Scope(t Transactioner, dirs ...string) {
+	s, ok := t.(Scoper)
+	if !ok || len(dirs) == 0 {
+		return
+	}
+
+	s.Scope(dirs...)
+}
+
+// SnapshotDirs has the transaction, if the transactioner
+// is able to, snapshot the dirs on opening
+func SnapshotDirs(t Transactioner, dirs ...string) {
+	if s, ok := t.(Snapshotter); ok {
+		s.SnapshotDirs(dirs...)
+	}
+}
+
+// CommonDir returns the deepest directory containing all the dirs
+func CommonDir(dirs ...string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+
+	common := strings.Split(filepath.Clean(dirs[0]), string(filepath.Separator))
+	for _, dir := range dirs[1:] {
+		parts := strings.Split(filepath.Clean(dir), string(filepath.Separator))
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+
+	return strings.Join(common, string(filepath.Separator))
+}
+
+// OutermostDirs returns the dirs, without duplicates
+// nor those within another of the dirs
+func OutermostDirs(dirs ...string) []string {
+	var outer []string
+	for i, dir := range dirs {
+		dir = filepath.Clean(dir)
+		within := false
+		for j, other := range dirs {
+			other = filepath.Clean(other)
+			if CommonDir(dir, other) == other && (dir != other || j < i) {
+				within = true
+				break
+			}
+		}
+
+		if !within {
+			outer = append(outer, dir)
+		}
+	}
+
+	return outer
+}
+
 // Transaction is the base struct for transactions which specific
 // transaction handlers should embed
 type Transaction struct {
@@ -42,44 +120,28 @@ type Transaction struct {
 	Starter starter
 	Stopper stopper
 	Aborter aborter
+
+	// Retry is the policy for retrying to open the transaction,
+	// by default making Attempts() attempts, 10 seconds apart
+	Retry *RetryPolicy
 }
 
-// Open is the handler for opening a transaction
+// Open is the handler for opening a transaction, retrying
+// according to the retry policy
 func (t *Transaction) Open(ctx context.Context) error {
 	if t.ongoing {
 		return nil
 	}
 
-	var (
-		err      error
-		attempts = t.Attempts()
-	)
-
-	for attempts > 0 {
-		err := t.Starter.Start(ctx)
-
-		// We break and return if no error returned (transaction opened ok),
-		// or the error is a context cancel/deadline related one. Any other
-		// error implies trying again to open the transaction.
-		if err == nil ||
-			errors.Is(err, context.Canceled) ||
-			errors.Is(err, context.DeadlineExceeded) {
-			// set ongoing true only if no error was returned
-			t.ongoing = (err == nil)
-			break
-		}
-
-		attempts--
-
-		// TODO: communicate the attempts?
-		// Wait 10 seconds (interruptible) between transaction attempts
-		select {
-		case <-time.After(time.Second * time.Duration(10)):
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	policy := t.Retry
+	if policy == nil {
+		policy = defaultRetryPolicy(t.Starter.Attempts())
 	}
 
+	err := policy.Do(ctx, t.Starter.Start)
+
+	// set ongoing true only if no error was returned
+	t.ongoing = (err == nil)
 	return err
 }
 
@@ -0,0 +1,30 @@
+package filesystem
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCommonDir(t *testing.T) {
+	for _, tc := range []struct {
+		dirs   []string
+		expect string
+	}{
+		{[]string{"/cvmfs/repo/sw/master_Athena_x86_64"}, "/cvmfs/repo/sw/master_Athena_x86_64"},
+		{[]string{"/cvmfs/repo/sw/master_Athena", "/cvmfs/repo/sw/master_AthSimulation/"}, "/cvmfs/repo/sw"},
+		{[]string{"/cvmfs/repo/sw/master", "/cvmfs/repo/sw/master/x"}, "/cvmfs/repo/sw/master"},
+		{[]string{"/cvmfs/repo/a", "/afs/b"}, ""},
+	} {
+		if dir := CommonDir(tc.dirs...); dir != tc.expect {
+			t.Errorf("%v: expected the common dir %q, got %q", tc.dirs, tc.expect, dir)
+		}
+	}
+}
+
+func TestOutermostDirs(t *testing.T) {
+	dirs := []string{"/sw/master/x", "/sw/lcg", "/sw/master", "/sw/lcg/", "/sw/master_Athena"}
+	expect := []string{"/sw/lcg", "/sw/master", "/sw/master_Athena"}
+	if got := OutermostDirs(dirs...); fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expected the outermost dirs %v, got %v", expect, got)
+	}
+}
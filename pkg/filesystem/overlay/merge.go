@@ -0,0 +1,183 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+)
+
+const (
+	// whiteoutPrefix marks the files deleted from the lower
+	// dir, when whiteout devices cannot be created
+	whiteoutPrefix = ".wh."
+
+	// opaqueFile marks a directory hiding the lower dir content
+	opaqueFile = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// opaqueXattrs are the attributes with which the kernel,
+// and fuse-overlayfs, mark opaque directories
+var opaqueXattrs = []string{
+	"trusted.overlay.opaque",
+	"user.overlay.opaque",
+	"user.fuseoverlayfs.opaque",
+}
+
+// merge applies the changes recorded in the upper layer to the lower dir:
+// new and modified entries are copied, and whiteouts, i.e. deletions,
+// are removed from the lower dir, as are the contents of opaque dirs.
+func merge(ctx context.Context, upper, lower string) error {
+	return filepath.Walk(upper, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(upper, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		target := filepath.Join(lower, rel)
+		name := info.Name()
+
+		switch mode := info.Mode(); {
+		case name == opaqueFile:
+			return nil
+
+		case isWhiteout(info):
+			return os.RemoveAll(filepath.Join(filepath.Dir(target), strings.TrimPrefix(name, whiteoutPrefix)))
+
+		case mode.IsDir():
+			return mergeDir(path, target, mode.Perm())
+
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case mode.IsRegular():
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			return filesystem.CopyFile(path, target, mode.Perm())
+		}
+
+		return fmt.Errorf("unable to merge %s, of unsupported type %s", path, info.Mode())
+	})
+}
+
+// Access modes checked by checkAccess
+const (
+	readable = 0x4
+	writable = 0x2
+)
+
+// checkAccess returns an error if this process is unable to merge the upper
+// layer. The layer is written through a mount made as the sudo user, so
+// its entries may not be readable, nor the lower dirs writable, by the
+// user running the installer. Checking first keeps the lower dir from
+// being left partly merged for lack of permissions.
+func checkAccess(upper, lower string) error {
+	return filepath.Walk(upper, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		if err := syscall.Access(path, readable); err != nil {
+			return fmt.Errorf("unable to read %s (%w)", path, err)
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(upper, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(lower, rel)
+		if err := syscall.Access(target, writable); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to write to %s (%w)", target, err)
+		}
+
+		return nil
+	})
+}
+
+// mergeDir creates the dir in the lower dir, emptying it if opaque
+func mergeDir(path, target string, mode os.FileMode) error {
+	info, err := os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case !info.IsDir() || isOpaque(path):
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	default:
+		return os.Chmod(target, mode)
+	}
+
+	if err := os.Mkdir(target, mode); err != nil {
+		return err
+	}
+
+	// The mode given on creation is masked by the umask
+	return os.Chmod(target, mode)
+}
+
+// isWhiteout reports if the upper layer entry records a deletion:
+// a 0/0 character device, or a file with the whiteout prefix
+func isWhiteout(info os.FileInfo) bool {
+	if strings.HasPrefix(info.Name(), whiteoutPrefix) {
+		return true
+	}
+
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// isOpaque reports if the upper layer dir hides the lower dir content
+func isOpaque(dir string) bool {
+	if found, _ := filesystem.Exists(filepath.Join(dir, opaqueFile)); found {
+		return true
+	}
+
+	value := make([]byte, 1)
+	for _, attr := range opaqueXattrs {
+		if n, err := syscall.Getxattr(dir, attr, value); err == nil && n == 1 && value[0] == 'y' {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,265 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem"
+	"github.com/brinick/atlas-rpm-installer/pkg/filesystem/localfs"
+	"github.com/brinick/logging"
+)
+
+// The ways in which the overlay is made
+const (
+	// ModeKernel mounts a kernel overlay, requiring root
+	ModeKernel = "kernel"
+
+	// ModeFuse mounts the overlay with fuse-overlayfs
+	ModeFuse = "fuse"
+
+	// ModeCopy mounts nothing, but snapshots the lower dir
+	// by copy, for unprivileged nodes without fuse
+	ModeCopy = "copy"
+)
+
+// Modes are the ways in which the overlay may be made
+var Modes = []string{ModeKernel, ModeFuse, ModeCopy}
+
+// mergeJournal marks, in the layers dir, a closed transaction whose
+// upper layer is being merged into the lower dir. Merging is idempotent,
+// so a merge failing midway is resumed by the next transaction.
+const mergeJournal = "merging"
+
+// NewTransaction will create a transaction object and call
+// its open() method. The transaction Close() method should
+// be deferred immediately after calling this, assuming
+// no error was returned.
+func NewTransaction(opts *Opts, log logging.Logger) *Transaction {
+	t := Transaction{
+		Runner:     filesystem.NewShellRunner(log),
+		Mode:       opts.Mode,
+		Lower:      opts.Lower,
+		WorkDir:    opts.WorkDir,
+		SudoUser:   opts.SudoUser,
+		FuseBinary: opts.FuseBinary,
+		log:        log,
+		attempts:   opts.MaxTransactionAttempts,
+	}
+
+	t.Transaction.Starter = &t
+	t.Transaction.Stopper = &t
+	t.Transaction.Retry = filesystem.NewRetryPolicy(&opts.RetryOpts, opts.MaxTransactionAttempts)
+	return &t
+}
+
+// Opts configures the transaction
+type Opts struct {
+	// User with the necessary rights to mount the overlay
+	SudoUser string `json:"sudo_user"`
+
+	// How many times we try to open the overlay transaction
+	MaxTransactionAttempts int `json:"max_transaction_open_attempts"`
+
+	// Policy for retrying to open the transaction
+	filesystem.RetryOpts
+
+	// Mode is how the overlay is made, one of Modes
+	Mode string `json:"mode"`
+
+	// Lower is the dir overlaid, unless the transaction is scoped
+	Lower string `json:"lower"`
+
+	// WorkDir holds the upper layer, and the overlay work dir
+	WorkDir string `json:"work_dir"`
+
+	// FuseBinary is the path to fuse-overlayfs
+	FuseBinary string `json:"fuse_binary"`
+}
+
+// Transaction represents an overlay transaction: an overlay is
+// mounted over the lower dir, so that changes are written to the
+// upper layer. On close, the upper layer is merged into the lower
+// dir, while on kill it is discarded. A merge failing midway is
+// resumed on the next start.
+type Transaction struct {
+	filesystem.Transaction
+	Runner     filesystem.Runner
+	Mode       string
+	Lower      string
+	WorkDir    string
+	SudoUser   string
+	FuseBinary string
+	snapshot   *localfs.Transaction
+	log        logging.Logger
+	attempts   int
+}
+
+// Attempts provides the number of tries allowed for opening the transaction
+func (t *Transaction) Attempts() int {
+	return t.attempts
+}
+
+// Scope overlays the deepest directory containing
+// the dirs, rather than the whole lower dir
+func (t *Transaction) Scope(dirs ...string) {
+	t.Lower = filesystem.CommonDir(dirs...)
+}
+
+// Start mounts the overlay over the lower dir, with an empty upper layer
+func (t *Transaction) Start(ctx context.Context) error {
+	if t.Mode == ModeCopy {
+		t.snapshot = localfs.NewTransaction(&localfs.Opts{Snapshot: true}, t.log)
+		t.snapshot.SnapshotDirs(t.Lower)
+		return t.snapshot.Start(ctx)
+	}
+
+	if err := t.recover(ctx); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{t.upperDir(), t.workDir(), t.Lower} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("unable to create overlay dir %s (%w)", dir, err)
+		}
+	}
+
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", t.Lower, t.upperDir(), t.workDir())
+	cmd := fmt.Sprintf("mount -t overlay overlay -o %s %s", options, t.Lower)
+	if t.Mode == ModeFuse {
+		cmd = fmt.Sprintf("%s -o %s %s", t.FuseBinary, options, t.Lower)
+	}
+
+	t.log.Info("Mounting overlay", logging.F("lower", t.Lower), logging.F("upper", t.upperDir()))
+	if _, err := t.Runner.Run(ctx, t.sudo(cmd)); err != nil {
+		return fmt.Errorf("unable to mount the overlay over %s (%w)", t.Lower, err)
+	}
+
+	return nil
+}
+
+// Stop unmounts the overlay, and merges the upper layer into the lower dir
+func (t *Transaction) Stop(ctx context.Context) error {
+	if t.Mode == ModeCopy {
+		return t.snapshot.Stop(ctx)
+	}
+
+	if err := t.unmount(ctx); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(t.journal(), nil, 0644); err != nil {
+		return fmt.Errorf("unable to journal the overlay merge (%w)", err)
+	}
+
+	return t.merge(ctx)
+}
+
+// merge merges the upper layer into the lower dir, removing the layers
+// once done. On failure, the layers and journal are kept, for the
+// merge to be resumed by the next transaction.
+func (t *Transaction) merge(ctx context.Context) error {
+	t.log.Info("Merging overlay", logging.F("lower", t.Lower), logging.F("upper", t.upperDir()))
+	if err := checkAccess(t.upperDir(), t.Lower); err != nil {
+		return fmt.Errorf("unable to merge the overlay into %s, keeping %s (%w)", t.Lower, t.upperDir(), err)
+	}
+
+	if err := merge(ctx, t.upperDir(), t.Lower); err != nil {
+		return fmt.Errorf("unable to merge the overlay into %s, keeping %s (%w)", t.Lower, t.upperDir(), err)
+	}
+
+	return t.removeLayers()
+}
+
+// recover resumes the merge of a closed transaction which failed midway,
+// or else discards any layer left by a crashed transaction
+func (t *Transaction) recover(ctx context.Context) error {
+	found, err := filesystem.Exists(t.journal())
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return t.removeLayers()
+	}
+
+	t.log.Info("Resuming the merge of a closed transaction", logging.F("lower", t.Lower))
+	return t.merge(ctx)
+}
+
+// Kill will halt the ongoing transaction forcefully
+// exiting without publishing: the upper layer is
+// discarded, leaving the lower dir untouched
+func (t *Transaction) Kill(ctx context.Context) error {
+	if t.Mode == ModeCopy {
+		if t.snapshot == nil {
+			return nil
+		}
+		return t.snapshot.Kill(ctx)
+	}
+
+	// The lower dir of a closed transaction is partly merged: the
+	// upper layer is kept, for the merge to be resumed
+	if found, _ := filesystem.Exists(t.journal()); found {
+		t.log.Info("Overlay merge pending, keeping the upper layer", logging.F("upper", t.upperDir()))
+		return nil
+	}
+
+	if err := t.unmount(ctx); err != nil {
+		return err
+	}
+
+	return t.removeLayers()
+}
+
+func (t *Transaction) unmount(ctx context.Context) error {
+	cmd := fmt.Sprintf("umount %s", t.Lower)
+	if t.Mode == ModeFuse {
+		cmd = fmt.Sprintf("fusermount -u %s", t.Lower)
+	}
+
+	if _, err := t.Runner.Run(ctx, t.sudo(cmd)); err != nil {
+		return fmt.Errorf("unable to unmount the overlay over %s (%w)", t.Lower, err)
+	}
+
+	return nil
+}
+
+// removeLayers removes the upper layer and work dir
+func (t *Transaction) removeLayers() error {
+	if err := os.RemoveAll(t.layersDir()); err != nil {
+		return fmt.Errorf("unable to remove the overlay layers in %s (%w)", t.layersDir(), err)
+	}
+
+	return nil
+}
+
+// layersDir holds the upper layer and work dir of the lower dir
+func (t *Transaction) layersDir() string {
+	name := strings.Trim(strings.ReplaceAll(t.Lower, string(filepath.Separator), "_"), "_")
+	return filepath.Join(t.WorkDir, name)
+}
+
+func (t *Transaction) upperDir() string {
+	return filepath.Join(t.layersDir(), "upper")
+}
+
+func (t *Transaction) workDir() string {
+	return filepath.Join(t.layersDir(), "work")
+}
+
+func (t *Transaction) journal() string {
+	return filepath.Join(t.layersDir(), mergeJournal)
+}
+
+// sudo returns the command run as the sudo user, if any
+func (t *Transaction) sudo(cmd string) string {
+	if t.SudoUser == "" {
+		return cmd
+	}
+
+	return fmt.Sprintf("sudo -u %s %s", t.SudoUser, cmd)
+}
@@ -0,0 +1,255 @@
+package overlay
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+// fakeRunner records the commands run
+type fakeRunner struct {
+	cmds []string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, cmd string) (string, error) {
+	f.cmds = append(f.cmds, cmd)
+	return "", nil
+}
+
+// writeFiles creates the files, with their content, under the dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	lower, upper := filepath.Join(base, "lower"), filepath.Join(base, "upper")
+	writeFiles(t, lower, map[string]string{
+		"kept":             "lower",
+		"modified":         "lower",
+		"deleted":          "lower",
+		"opaque/hidden":    "lower",
+		"2020-04-01/setup": "lower",
+		"replaced/by-file": "lower",
+		"unchanged/setup":  "lower",
+	})
+
+	writeFiles(t, upper, map[string]string{
+		"modified":             "upper",
+		".wh.deleted":          "",
+		".wh.2020-04-01":       "",
+		"opaque/" + opaqueFile: "",
+		"opaque/shown":         "upper",
+		"replaced":             "upper",
+		"2020-04-02/setup":     "upper",
+	})
+
+	if err := os.Symlink("2020-04-02", filepath.Join(upper, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := merge(context.Background(), upper, lower); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expect := range map[string]string{
+		"kept":            "lower",
+		"modified":        "upper",
+		"opaque/shown":    "upper",
+		"replaced":        "upper",
+		"latest/setup":    "upper",
+		"unchanged/setup": "lower",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(lower, name))
+		if err != nil || string(data) != expect {
+			t.Errorf("%s: expected %q, got %q (%v)", name, expect, data, err)
+		}
+	}
+
+	for _, name := range []string{"deleted", "2020-04-01", "opaque/hidden", "opaque/" + opaqueFile, ".wh.deleted"} {
+		if _, err := os.Lstat(filepath.Join(lower, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+}
+
+func newTestTransaction(base, mode string, runner *fakeRunner) *Transaction {
+	tr := NewTransaction(
+		&Opts{
+			MaxTransactionAttempts: 1,
+			Mode:                   mode,
+			Lower:                  filepath.Join(base, "sw"),
+			WorkDir:                filepath.Join(base, "work"),
+			FuseBinary:             "fuse-overlayfs",
+		},
+		logging.NullLogger{},
+	)
+
+	tr.Runner = runner
+	return tr
+}
+
+func TestMount(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	runner := &fakeRunner{}
+	tr := newTestTransaction(base, ModeFuse, runner)
+	tr.Scope(filepath.Join(base, "sw", "master_Athena_x86_64"))
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a mount, write what the install would to the upper layer
+	writeFiles(t, tr.upperDir(), map[string]string{"2020-04-02/setup": "upper"})
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lower := filepath.Join(base, "sw", "master_Athena_x86_64")
+	expect := []string{
+		"fuse-overlayfs -o lowerdir=" + lower + ",upperdir=" + tr.upperDir() + ",workdir=" + tr.workDir() + " " + lower,
+		"fusermount -u " + lower,
+	}
+
+	if len(runner.cmds) != len(expect) || runner.cmds[0] != expect[0] || runner.cmds[1] != expect[1] {
+		t.Errorf("expected to run %q, ran %q", expect, runner.cmds)
+	}
+
+	if _, err := os.Stat(filepath.Join(lower, "2020-04-02", "setup")); err != nil {
+		t.Errorf("expected the upper layer to be merged (%v)", err)
+	}
+
+	if _, err := os.Stat(tr.layersDir()); !os.IsNotExist(err) {
+		t.Errorf("expected the layers to be removed")
+	}
+}
+
+func TestKillDiscards(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	runner := &fakeRunner{}
+	tr := newTestTransaction(base, ModeKernel, runner)
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, tr.upperDir(), map[string]string{"2020-04-02/setup": "upper"})
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tr.Lower, "2020-04-02")); !os.IsNotExist(err) {
+		t.Errorf("expected the upper layer not to be merged")
+	}
+
+	if _, err := os.Stat(tr.layersDir()); !os.IsNotExist(err) {
+		t.Errorf("expected the layers to be removed")
+	}
+
+	if expect := "umount " + tr.Lower; runner.cmds[len(runner.cmds)-1] != expect {
+		t.Errorf("expected to run %q, ran %q", expect, runner.cmds)
+	}
+}
+
+func TestCopyMode(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	runner := &fakeRunner{}
+	tr := newTestTransaction(base, ModeCopy, runner)
+	writeFiles(t, tr.Lower, map[string]string{"2020-04-01/setup": "lower"})
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, tr.Lower, map[string]string{"2020-04-01/setup": "half-written"})
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tr.Lower, "2020-04-01", "setup"))
+	if err != nil || string(data) != "lower" {
+		t.Errorf("expected the lower dir to be restored, got %q (%v)", data, err)
+	}
+
+	if len(runner.cmds) != 0 {
+		t.Errorf("expected nothing to be mounted, ran %q", runner.cmds)
+	}
+}
+
+func TestMergeResumed(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	runner := &fakeRunner{}
+	tr := newTestTransaction(base, ModeFuse, runner)
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fifo, of a type not merged, fails the merge midway
+	writeFiles(t, tr.upperDir(), map[string]string{"2020-04-02/setup": "upper"})
+	fifo := filepath.Join(tr.upperDir(), "2020-04-02", "zfifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Close(context.Background()); err == nil {
+		t.Fatal("expected the merge to fail")
+	}
+
+	if err := tr.Kill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(tr.journal()); err != nil {
+		t.Fatalf("expected the layers to be kept with the merge journal (%v)", err)
+	}
+
+	// The next transaction resumes the merge
+	os.Remove(fifo)
+	if err := tr.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tr.Lower, "2020-04-02", "setup")); err != nil {
+		t.Errorf("expected the upper layer to be merged (%v)", err)
+	}
+
+	if _, err := os.Stat(tr.journal()); !os.IsNotExist(err) {
+		t.Errorf("expected the merge journal to be removed")
+	}
+}
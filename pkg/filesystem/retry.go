@@ -0,0 +1,148 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryOpts configures the retry policy of opening a transaction,
+// and are embedded in the Opts of each transactioner
+type RetryOpts struct {
+	// InitialDelay is the number of seconds before the first retry
+	InitialDelay int `json:"retry_initial_delay"`
+
+	// Multiplier multiplies the delay after each retry
+	Multiplier float64 `json:"retry_multiplier"`
+
+	// Jitter randomly varies each delay by up to this fraction of it
+	Jitter float64 `json:"retry_jitter"`
+
+	// MaxDelay caps the number of seconds between attempts (0: no cap)
+	MaxDelay int `json:"retry_max_delay"`
+
+	// MaxElapsed is the number of seconds after which to stop
+	// retrying, whatever the attempts left (0: no limit)
+	MaxElapsed int `json:"retry_max_elapsed"`
+
+	// Retryable, if set, decides which errors are retried, other
+	// than context ones, which never are. By default, all are.
+	Retryable func(error) bool `json:"-"`
+
+	// OnAttempt, if set, is called after each attempt
+	OnAttempt func(Attempt) `json:"-"`
+}
+
+// Attempt reports an attempt to open a transaction
+type Attempt struct {
+	// Number of the attempt, from 1
+	Number int
+
+	// Err is the error of the attempt, if any
+	Err error
+
+	// Retry indicates if another attempt will be made, after Delay
+	Retry bool
+	Delay time.Duration
+
+	// Elapsed is the time since the first attempt started
+	Elapsed time.Duration
+}
+
+// NewRetryPolicy returns the policy making up to maxAttempts attempts
+func NewRetryPolicy(opts *RetryOpts, maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:  maxAttempts,
+		InitialDelay: time.Duration(opts.InitialDelay) * time.Second,
+		Multiplier:   opts.Multiplier,
+		Jitter:       opts.Jitter,
+		MaxDelay:     time.Duration(opts.MaxDelay) * time.Second,
+		MaxElapsed:   time.Duration(opts.MaxElapsed) * time.Second,
+		Retryable:    opts.Retryable,
+		OnAttempt:    opts.OnAttempt,
+	}
+}
+
+// RetryPolicy decides whether, and when, to retry opening a transaction
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxDelay     time.Duration
+	MaxElapsed   time.Duration
+	Retryable    func(error) bool
+	OnAttempt    func(Attempt)
+}
+
+// defaultRetryPolicy makes the attempts 10 seconds apart
+func defaultRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: attempts, InitialDelay: 10 * time.Second, Multiplier: 1}
+}
+
+// Delay returns the wait after the given attempt, before the next one
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	return time.Duration(delay)
+}
+
+// Do calls fn until it succeeds, returns an error not to be
+// retried, or the policy gives up, returning the last error
+func (p *RetryPolicy) Do(ctx context.Context, fn func(context.Context) error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+
+		report := Attempt{Number: attempt, Err: err}
+		if p.retry(err, attempt) {
+			report.Delay = p.Delay(attempt)
+			report.Retry = p.MaxElapsed == 0 || time.Since(start)+report.Delay <= p.MaxElapsed
+		}
+
+		report.Elapsed = time.Since(start)
+		if p.OnAttempt != nil {
+			p.OnAttempt(report)
+		}
+
+		if !report.Retry {
+			return err
+		}
+
+		// Wait (interruptible) before the next attempt
+		select {
+		case <-time.After(report.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retry indicates if another attempt should be made after the error
+func (p *RetryPolicy) retry(err error, attempt int) bool {
+	switch {
+	case err == nil,
+		attempt >= p.MaxAttempts,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	case p.Retryable != nil:
+		return p.Retryable(err)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: 5 * time.Second}
+	for attempt, expect := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if got := p.Delay(attempt); got != expect {
+			t.Errorf("attempt %d: expected a delay of %s, got %s", attempt, expect, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Delay(1); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("expected a delay within 50%% of 1s, got %s", d)
+		}
+	}
+}
+
+// failingStarter fails to start the first n times
+type failingStarter struct {
+	n, calls int
+	err      error
+}
+
+func (f *failingStarter) Start(context.Context) error {
+	f.calls++
+	if f.calls <= f.n {
+		return f.err
+	}
+
+	return nil
+}
+
+func (f *failingStarter) Attempts() int { return 3 }
+
+func TestOpenRetries(t *testing.T) {
+	busy := errors.New("transaction busy")
+	for _, tc := range []struct {
+		name      string
+		fails     int
+		retryable func(error) bool
+		calls     int
+		err       error
+	}{
+		{"opens after retries", 2, nil, 3, nil},
+		{"gives up, returning the last error", 5, nil, 3, busy},
+		{"does not retry", 5, func(error) bool { return false }, 1, busy},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			starter := &failingStarter{n: tc.fails, err: busy}
+
+			var attempts []Attempt
+			tx := &Transaction{
+				Starter: starter,
+				Retry: NewRetryPolicy(&RetryOpts{
+					Multiplier: 1,
+					Retryable:  tc.retryable,
+					OnAttempt:  func(a Attempt) { attempts = append(attempts, a) },
+				}, 3),
+			}
+
+			if err := tx.Open(context.Background()); err != tc.err {
+				t.Errorf("expected error %v, got %v", tc.err, err)
+			}
+
+			if starter.calls != tc.calls || len(attempts) != tc.calls {
+				t.Errorf("expected %d attempts, got %d (%d reported)", tc.calls, starter.calls, len(attempts))
+			}
+
+			if last := attempts[len(attempts)-1]; last.Number != tc.calls || last.Err != tc.err {
+				t.Errorf("unexpected last attempt %+v", last)
+			}
+
+			if tx.ongoing != (tc.err == nil) {
+				t.Errorf("expected the transaction to be ongoing only if opened")
+			}
+		})
+	}
+}
+
+func TestOpenGivesUpAfterMaxElapsed(t *testing.T) {
+	starter := &failingStarter{n: 5, err: errors.New("busy")}
+	tx := &Transaction{
+		Starter: starter,
+		Retry:   &RetryPolicy{MaxAttempts: 5, InitialDelay: 20 * time.Millisecond, MaxElapsed: 30 * time.Millisecond},
+	}
+
+	if err := tx.Open(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if starter.calls != 2 {
+		t.Errorf("expected 2 attempts within the max elapsed time, got %d", starter.calls)
+	}
+}
@@ -0,0 +1,46 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+// Runner runs the commands of a transaction, returning their output
+type Runner interface {
+	Run(ctx context.Context, cmd string) (string, error)
+}
+
+// NewShellRunner returns a Runner running the commands
+// in the shell, logging their output
+func NewShellRunner(log logging.Logger) Runner {
+	return &shellRunner{log}
+}
+
+type shellRunner struct {
+	log logging.Logger
+}
+
+// Run runs the command, returning its output, and an error if it could
+// not be run or exited with a non-zero code. The output streams of the
+// result may only be read once.
+func (s *shellRunner) Run(ctx context.Context, cmd string) (string, error) {
+	res := shell.Run(cmd, shell.Context(ctx))
+	stdout, stderr := res.Stdout().Lines(), res.Stderr().Lines()
+	s.log.InfoL(stdout)
+	s.log.ErrorL(stderr)
+
+	out := strings.Join(stdout, "\n")
+	if err := res.Err(); err != nil {
+		return out, err
+	}
+
+	if code := res.ExitCode(); code != 0 {
+		return out, fmt.Errorf("%s exited with code %d: %s", cmd, code, strings.Join(stderr, "\n"))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,27 @@
+package filesystem
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/brinick/logging"
+)
+
+func TestShellRunner(t *testing.T) {
+	r := NewShellRunner(logging.NullLogger{})
+
+	out, err := r.Run(context.Background(), "sh -c 'echo x; echo y'")
+	if err != nil || out != "x\ny" {
+		t.Errorf("expected the output of the command, got %q (%v)", out, err)
+	}
+
+	out, err = r.Run(context.Background(), "sh -c 'echo x; echo failed >&2; exit 3'")
+	if err == nil || !strings.Contains(err.Error(), "code 3") || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("expected an error with the exit code and stderr, got %v", err)
+	}
+
+	if out != "x" {
+		t.Errorf("expected the output of the failed command, got %q", out)
+	}
+}
@@ -0,0 +1,230 @@
+// Package history records nightly installs in a local BoltDB file,
+// and queries them.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Install outcomes
+const (
+	OutcomeOK      = "ok"
+	OutcomeFailed  = "failed"
+	OutcomeAborted = "aborted"
+)
+
+// Outcomes lists the install outcomes
+var Outcomes = []string{OutcomeOK, OutcomeFailed, OutcomeAborted}
+
+// Ends of the file system transaction
+const (
+	TransactionClosed      = "closed"
+	TransactionAborted     = "aborted"
+	TransactionOpenFailed  = "open-failed"
+	TransactionCloseFailed = "close-failed"
+	TransactionAbortFailed = "abort-failed"
+
+	// TransactionNotOpened is the end of an install
+	// given up before the transaction was opened
+	TransactionNotOpened = "not-opened"
+)
+
+// Phase outcomes
+const (
+	PhaseOK       = "ok"
+	PhaseFailed   = "failed"
+	PhaseCanceled = "canceled"
+)
+
+// installsBucket is the bucket holding the entries, keyed by ID
+var installsBucket = []byte("installs")
+
+// openTimeout is how long to wait for another process to release the file
+const openTimeout = 30 * time.Second
+
+// ---------------------------------------------------------------------
+
+// Entry records one nightly install
+type Entry struct {
+	ID        uint64 `json:"id"`
+	NightlyID string `json:"nightly_id"`
+	Branch    string `json:"branch"`
+	Platform  string `json:"platform"`
+	Project   string `json:"project"`
+	Timestamp string `json:"timestamp"`
+
+	// Opts are the installer options, as JSON
+	Opts json.RawMessage `json:"opts,omitempty"`
+
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	RPMs        []RPM     `json:"rpms"`
+	Phases      []Phase   `json:"phases"`
+	Outcome     string    `json:"outcome"`
+	Transaction string    `json:"transaction"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// Duration returns how long the install took
+func (e *Entry) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// String returns a one line summary of the install
+func (e *Entry) String() string {
+	return fmt.Sprintf(
+		"%5d  %s  %s/%s  %-7s  %-12s  %8s  %4d RPMs  %d error(s)",
+		e.ID,
+		e.Start.Format("2006-01-02 15:04:05"),
+		e.NightlyID,
+		e.Timestamp,
+		e.Outcome,
+		e.Transaction,
+		e.Duration().Round(time.Second),
+		len(e.RPMs),
+		len(e.Errors),
+	)
+}
+
+// RPM is an RPM that was to be installed
+type RPM struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Phase is a timed phase of the install
+type Phase struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// ---------------------------------------------------------------------
+
+// Filter selects entries. Empty fields match all entries, and the
+// Since and Until times, if set, bound the install start time.
+type Filter struct {
+	Branch   string
+	Platform string
+	Project  string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+}
+
+// Match indicates if the entry passes the filter
+func (f *Filter) Match(e *Entry) bool {
+	return (f.Branch == "" || f.Branch == e.Branch) &&
+		(f.Platform == "" || f.Platform == e.Platform) &&
+		(f.Project == "" || f.Project == e.Project) &&
+		(f.Outcome == "" || f.Outcome == e.Outcome) &&
+		(f.Since.IsZero() || !e.Start.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Start.Before(f.Until))
+}
+
+// ---------------------------------------------------------------------
+
+// Open opens, creating if needed, the history database at the given path.
+// The file is locked until closed, so it should not be kept open longer
+// than needed.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create history directory (%w)", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open history database %s (%w)", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(installsBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to initialise history database %s (%w)", path, err)
+	}
+
+	return &DB{db}, nil
+}
+
+// DB is the install history database
+type DB struct {
+	db *bolt.DB
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Add records the entry, setting its ID
+func (d *DB) Add(e *Entry) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(installsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		e.ID = id
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(key(id), data)
+	})
+}
+
+// Query returns the entries that pass the filter, oldest first,
+// or only the most recent ones if limit is > 0
+func (d *DB) Query(f *Filter, limit int) ([]*Entry, error) {
+	var entries []*Entry
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(installsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("bad history entry %d (%w)", binary.BigEndian.Uint64(k), err)
+			}
+
+			if !f.Match(&e) {
+				continue
+			}
+
+			entries = append(entries, &e)
+			if limit > 0 && len(entries) == limit {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	// Entries were collected newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, err
+}
+
+// key returns the big endian encoding of the id, so that keys sort in order
+func key(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddAndQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	for i, e := range []*Entry{
+		{Branch: "master", Platform: "x86_64-centos7-gcc8-opt", Outcome: OutcomeOK},
+		{Branch: "22.0", Platform: "x86_64-centos7-gcc8-opt", Outcome: OutcomeFailed},
+		{Branch: "master", Platform: "x86_64-centos7-gcc8-dbg", Outcome: OutcomeOK},
+		{Branch: "master", Platform: "x86_64-centos7-gcc8-opt", Outcome: OutcomeAborted},
+	} {
+		e.Start = day.Add(time.Duration(i) * 24 * time.Hour)
+		e.End = e.Start.Add(time.Hour)
+		if err := db.Add(e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.ID != uint64(i+1) {
+			t.Errorf("expected entry ID %d, got %d", i+1, e.ID)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		limit  int
+		ids    []uint64
+	}{
+		{"all", Filter{}, 0, []uint64{1, 2, 3, 4}},
+		{"branch", Filter{Branch: "master"}, 0, []uint64{1, 3, 4}},
+		{"platform and outcome", Filter{Platform: "x86_64-centos7-gcc8-opt", Outcome: OutcomeOK}, 0, []uint64{1}},
+		{"date range", Filter{Since: day.Add(24 * time.Hour), Until: day.Add(72 * time.Hour)}, 0, []uint64{2, 3}},
+		{"limit", Filter{Branch: "master"}, 2, []uint64{3, 4}},
+	} {
+		entries, err := db.Query(&tc.filter, tc.limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		var ids []uint64
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+
+		if len(ids) != len(tc.ids) {
+			t.Errorf("%s: expected entries %v, got %v", tc.name, tc.ids, ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != tc.ids[i] {
+				t.Errorf("%s: expected entries %v, got %v", tc.name, tc.ids, ids)
+				break
+			}
+		}
+	}
+}
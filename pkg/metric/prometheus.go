@@ -0,0 +1,181 @@
+package metric
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default is the registry to which the installer metrics are recorded
+var Default = NewRegistry()
+
+// Labels are the labels of a metric sample
+type Labels map[string]string
+
+// String returns the labels in the exposition format, sorted by name
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	var names []string
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, labelEscaper.Replace(l[name])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as the exposition format requires,
+// which, unlike Go, leaves any other character, such as UTF-8, as it is
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ------------------------------------------------------------------
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Registry holds gauges and counters, for exposition in the Prometheus
+// text format over HTTP, or in a node exporter textfile
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help    string
+	kind    string
+	samples map[string]float64
+}
+
+// Set sets the gauge to the value
+func (r *Registry) Set(name, help string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "gauge").samples[labels.String()] = value
+}
+
+// Add adds the value to the counter
+func (r *Registry) Add(name, help string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "counter").samples[labels.String()] += value
+}
+
+// family returns the named family, creating it if needed
+func (r *Registry) family(name, help, kind string) *family {
+	f, found := r.families[name]
+	if !found {
+		f = &family{help: help, kind: kind, samples: map[string]float64{}}
+		r.families[name] = f
+	}
+
+	return f
+}
+
+// WriteTo writes the metrics, and those of the process, in the text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.setProcessMetrics()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+
+		var labels []string
+		for l := range f.samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		for _, l := range labels {
+			fmt.Fprintf(&b, "%s%s %s\n", name, l, strconv.FormatFloat(f.samples[l], 'g', -1, 64))
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
+
+// WriteTextFile writes the metrics to the node exporter textfile. The file
+// is written alongside and renamed, so that it is never read half written.
+func (r *Registry) WriteTextFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return fmt.Errorf("unable to create metrics textfile (%w)", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := r.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write metrics textfile (%w)", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write metrics textfile (%w)", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// setProcessMetrics sets the CPU and memory usage of the process
+func (r *Registry) setProcessMetrics() {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return
+	}
+
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.family(
+		"process_cpu_seconds_total",
+		"Total user and system CPU time spent in seconds.",
+		"counter",
+	).samples[""] = cpu.Seconds()
+
+	// Maxrss is in kilobytes on Linux
+	r.family(
+		"process_max_resident_memory_bytes",
+		"Maximum resident memory size in bytes.",
+		"gauge",
+	).samples[""] = float64(usage.Maxrss * 1024)
+}
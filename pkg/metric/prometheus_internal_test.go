@@ -0,0 +1,78 @@
+package metric
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry()
+	r.Set("installer_phase_seconds", "Phase duration.", 1.5, Labels{"phase": "install", "nightly": "master"})
+	r.Set("installer_phase_seconds", "Phase duration.", 2, Labels{"phase": "configure", "nightly": "master"})
+	r.Add("installer_installs_total", "Installs.", 1, Labels{"outcome": "ok"})
+	r.Add("installer_installs_total", "Installs.", 1, Labels{"outcome": "ok"})
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		"# HELP installer_installs_total Installs.\n# TYPE installer_installs_total counter\n" +
+			"installer_installs_total{outcome=\"ok\"} 2\n",
+		"# TYPE installer_phase_seconds gauge\n" +
+			"installer_phase_seconds{nightly=\"master\",phase=\"configure\"} 2\n" +
+			"installer_phase_seconds{nightly=\"master\",phase=\"install\"} 1.5\n",
+		"# TYPE process_cpu_seconds_total counter\n",
+	} {
+		if !strings.Contains(b.String(), expect) {
+			t.Errorf("expected exposition to contain:\n%s\ngot:\n%s", expect, b.String())
+		}
+	}
+}
+
+func TestLabelsEscaping(t *testing.T) {
+	l := Labels{"error": "C:\\ \"état\"\n\ttab"}
+	if got, expect := l.String(), `{error="C:\\ \"état\"\n`+"\ttab\"}"; got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+}
+
+func TestRegistryTextFileAndHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metric.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewRegistry()
+	r.Set("installer_state", "State.", 1, Labels{"state": "idle"})
+
+	path := filepath.Join(dir, "installer.prom")
+	if err := r.WriteTextFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "installer_state{state=\"idle\"} 1\n") {
+		t.Errorf("unexpected textfile content:\n%s", data)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Errorf("expected only the textfile to remain, got %v", files)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "installer_state{state=\"idle\"} 1\n") {
+		t.Errorf("unexpected served metrics:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,73 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// NewSender returns a sender of metric items to the UDP address
+func NewSender(addr string) (*Sender, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to metrics address %s (%w)", addr, err)
+	}
+
+	return &Sender{conn: conn}, nil
+}
+
+// Sender writes metric items, one per datagram, to a UDP address.
+// Metrics are best effort: failed writes are counted, not returned.
+type Sender struct {
+	conn   net.Conn
+	failed uint64
+}
+
+// Drain sends the items until the channel is closed, or the context is
+// done, at which point the items already queued are sent before returning
+func (s *Sender) Drain(ctx context.Context, items <-chan string) {
+	for {
+		select {
+		case item, ok := <-items:
+			if !ok {
+				return
+			}
+			s.send(item)
+		case <-ctx.Done():
+			s.flush(items)
+			return
+		}
+	}
+}
+
+// Failed returns the number of items that could not be sent
+func (s *Sender) Failed() uint64 {
+	return atomic.LoadUint64(&s.failed)
+}
+
+// Close closes the connection
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
+
+// flush sends the items queued, without waiting for more
+func (s *Sender) flush(items <-chan string) {
+	for {
+		select {
+		case item, ok := <-items:
+			if !ok {
+				return
+			}
+			s.send(item)
+		default:
+			return
+		}
+	}
+}
+
+func (s *Sender) send(item string) {
+	if _, err := s.conn.Write([]byte(item)); err != nil {
+		atomic.AddUint64(&s.failed, 1)
+	}
+}
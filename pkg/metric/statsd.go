@@ -2,16 +2,48 @@ package metric
 
 import (
 	"fmt"
+	"math/rand"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // API provides the set of methods for gathering metrics
 type API interface {
-	Count(string, int) string
-	Gauge() string
-	Timer() string
+	Count(string, int, *Options) string
+	Gauge(string, float64, *Options) string
+	Timer(string, time.Duration, *Options) string
 }
 
+// Options are the optional settings of a metric
+type Options struct {
+	// Rate is the sample rate, in (0, 1]
+	Rate float64
+
+	// Tags are key:value pairs
+	Tags []string
+}
+
+// Option sets an optional setting of a metric
+type Option func(*Options)
+
+// SampleRate samples the metric at the given rate, in (0, 1]
+func SampleRate(rate float64) Option {
+	return func(o *Options) {
+		o.Rate = rate
+	}
+}
+
+// Tag tags the metric with the key and value
+func Tag(key, value string) Option {
+	return func(o *Options) {
+		o.Tags = append(o.Tags, key+":"+value)
+	}
+}
+
+// ------------------------------------------------------------------
+
 // NewQueue returns a new metric queue
 func NewQueue(itemFormatter string, cap int) *Queue {
 	itemFormatter = strings.TrimSpace(itemFormatter)
@@ -35,10 +67,12 @@ func NewQueue(itemFormatter string, cap int) *Queue {
 	}
 }
 
-// Queue is a channel of metric strings, encoded by the given formatter
+// Queue is a channel of metric strings, encoded by the given formatter.
+// Pushing a metric never blocks: if the queue is full, it is dropped.
 type Queue struct {
 	formatter API
 	queue     chan string
+	dropped   uint64
 }
 
 // Items returns the channel of metric items
@@ -46,44 +80,93 @@ func (mq *Queue) Items() <-chan string {
 	return mq.queue
 }
 
-// Count is
-func (mq *Queue) Count(name string, value int) {
+// Dropped returns the number of metrics dropped as the queue was full
+func (mq *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&mq.dropped)
+}
+
+// Count pushes a counter of the given value
+func (mq *Queue) Count(name string, value int, opts ...Option) {
 	if mq != nil {
-		mq.queue <- mq.formatter.Count(name, value)
+		o := options(opts)
+		mq.push(o, mq.formatter.Count(name, value, o))
 	}
 }
 
-// Gauge is
-func (mq *Queue) Gauge() {
+// Gauge pushes a gauge of the given value
+func (mq *Queue) Gauge(name string, value float64, opts ...Option) {
 	if mq != nil {
-		mq.queue <- mq.formatter.Gauge()
+		o := options(opts)
+		mq.push(o, mq.formatter.Gauge(name, value, o))
 	}
 }
 
-// Timer is
-func (mq *Queue) Timer() {
+// Timer pushes a timer of the given duration
+func (mq *Queue) Timer(name string, d time.Duration, opts ...Option) {
 	if mq != nil {
-		mq.queue <- mq.formatter.Timer()
+		o := options(opts)
+		mq.push(o, mq.formatter.Timer(name, d, o))
 	}
 }
 
+// push queues the item, unless not sampled or the queue is full
+func (mq *Queue) push(o *Options, item string) {
+	if o.Rate < 1 && rand.Float64() >= o.Rate {
+		return
+	}
+
+	select {
+	case mq.queue <- item:
+	default:
+		atomic.AddUint64(&mq.dropped, 1)
+	}
+}
+
+// options applies the options to the defaults
+func options(opts []Option) *Options {
+	o := &Options{Rate: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
 // ------------------------------------------------------------------
 
-// StatsD provides the format for a StatsD metrics gatherer
+// StatsD provides the format for a StatsD metrics gatherer,
+// with tags in the DogStatsD style
 type StatsD struct {
 }
 
 // Count provides the format for StatsD Count
-func (s *StatsD) Count(name string, value int) string {
-	return fmt.Sprintf("")
+func (s *StatsD) Count(name string, value int, o *Options) string {
+	return s.format(name, strconv.Itoa(value), "c", o)
 }
 
 // Gauge provides the format for StatsD Gauge
-func (s *StatsD) Gauge() string {
-	return fmt.Sprintf("")
+func (s *StatsD) Gauge(name string, value float64, o *Options) string {
+	return s.format(name, strconv.FormatFloat(value, 'f', -1, 64), "g", o)
 }
 
-// Timer provides the format for StatsD Timer
-func (s *StatsD) Timer() string {
-	return fmt.Sprintf("")
+// Timer provides the format for StatsD Timer, in milliseconds
+func (s *StatsD) Timer(name string, d time.Duration, o *Options) string {
+	ms := float64(d) / float64(time.Millisecond)
+	return s.format(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms", o)
+}
+
+// format returns the <name>:<value>|<type>[|@<rate>][|#<tags>] line
+func (s *StatsD) format(name, value, kind string, o *Options) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%s|%s", name, value, kind)
+
+	if o.Rate < 1 {
+		fmt.Fprintf(&b, "|@%s", strconv.FormatFloat(o.Rate, 'f', -1, 64))
+	}
+
+	if len(o.Tags) > 0 {
+		fmt.Fprintf(&b, "|#%s", strings.Join(o.Tags, ","))
+	}
+
+	return b.String()
 }
@@ -0,0 +1,76 @@
+package metric
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsDFormat(t *testing.T) {
+	s := &StatsD{}
+	for _, tc := range []struct {
+		got, expect string
+	}{
+		{s.Count("nrpms", 12, options(nil)), "nrpms:12|c"},
+		{s.Gauge("load", 0.5, options(nil)), "load:0.5|g"},
+		{s.Timer("install", 1500*time.Microsecond, options(nil)), "install:1.5|ms"},
+		{
+			s.Count("nrpms", 3, options([]Option{SampleRate(0.25), Tag("branch", "master"), Tag("pkg", "ayum")})),
+			"nrpms:3|c|@0.25|#branch:master,pkg:ayum",
+		},
+	} {
+		if tc.got != tc.expect {
+			t.Errorf("expected %q, got %q", tc.expect, tc.got)
+		}
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	q := NewQueue("statsd", 1)
+	q.Count("a", 1)
+	q.Count("b", 1)
+
+	if q.Dropped() != 1 {
+		t.Errorf("expected 1 metric to be dropped, got %d", q.Dropped())
+	}
+
+	var nilQueue *Queue
+	nilQueue.Count("c", 1)
+}
+
+func TestSenderDrainsToUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := NewSender(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	q := NewQueue("statsd", 10)
+	q.Count("ayum_nrpms_to_install", 42)
+	q.Count("ayum_nlocal_packages", 7)
+
+	// The queued metrics are sent on cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sender.Drain(ctx, q.Items())
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	for _, expect := range []string{"ayum_nrpms_to_install:42|c", "ayum_nlocal_packages:7|c"} {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(buf[:n]); got != expect {
+			t.Errorf("expected %q, got %q", expect, got)
+		}
+	}
+}
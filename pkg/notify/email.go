@@ -1,71 +1,68 @@
 package notify
 
 import (
+	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/brinick/shell"
 )
 
-// NewEmail permits sending an email from the given address
-// to the comma-separated to string of emails
+// NewEmail permits sending an email with mailx from the given
+// address to the comma-separated to string of emails
 func NewEmail(from string, to string) *email {
 	// No check if addresses are valid...
 	from = strings.TrimSpace(from)
-	to = strings.TrimSpace(to)
-	if from == "" || to == "" {
-		return nil
-	}
-
-	var toEmails []string
-	for _, toAddr := range strings.Split(to, ",") {
-		toEmails = append(toEmails, strings.TrimSpace(toAddr))
-	}
-
-	if len(toEmails) == 0 {
+	toEmails := splitAddrs(to)
+	if from == "" || len(toEmails) == 0 {
 		return nil
 	}
 
 	return &email{from: from, to: toEmails, exe: "/bin/mailx"}
 }
 
-// email is for sending an email
+// email is for sending an email with mailx
 type email struct {
-	from    string
-	to      []string
-	timeout uint
-	cancel  <-chan struct{}
-	exe     string
-}
-
-func (e *email) WithTimeout(secs uint) *email {
-	e.timeout = secs
-	return e
+	from string
+	to   []string
+	exe  string
 }
 
-func (e *email) WithCancel(stop <-chan struct{}) *email {
-	e.cancel = stop
-	return e
-}
+// Send sends the email, until the context is done
+func (e *email) Send(ctx context.Context, subject, body string) error {
+	var to []string
+	for _, addr := range e.to {
+		to = append(to, quote(addr))
+	}
 
-func (e *email) Send(subject, body string) *shell.Result {
 	cmd := fmt.Sprintf(
-		"echo '%s' | %s -r %s -s '%s' %s",
-		body,
+		"printf '%%s\\n' %s | %s -r %s -s %s %s",
+		quote(body),
 		e.exe,
-		e.from,
-		subject,
-		strings.Join(e.to, " "),
+		quote(e.from),
+		quote(subject),
+		strings.Join(to, " "),
 	)
 
-	var opts []shell.Option
-	if e.timeout > 0 {
-		opts = append(opts, shell.Timeout(time.Duration(e.timeout)*time.Second))
+	res := shell.Run(cmd, shell.Context(ctx))
+	if err := res.Err(); err != nil {
+		return fmt.Errorf("unable to send email with %s (%w)", e.exe, err)
 	}
 
-	if e.cancel != nil {
-		opts = append(opts, shell.Cancel(e.cancel))
+	if code := res.ExitCode(); code != 0 {
+		return fmt.Errorf(
+			"unable to send email with %s, exited with code %d: %s",
+			e.exe,
+			code,
+			strings.Join(res.Stderr().Lines(), "\n"),
+		)
 	}
-	return shell.Run(cmd, opts...)
+
+	return nil
+}
+
+// quote single quotes the string for the shell,
+// including any single quotes within it
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
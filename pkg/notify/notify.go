@@ -0,0 +1,46 @@
+// Package notify sends notifications about nightly installs,
+// by email or to webhooks.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Notifier sends a notification
+type Notifier interface {
+	Send(ctx context.Context, subject, body string) error
+}
+
+// Multi sends the notification with each of its notifiers
+type Multi []Notifier
+
+// Send sends the notification with all notifiers, even if some fail,
+// returning an error listing the failures, if any
+func (m Multi) Send(ctx context.Context, subject, body string) error {
+	var errs []string
+	for _, n := range m {
+		if err := n.Send(ctx, subject, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d notifications failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// splitAddrs splits the comma-separated addresses
+func splitAddrs(addrs string) []string {
+	var split []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			split = append(split, addr)
+		}
+	}
+
+	return split
+}
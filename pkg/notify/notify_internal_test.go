@@ -0,0 +1,260 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+)
+
+// smtpStandIn is a minimal SMTP server, accepting one email,
+// which it sends on the returned channel
+func smtpStandIn(t *testing.T, extensions ...string) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mails := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ready")
+
+		var data []string
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			if inData {
+				if line == "." {
+					inData = false
+					mails <- strings.Join(data, "\n")
+					reply("250 queued")
+				} else {
+					data = append(data, line)
+				}
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+			case "EHLO":
+				for _, ext := range extensions {
+					reply("250-" + ext)
+				}
+				reply("250 localhost")
+			case "AUTH":
+				reply("235 authenticated")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return l.Addr().String(), mails
+}
+
+func TestSMTPSend(t *testing.T) {
+	addr, mails := smtpStandIn(t, "AUTH PLAIN")
+	s, err := NewSMTP(&SMTPOpts{
+		Addr:     addr,
+		From:     "atnight@cern.ch",
+		To:       "a@cern.ch, b@cern.ch",
+		Username: "atnight",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body := "The nightly's install failed\n.\nsee the log"
+	if err := s.Send(ctx, "FAILED: nightly install", body); err != nil {
+		t.Fatal(err)
+	}
+
+	mail := <-mails
+	for _, expect := range []string{
+		"To: a@cern.ch, b@cern.ch",
+		"Subject: FAILED: nightly install",
+		"The nightly's install failed\n..\nsee the log",
+	} {
+		if !strings.Contains(mail, expect) {
+			t.Errorf("expected the email to contain %q, got:\n%s", expect, mail)
+		}
+	}
+}
+
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	addr, _ := smtpStandIn(t)
+	s, err := NewSMTP(&SMTPOpts{Addr: addr, From: "atnight@cern.ch", To: "a@cern.ch", StartTLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(context.Background(), "subject", "body"); err == nil {
+		t.Errorf("expected an error from a server without STARTTLS")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "no such hook", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if err := NewJSONWebhook(srv.URL).Send(ctx, "FAILED", "it's broken"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["subject"] != "FAILED" || got["body"] != "it's broken" {
+		t.Errorf("unexpected webhook payload %v", got)
+	}
+
+	if err := NewChatWebhook(srv.URL).Send(ctx, "FAILED", "it's broken"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(got["text"], "FAILED") || !strings.Contains(got["text"], "it's broken") {
+		t.Errorf("unexpected chat payload %v", got)
+	}
+
+	multi := Multi{NewJSONWebhook(srv.URL + "/fail"), NewJSONWebhook(srv.URL)}
+	if err := multi.Send(ctx, "FAILED", "body"); err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected 1 of 2 notifications to fail, got %v", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, expect := quote("it's"), `'it'\''s'`; got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailx.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The mailx stand-in records its input, failing if told to
+	script := `#!/bin/sh
+cat > ` + dir + `/mail
+[ "$4" = "FAILED" ] && { echo "no route to host" >&2; exit 1; }
+exit 0
+`
+	exe := filepath.Join(dir, "mailx")
+	if err := ioutil.WriteFile(exe, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEmail("atlas@cern.ch", "admin@cern.ch")
+	e.exe = exe
+	ctx := context.Background()
+	if err := e.Send(ctx, "OK", "it's done"); err != nil {
+		t.Fatalf("expected the email to be sent, got %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "mail")); string(data) != "it's done\n" {
+		t.Errorf("expected the body to be mailed, got %q", data)
+	}
+
+	if err := e.Send(ctx, "FAILED", "body"); err == nil || !strings.Contains(err.Error(), "no route to host") {
+		t.Errorf("expected the email to fail with the mailx error, got %v", err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	custom := `{{define "subject"}}{{.Outcome}}: {{.NightlyID}}{{end}}{{join .Errors ", "}} in {{.Log}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, KindFailure+".tmpl"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := NewTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	install := &Install{
+		NightlyID: "master_Athena_x86_64-centos7-gcc8-opt",
+		Outcome:   history.OutcomeFailed,
+		Errors:    []string{"it's broken", "and again"},
+		Log:       "/logs/install.log",
+		Timeline:  []history.Phase{{Name: "install", Outcome: history.PhaseOK, Duration: 90 * time.Second}},
+	}
+
+	subject, body, err := templates.Render(KindFailure, install)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject != "failed: "+install.NightlyID || body != "it's broken, and again in /logs/install.log" {
+		t.Errorf("unexpected custom failure notification %q: %q", subject, body)
+	}
+
+	// Kinds without a template file use the default template
+	subject, body, err = templates.Render(KindSuccess, install)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject != "OK: nightly install "+install.NightlyID || !strings.Contains(body, "install          ok       1m30s") {
+		t.Errorf("unexpected default success notification %q: %q", subject, body)
+	}
+
+	digest := &Digest{Installs: []*history.Entry{
+		{NightlyID: "a", Outcome: history.OutcomeOK},
+		{NightlyID: "b", Outcome: history.OutcomeFailed, Errors: []string{"boom"}},
+	}}
+
+	subject, body, err = templates.Render(KindDigest, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject != "Nightly installs digest: 1 ok, 1 failed, 0 aborted" || !strings.Contains(body, "\tboom") {
+		t.Errorf("unexpected digest notification %q: %q", subject, body)
+	}
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPOpts are the options of the SMTP notifier
+type SMTPOpts struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+
+	// From is the sender address, and To the comma-separated recipients
+	From string
+	To   string
+
+	// StartTLS requires the connection be upgraded to TLS
+	StartTLS bool
+
+	// Username and Password, if set, are used to authenticate
+	Username string
+	Password string
+}
+
+// NewSMTP returns an SMTP notifier, sending emails
+// directly to the SMTP server
+func NewSMTP(opts *SMTPOpts) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("bad SMTP server address %s (%w)", opts.Addr, err)
+	}
+
+	to := splitAddrs(opts.To)
+	if opts.From == "" || len(to) == 0 {
+		return nil, fmt.Errorf("SMTP notifier requires sender and recipient addresses")
+	}
+
+	return &SMTP{opts: opts, host: host, to: to}, nil
+}
+
+// SMTP sends notifications as emails, using net/smtp
+type SMTP struct {
+	opts *SMTPOpts
+	host string
+	to   []string
+}
+
+// Send sends the email, until the context is done
+func (s *SMTP) Send(ctx context.Context, subject, body string) error {
+	if err := s.send(ctx, s.message(subject, body)); err != nil {
+		return fmt.Errorf("unable to send email via %s (%w)", s.opts.Addr, err)
+	}
+
+	return nil
+}
+
+func (s *SMTP) send(ctx context.Context, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp has no context support, so bound the session instead
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.opts.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS")
+		}
+
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+
+	if s.opts.Username != "" {
+		auth := smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.opts.From); err != nil {
+		return err
+	}
+
+	for _, addr := range s.to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns the email headers and body
+func (s *SMTP) message(subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.opts.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return b.Bytes()
+}
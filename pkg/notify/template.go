@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+)
+
+// Kinds of notification, each rendered from its own template
+const (
+	KindFailure = "failure"
+	KindAbort   = "abort"
+	KindSuccess = "success"
+	KindDigest  = "digest"
+)
+
+// Kinds lists the kinds of notification
+var Kinds = []string{KindFailure, KindAbort, KindSuccess, KindDigest}
+
+// Install is the data with which install notifications are rendered
+type Install struct {
+	NightlyID string
+	Opts      interface{}
+	Outcome   string
+	Errors    []string
+	Timeline  []history.Phase
+
+	// Log is the installer log, PkgManagerLog that of the package
+	// manager, copied, along with the timeline, to InstallDir
+	Log           string
+	PkgManagerLog string
+	InstallDir    string
+
+	// PID and Signal are set when the install was aborted by a signal
+	PID    int
+	Signal string
+}
+
+// Digest is the data with which digest notifications are rendered
+type Digest struct {
+	Since    time.Time
+	Until    time.Time
+	Installs []*history.Entry
+}
+
+// Count returns the number of installs with the outcome
+func (d *Digest) Count(outcome string) int {
+	var n int
+	for _, e := range d.Installs {
+		if e.Outcome == outcome {
+			n++
+		}
+	}
+
+	return n
+}
+
+// ---------------------------------------------------------------------
+
+// Templates render the subject, from the template named "subject",
+// and the body of each kind of notification
+type Templates map[string]*template.Template
+
+// funcs are the functions available to the templates
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"seconds": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+}
+
+// NewTemplates returns the default templates, overridden by the
+// <kind>.tmpl files in the directory, if given
+func NewTemplates(dir string) (Templates, error) {
+	t := Templates{}
+	for kind, text := range defaultTemplates {
+		src := kind
+		if dir != "" {
+			path := filepath.Join(dir, kind+".tmpl")
+			data, err := ioutil.ReadFile(path)
+			switch {
+			case err == nil:
+				text, src = string(data), path
+			case !os.IsNotExist(err):
+				return nil, fmt.Errorf("unable to read notification template (%w)", err)
+			}
+		}
+
+		tmpl, err := template.New(kind).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("bad notification template %s (%w)", src, err)
+		}
+
+		t[kind] = tmpl
+	}
+
+	return t, nil
+}
+
+// Render returns the subject and body of the kind of notification
+func (t Templates) Render(kind string, data interface{}) (string, string, error) {
+	tmpl, found := t[kind]
+	if !found {
+		return "", "", fmt.Errorf("no %s notification template", kind)
+	}
+
+	var subject, body bytes.Buffer
+	if s := tmpl.Lookup("subject"); s != nil {
+		if err := s.Execute(&subject, data); err != nil {
+			return "", "", fmt.Errorf("unable to render %s notification subject (%w)", kind, err)
+		}
+	}
+
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("unable to render %s notification (%w)", kind, err)
+	}
+
+	return strings.TrimSpace(subject.String()), strings.TrimLeft(body.String(), "\n"), nil
+}
+
+// defaultTemplates are used for the kinds with no template file
+var defaultTemplates = map[string]string{
+	KindFailure: `{{define "subject"}}FAILED: nightly install {{.NightlyID}}{{end}}
+The installation for nightly:
+	{{.NightlyID}}
+failed. {{len .Errors}} error(s) reported:
+
+{{range .Errors}}{{.}}
+{{end}}{{if .Timeline}}
+Timeline:
+{{range .Timeline}}	{{printf "%-16s" .Name}} {{printf "%-8s" .Outcome}} {{seconds .Duration}}
+{{end}}{{end}}
+Full output available in the log file:
+{{.Log}}
+`,
+
+	KindAbort: `{{define "subject"}}ABORTED: nightly install {{.NightlyID}}{{end}}
+The install process with PID {{.PID}} was terminated (signal {{.Signal}} was trapped)
+The nightly:
+	{{.NightlyID}}
+was thus not installed.
+
+Full output available in the log file:
+{{.Log}}
+`,
+
+	KindSuccess: `{{define "subject"}}OK: nightly install {{.NightlyID}}{{end}}
+The nightly:
+	{{.NightlyID}}
+was installed in {{.InstallDir}}
+{{if .Timeline}}
+Timeline:
+{{range .Timeline}}	{{printf "%-16s" .Name}} {{printf "%-8s" .Outcome}} {{seconds .Duration}}
+{{end}}{{end}}`,
+
+	KindDigest: `{{define "subject"}}Nightly installs digest: {{.Count "ok"}} ok, {{.Count "failed"}} failed, {{.Count "aborted"}} aborted{{end}}
+Nightly installs from {{.Since.Format "2006-01-02 15:04"}} to {{.Until.Format "2006-01-02 15:04"}}:
+
+{{range .Installs}}{{.}}
+{{range .Errors}}	{{.}}
+{{end}}{{else}}No installs.
+{{end}}`,
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewChatWebhook returns a notifier posting to a Mattermost,
+// or Slack, incoming webhook
+func NewChatWebhook(url string) *Webhook {
+	return &Webhook{
+		url: url,
+		payload: func(subject, body string) interface{} {
+			return map[string]string{"text": fmt.Sprintf("**%s**\n```\n%s\n```", subject, body)}
+		},
+	}
+}
+
+// NewJSONWebhook returns a notifier posting the subject
+// and body as a JSON object to the URL
+func NewJSONWebhook(url string) *Webhook {
+	return &Webhook{
+		url: url,
+		payload: func(subject, body string) interface{} {
+			return map[string]string{"subject": subject, "body": body}
+		},
+	}
+}
+
+// Webhook posts notifications as JSON to an HTTP endpoint
+type Webhook struct {
+	url     string
+	payload func(subject, body string) interface{}
+	client  http.Client
+}
+
+// Send posts the notification, until the context is done
+func (w *Webhook) Send(ctx context.Context, subject, body string) error {
+	data, err := json.Marshal(w.payload(subject, body))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("bad webhook request (%w)", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post to webhook (%w)", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/brinick/atlas-rpm-installer/pkg/metric"
 	"github.com/brinick/logging"
 	"github.com/brinick/shell"
 )
@@ -66,6 +67,20 @@ func (ac *ayumCommand) Run(opts ...shell.Option) {
 	} else {
 		ac.result = ac.runner.Run(ac.cmd, opts...)
 	}
+
+	ac.observe()
+}
+
+// observe records the command duration
+func (ac *ayumCommand) observe() {
+	d := time.Duration(ac.duration() * float64(time.Second))
+	metrics.Timer("ayum_command_duration", d, metric.Tag("cmd", ac.label))
+	metric.Default.Set(
+		"atlas_rpm_installer_ayum_command_duration_seconds",
+		"Duration of the last run of each ayum command.",
+		d.Seconds(),
+		metric.Labels{"command": ac.label},
+	)
 }
 
 // Ran indicates if this command already executed
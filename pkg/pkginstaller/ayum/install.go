@@ -12,6 +12,7 @@ import (
 
 type installer interface {
 	Install(context.Context, ...string) error
+	Classify(context.Context, ...string) ([]string, []string, error)
 }
 
 type cmdInstall struct {
@@ -32,11 +33,30 @@ func (c *cmdInstall) Install(ctx context.Context, rpmsToInstall ...string) error
 
 	metrics.Count("ayum_nrpms_to_install", len(rpmsToInstall))
 
-	localPackages, err := c.Installed(ctx)
+	toReinstall, toInstall, err := c.Classify(ctx, rpmsToInstall...)
 	if err != nil {
 		return err
 	}
 
+	if err := c.reinstallRPMs(ctx, toReinstall...); err != nil {
+		return fmt.Errorf("reinstall RPMs failed (%w)", err)
+	}
+
+	if err := c.installRPMs(ctx, toInstall...); err != nil {
+		return fmt.Errorf("install RPMs failed (%w)", err)
+	}
+
+	return nil
+}
+
+// Classify splits the provided RPMs into those already installed
+// locally, which need reinstalling, and those to install.
+func (c *cmdInstall) Classify(ctx context.Context, rpms ...string) ([]string, []string, error) {
+	localPackages, err := c.Installed(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	c.log.Info(
 		"Checked for locally installed packages",
 		logging.F("nFound", len(*localPackages)),
@@ -44,7 +64,7 @@ func (c *cmdInstall) Install(ctx context.Context, rpmsToInstall ...string) error
 
 	metrics.Count("ayum_nlocal_packages", len(*localPackages))
 
-	rpmsNames := removeFileExt(rpmsToInstall...)
+	rpmsNames := removeFileExt(rpms...)
 	toReinstall, toInstall := localPackages.matching(rpmsNames...)
 
 	// TODO: this could be a metric
@@ -54,15 +74,7 @@ func (c *cmdInstall) Install(ctx context.Context, rpmsToInstall ...string) error
 		logging.F("nToInstall", len(toInstall)),
 	)
 
-	if err := c.reinstallRPMs(ctx, toReinstall...); err != nil {
-		return fmt.Errorf("reinstall RPMs failed (%w)", err)
-	}
-
-	if err := c.installRPMs(ctx, toInstall...); err != nil {
-		return fmt.Errorf("install RPMs failed (%w)", err)
-	}
-
-	return nil
+	return toReinstall, toInstall, nil
 }
 
 func (c *cmdInstall) installRPMs(ctx context.Context, rpms ...string) error {
@@ -21,12 +21,17 @@ type MetricQueue interface {
 // created with the Opts.MonitoringFormat set to the name of the
 // metric encoder to use.
 func Metrics() MetricQueue {
+	if metrics == nil {
+		return nil
+	}
+
 	return metrics
 }
 
 // New creates a new Ayum instance
 func New(opts *Opts, log logging.Logger) *Ayum {
-	if opts.MonitoringFormat != "" {
+	// The queue is shared by the ayum instances of all nightlies
+	if opts.MonitoringFormat != "" && metrics == nil {
 		metrics = metric.NewQueue(opts.MonitoringFormat, 100)
 	}
 
@@ -86,12 +91,14 @@ func New(opts *Opts, log logging.Logger) *Ayum {
 				},
 			},
 			rpmInstaller: &ayumCommand{
+				label:    "ayum install",
 				preCmds:  preCmds,
 				timeout:  opts.InstallTimeout,
 				cmd:      fmt.Sprintf("%s -y install ", binary) + "%s",
 				postCmds: postCmds,
 			},
 			rpmReinstaller: &ayumCommand{
+				label:    "ayum reinstall",
 				preCmds:  preCmds,
 				timeout:  opts.InstallTimeout,
 				cmd:      fmt.Sprintf("%s -y reinstall ", binary) + "%s",
@@ -0,0 +1,86 @@
+package dnf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+)
+
+type rpmRepoAdder interface {
+	AddRemoteRepos([]*rpm.Repo) error
+}
+
+type rpmRepoAdd struct {
+	reposDir    string
+	relocations *relocations
+}
+
+// AddRemoteRepos writes a dnf repo file for each of the provided remote
+// repositories. As dnf has no notion of relocatable prefixes, these are
+// kept aside for when the RPMs themselves get installed.
+func (r *rpmRepoAdd) AddRemoteRepos(repos []*rpm.Repo) error {
+	for _, repo := range repos {
+		repoConf := filepath.Join(r.reposDir, repo.Filename())
+		if err := ioutil.WriteFile(repoConf, []byte(dnfRepo(repo).String()), 0644); err != nil {
+			return fmt.Errorf("could not configure remote repo %s (%w)", repo.Filename(), err)
+		}
+
+		r.relocations.add(repo)
+	}
+
+	return nil
+}
+
+// dnfRepo returns the copy of the repo that dnf should see. The dnf
+// configuration is private to this installer, so all repos are enabled.
+func dnfRepo(repo *rpm.Repo) *rpm.Repo {
+	r := *repo
+	r.URL = toURL(r.URL)
+	r.Prefix = ""
+	r.Enabled = true
+	return &r
+}
+
+// toURL turns local directory paths into file:// URLs
+func toURL(location string) string {
+	if strings.HasPrefix(location, "/") {
+		return "file://" + location
+	}
+
+	return location
+}
+
+// ----------------------------------------------------------------------
+
+// relocations maps repository base URLs to the
+// prefix below which their RPMs should be installed
+type relocations struct {
+	prefixes map[string]string
+}
+
+func (r *relocations) add(repo *rpm.Repo) {
+	if r.prefixes == nil {
+		r.prefixes = map[string]string{}
+	}
+
+	baseURL := strings.TrimSuffix(toURL(repo.URL), "/") + "/"
+	r.prefixes[baseURL] = repo.Prefix
+}
+
+// prefix returns the install prefix of the repository from which
+// the RPM at the given URL comes. If several repositories match,
+// the one with the longest base URL wins. No match, or a repository
+// without a prefix, returns the empty string.
+func (r *relocations) prefix(url string) string {
+	var match, prefix string
+	for baseURL, p := range r.prefixes {
+		if strings.HasPrefix(url, baseURL) && len(baseURL) > len(match) {
+			match, prefix = baseURL, p
+		}
+	}
+
+	return prefix
+}
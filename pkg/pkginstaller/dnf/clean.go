@@ -0,0 +1,33 @@
+package dnf
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type cleaner interface {
+	CleanAll(context.Context, string) error
+}
+
+type cmdClean struct {
+	log  logging.Logger
+	cmds *commander
+}
+
+// CleanAll runs a dnf clean all on the repository of the given name
+func (c *cmdClean) CleanAll(ctx context.Context, name string) error {
+	cmd := c.cmds.dnfCmd(
+		"dnf clean all",
+		0,
+		"--disablerepo=*",
+		fmt.Sprintf("--enablerepo=%s", name),
+		"clean",
+		"all",
+	)
+
+	cmd.Run(shell.Context(ctx))
+	return doPostMortem(cmd, c.log)
+}
@@ -0,0 +1,219 @@
+package dnf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type shellRunner interface {
+	Run(string, ...shell.Option) shellResulter
+}
+
+type shellResulter interface {
+	Stdout() []string
+	Stderr() []string
+	TimedOut() bool
+	Canceled() bool
+	Duration() float64
+	ExitCode() int
+	Err() error
+}
+
+// defaultRunner runs commands in a bash shell via the shell package
+type defaultRunner struct{}
+
+func (defaultRunner) Run(cmd string, opts ...shell.Option) shellResulter {
+	return newShellResult(shell.Run(cmd, opts...))
+}
+
+// newShellResult wraps a shell.Result, grabbing its output streams
+// straight away as these may only be read once
+func newShellResult(r *shell.Result) *shellResult {
+	return &shellResult{
+		Result: r,
+		stdout: r.Stdout().Lines(),
+		stderr: r.Stderr().Lines(),
+	}
+}
+
+type shellResult struct {
+	*shell.Result
+	stdout []string
+	stderr []string
+}
+
+func (r *shellResult) Stdout() []string {
+	return r.stdout
+}
+
+func (r *shellResult) Stderr() []string {
+	return r.stderr
+}
+
+// ----------------------------------------------------------------------
+
+type dnfCommand struct {
+	label   string
+	cmd     string
+	timeout int
+	result  shellResulter
+	runner  shellRunner
+}
+
+func (dc *dnfCommand) Run(opts ...shell.Option) {
+	if dc.timeout > 0 {
+		opts = append(opts, shell.Timeout(time.Duration(dc.timeout)*time.Second))
+	}
+
+	runner := dc.runner
+	if runner == nil {
+		runner = defaultRunner{}
+	}
+
+	dc.result = runner.Run(dc.cmd, opts...)
+}
+
+// Ran indicates if this command already executed
+func (dc *dnfCommand) Ran() bool {
+	return dc.result != nil
+}
+
+// Result retrieves the result object after running the command
+func (dc *dnfCommand) Result() shellResulter {
+	return dc.result
+}
+
+// Err returns an error if the command could not be run, or
+// if it exited with a non-zero exit code
+func (dc *dnfCommand) Err() error {
+	if dc.result == nil {
+		return nil
+	}
+
+	if err := dc.result.Err(); err != nil {
+		return err
+	}
+
+	if code := dc.result.ExitCode(); code != 0 {
+		return fmt.Errorf("%s exited with code %d", dc.label, code)
+	}
+
+	return nil
+}
+
+// outcome should only be called if the command failed.
+// It indicates briefly what the failure mode was.
+func (dc *dnfCommand) outcome() string {
+	var o string
+	switch {
+	case dc.result.TimedOut():
+		o = "timedout"
+	case dc.result.Canceled():
+		o = "aborted"
+	default:
+		o = "failed"
+	}
+
+	return o
+}
+
+func (dc *dnfCommand) ok() bool {
+	return dc.Err() == nil
+}
+
+func (dc *dnfCommand) duration() float64 {
+	return dc.result.Duration()
+}
+
+// ----------------------------------------------------------------------
+
+// commander builds the dnf and rpm command lines, all of which
+// share the same private configuration and RPM database
+type commander struct {
+	dnf     string
+	rpm     string
+	conf    string
+	root    string
+	dbpath  string
+	timeout int
+	runner  shellRunner
+}
+
+// dnfCmd returns a dnf command running the given subcommand
+// against our configuration file and install root
+func (c *commander) dnfCmd(label string, timeout int, subcmd ...string) *dnfCommand {
+	args := append(
+		[]string{
+			c.dnf,
+			"-y",
+			"--quiet",
+			fmt.Sprintf("--config=%s", c.conf),
+			fmt.Sprintf("--installroot=%s", c.root),
+		},
+		subcmd...,
+	)
+
+	return c.newCmd(label, timeout, args)
+}
+
+// rpmCmd returns an rpm command using the install root RPM database
+func (c *commander) rpmCmd(label string, timeout int, args ...string) *dnfCommand {
+	args = append([]string{c.rpm, fmt.Sprintf("--dbpath=%s", c.dbpath)}, args...)
+	return c.newCmd(label, timeout, args)
+}
+
+// newCmd returns the command running the given arguments,
+// each quoted for the shell in which it is run
+func (c *commander) newCmd(label string, timeout int, args []string) *dnfCommand {
+	if timeout == 0 {
+		timeout = c.timeout
+	}
+
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, quote(arg))
+	}
+
+	return &dnfCommand{
+		label:   label,
+		cmd:     strings.Join(quoted, " "),
+		timeout: timeout,
+		runner:  c.runner,
+	}
+}
+
+// quote single quotes the string for the shell,
+// including any single quotes within it
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// doPostMortem examines the result of having run the dnfCommand,
+// outputs to the provided logger and returns any error
+func doPostMortem(cmd *dnfCommand, log logging.Logger) error {
+	if !cmd.Ran() {
+		return nil
+	}
+
+	log.InfoL(cmd.Result().Stdout())
+
+	if cmd.ok() {
+		return nil
+	}
+
+	err := cmd.Err()
+	log.Error(
+		"dnf command failure",
+		logging.ErrField(err),
+		logging.F("outcome", cmd.outcome()),
+		logging.F("cmd", cmd.label),
+		logging.F("secs", cmd.duration()),
+	)
+	log.ErrorL(cmd.Result().Stderr())
+
+	return err
+}
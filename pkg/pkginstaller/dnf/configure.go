@@ -0,0 +1,91 @@
+package dnf
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type configurer interface {
+	PreConfigure(string) error
+	Configure(context.Context) error
+}
+
+type cmdConfigure struct {
+	installDir string
+	workDir    string
+	reposDir   string
+	log        logging.Logger
+	cmds       *commander
+}
+
+// PreConfigure will copy, for cache nightly installations,
+// the stable base release .rpmdb directory to the install root
+// RPM database to allow dependencies to be found.
+func (c *cmdConfigure) PreConfigure(stableRelBase string) error {
+	branch := filepath.Base(c.installDir)
+	isCacheNightly := (strings.Count(branch, ".")) > 2
+	if !isCacheNightly {
+		return nil
+	}
+
+	tokens := strings.Split(branch, ".")
+	baseRelease := strings.Join(tokens[:2], ".") // e.g. 21.2
+
+	stableRelSrc := filepath.Join(stableRelBase, baseRelease)
+	exists, err := fs.Exists(stableRelSrc)
+	if err != nil {
+		return fmt.Errorf("Unable to check existance of dir %s (%w)", stableRelSrc, err)
+	}
+
+	if !exists {
+		return fmt.Errorf("%s: stable release dir does not exist", stableRelSrc)
+	}
+
+	dst := c.cmds.dbpath
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("unable to remove directory tree %s (%w)", dst, err)
+	}
+
+	newdir, err := fs.NewDir(stableRelSrc, ".rpmdb")
+	if err != nil {
+		return err
+	}
+
+	return newdir.CopyTo(dst)
+}
+
+// Configure writes the dnf configuration file, pointing dnf at our
+// private repos, cache and log directories, then builds the repo cache
+func (c *cmdConfigure) Configure(ctx context.Context) error {
+	if err := ioutil.WriteFile(c.cmds.conf, []byte(c.conf()), 0644); err != nil {
+		return fmt.Errorf("unable to write dnf config %s (%w)", c.cmds.conf, err)
+	}
+
+	cmd := c.cmds.dnfCmd("dnf makecache", 0, "makecache")
+	cmd.Run(shell.Context(ctx))
+	return doPostMortem(cmd, c.log)
+}
+
+func (c *cmdConfigure) conf() string {
+	return strings.Join(
+		[]string{
+			"[main]",
+			fmt.Sprintf("cachedir=%s", filepath.Join(c.workDir, "cache")),
+			fmt.Sprintf("logdir=%s", filepath.Join(c.workDir, "log")),
+			fmt.Sprintf("persistdir=%s", filepath.Join(c.workDir, "persist")),
+			fmt.Sprintf("reposdir=%s", c.reposDir),
+			"keepcache=0",
+			"gpgcheck=0",
+			"install_weak_deps=0",
+		},
+		"\n",
+	) + "\n"
+}
@@ -0,0 +1,37 @@
+package dnf
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type downloader interface {
+	Download(context.Context) error
+}
+
+type cmdDownload struct {
+	workDir  string
+	reposDir string
+	log      logging.Logger
+	cmds     *commander
+}
+
+// Download has nothing to fetch, dnf being a system package. Instead, it
+// creates a fresh work directory and checks that the dnf binary is usable.
+func (c *cmdDownload) Download(ctx context.Context) error {
+	if err := os.RemoveAll(c.workDir); err != nil {
+		return fmt.Errorf("unable to remove dnf work dir %s (%w)", c.workDir, err)
+	}
+
+	if err := os.MkdirAll(c.reposDir, 0755); err != nil {
+		return fmt.Errorf("unable to create dnf repos dir %s (%w)", c.reposDir, err)
+	}
+
+	cmd := c.cmds.newCmd("dnf version", 0, []string{c.cmds.dnf, "--version"})
+	cmd.Run(shell.Context(ctx))
+	return doPostMortem(cmd, c.log)
+}
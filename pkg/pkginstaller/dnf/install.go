@@ -0,0 +1,151 @@
+package dnf
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type installer interface {
+	Install(context.Context, ...string) error
+	Classify(context.Context, ...string) ([]string, []string, error)
+}
+
+type cmdInstall struct {
+	lister
+	relocations    *relocations
+	installTimeout int
+	log            logging.Logger
+	cmds           *commander
+}
+
+// Install will install the provided RPMs, along with any dependencies
+// not yet in the install root. dnf resolves the full set of packages,
+// which are then installed with rpm so that each may be relocated to
+// the prefix of the repository from which it comes. Packages already
+// installed are reinstalled. If any step fails, stop and return an error.
+func (c *cmdInstall) Install(ctx context.Context, rpmsToInstall ...string) error {
+	if len(rpmsToInstall) == 0 {
+		return nil
+	}
+
+	// The categorisation is only logged, as rpm
+	// --replacepkgs handles both cases the same way
+	if _, _, err := c.Classify(ctx, rpmsToInstall...); err != nil {
+		return err
+	}
+
+	urls, err := c.resolve(ctx, removeFileExt(rpmsToInstall...)...)
+	if err != nil {
+		return fmt.Errorf("resolve RPMs failed (%w)", err)
+	}
+
+	byPrefix := c.groupByPrefix(urls)
+
+	// Install the non-relocated packages first, then
+	// each set of relocated packages in prefix order
+	var prefixes []string
+	for prefix := range byPrefix {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		if err := c.rpmInstall(ctx, prefix, byPrefix[prefix]); err != nil {
+			return fmt.Errorf("install RPMs failed (%w)", err)
+		}
+	}
+
+	return nil
+}
+
+// Classify splits the provided RPMs into those already
+// in the install root, to be reinstalled, and those to install.
+func (c *cmdInstall) Classify(ctx context.Context, rpms ...string) ([]string, []string, error) {
+	localPackages, err := c.Installed(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.log.Info(
+		"Checked for locally installed packages",
+		logging.F("nFound", len(*localPackages)),
+	)
+
+	toReinstall, toInstall := localPackages.matching(removeFileExt(rpms...)...)
+
+	c.log.Info(
+		"Categorised RPMs into already/not already installed",
+		logging.F("nToReinstall", len(toReinstall)),
+		logging.F("nToInstall", len(toInstall)),
+	)
+
+	return toReinstall, toInstall, nil
+}
+
+// resolve asks dnf for the URLs of the given packages and of
+// any of their dependencies not yet installed in the install root
+func (c *cmdInstall) resolve(ctx context.Context, names ...string) ([]string, error) {
+	args := append([]string{"download", "--resolve", "--url"}, names...)
+	cmd := c.cmds.dnfCmd("dnf download", 0, args...)
+	cmd.Run(shell.Context(ctx))
+	if err := doPostMortem(cmd, c.log); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, line := range cmd.Result().Stdout() {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, ".rpm") {
+			urls = append(urls, line)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("dnf resolved no packages to install")
+	}
+
+	return urls, nil
+}
+
+// groupByPrefix groups the RPM URLs by the relocation
+// prefix of the repository to which they belong
+func (c *cmdInstall) groupByPrefix(urls []string) map[string][]string {
+	var groups = map[string][]string{}
+	for _, url := range urls {
+		prefix := c.relocations.prefix(url)
+		groups[prefix] = append(groups[prefix], strings.TrimPrefix(url, "file://"))
+	}
+
+	return groups
+}
+
+// rpmInstall installs, or reinstalls, the given RPMs below the prefix,
+// if any. Dependencies were resolved by dnf, so rpm does not check them.
+func (c *cmdInstall) rpmInstall(ctx context.Context, prefix string, rpms []string) error {
+	args := []string{"--upgrade", "--replacepkgs", "--nodeps"}
+	if prefix != "" {
+		args = append(args, fmt.Sprintf("--prefix=%s", prefix))
+	}
+
+	cmd := c.cmds.rpmCmd("rpm install", c.installTimeout, append(args, rpms...)...)
+	cmd.Run(shell.Context(ctx))
+	return doPostMortem(cmd, c.log)
+}
+
+// removeFileExt is a helper function to remove the file extension from a list of file names
+func removeFileExt(filenames ...string) []string {
+	var names []string
+	for _, fn := range filenames {
+		ext := filepath.Ext(fn)
+		name := strings.TrimSuffix(fn, ext)
+		names = append(names, name)
+	}
+
+	return names
+}
@@ -0,0 +1,165 @@
+package dnf
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+	"github.com/brinick/logging"
+)
+
+func TestAddRemoteRepos(t *testing.T) {
+	d, cleanup := makeDnf(t, &fakeRunner{})
+	defer cleanup()
+
+	if err := d.Download(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := d.AddRemoteRepos([]*rpm.Repo{
+		&rpm.Repo{
+			Label:  "nightly",
+			Name:   "Nightly",
+			URL:    "/eos/nightlies/master",
+			Prefix: "/cvmfs/sw/2020-05-01T2101",
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("add remote repos returned an error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(d.WorkDir + "/yum.repos.d/nightly.repo")
+	if err != nil {
+		t.Fatalf("unable to read repo file (%v)", err)
+	}
+
+	expect := "[nightly]\nname=Nightly\nbaseurl=file:///eos/nightlies/master\nenabled=true\n"
+	if string(got) != expect {
+		t.Errorf("repo file should be:\n%s\ngot:\n%s", expect, got)
+	}
+}
+
+func TestRelocationsPrefix(t *testing.T) {
+	var r relocations
+	r.add(&rpm.Repo{URL: "http://cern.ch/RPMs", Prefix: "/sw"})
+	r.add(&rpm.Repo{URL: "http://cern.ch/RPMs/lcg/", Prefix: "/sw/lcg"})
+	r.add(&rpm.Repo{URL: "http://cern.ch/tdaq"})
+
+	var tests = []struct {
+		url    string
+		expect string
+	}{
+		{"http://cern.ch/RPMs/a.rpm", "/sw"},
+		{"http://cern.ch/RPMs/lcg/b.rpm", "/sw/lcg"},
+		{"http://cern.ch/RPMsOther/c.rpm", ""},
+		{"http://cern.ch/tdaq/d.rpm", ""},
+		{"file:///e.rpm", ""},
+	}
+
+	for _, tt := range tests {
+		if got := r.prefix(tt.url); got != tt.expect {
+			t.Errorf("prefix of %s should be %q, got %q", tt.url, tt.expect, got)
+		}
+	}
+}
+
+func TestLocalPackagesMatching(t *testing.T) {
+	var lister = cmdList{log: logging.NullLogger{}}
+	packages := lister.parseInstalled([]string{
+		"AtlasOffline 22.0.1-1.noarch",
+		"tdaq 9.0.0-1.x86_64",
+	})
+
+	installed, notInstalled := packages.matching(
+		"AtlasOffline-22.0.1-1.noarch",
+		"AtlasSetup-1.0.0-1.noarch",
+	)
+
+	if len(installed) != 1 || installed[0] != "AtlasOffline-22.0.1-1.noarch" {
+		t.Errorf("expected AtlasOffline to be already installed, got %v", installed)
+	}
+
+	if len(notInstalled) != 1 || notInstalled[0] != "AtlasSetup-1.0.0-1.noarch" {
+		t.Errorf("expected AtlasSetup not to be installed, got %v", notInstalled)
+	}
+}
+
+func TestInstallRelocates(t *testing.T) {
+	runner := &fakeRunner{
+		results: map[string]*fakeResult{
+			"'--query' '--all'": &fakeResult{
+				stdout: []string{"AtlasOffline 22.0.1-1.noarch"},
+			},
+			"'download' '--resolve' '--url'": &fakeResult{
+				stdout: []string{
+					"file:///eos/nightly/AtlasOffline-22.0.1-1.noarch.rpm",
+					"file:///eos/nightly/AtlasSetup-1.0.0-1.noarch.rpm",
+					"http://lcg/rpms/ROOT-6.20-1.x86_64.rpm",
+					"http://tdaq/tdaq-9.0.0-1.x86_64.rpm",
+				},
+			},
+		},
+	}
+
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	if err := d.Download(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := d.AddRemoteRepos([]*rpm.Repo{
+		&rpm.Repo{Label: "nightly", URL: "/eos/nightly", Prefix: "/sw/2020-05-01T2101"},
+		&rpm.Repo{Label: "lcg", URL: "http://lcg/rpms", Prefix: "/sw/lcg/releases"},
+		&rpm.Repo{Label: "tdaq", URL: "http://tdaq"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Install(
+		context.Background(),
+		"AtlasOffline-22.0.1-1.noarch.rpm",
+		"AtlasSetup-1.0.0-1.noarch.rpm",
+	)
+
+	if err != nil {
+		t.Fatalf("install returned an error: %v", err)
+	}
+
+	installs := runner.ran("'--upgrade' '--replacepkgs' '--nodeps'")
+	if len(installs) != 3 {
+		t.Fatalf("expected 3 rpm installs (one per prefix), got %d:\n%s", len(installs), strings.Join(installs, "\n"))
+	}
+
+	// No prefix first, then in prefix order
+	var expect = []string{
+		"'--nodeps' 'http://tdaq/tdaq-9.0.0-1.x86_64.rpm'",
+		"'--prefix=/sw/2020-05-01T2101' '/eos/nightly/AtlasOffline-22.0.1-1.noarch.rpm' '/eos/nightly/AtlasSetup-1.0.0-1.noarch.rpm'",
+		"'--prefix=/sw/lcg/releases' 'http://lcg/rpms/ROOT-6.20-1.x86_64.rpm'",
+	}
+
+	for i, cmd := range installs {
+		if !strings.HasSuffix(cmd, expect[i]) {
+			t.Errorf("rpm install %d should end with %q, got %q", i, expect[i], cmd)
+		}
+	}
+}
+
+func TestInstallResolvesNothing(t *testing.T) {
+	runner := &fakeRunner{}
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	if err := d.Install(context.Background(), "Missing-1.0-1.noarch.rpm"); err == nil {
+		t.Errorf("expected an error when dnf resolves no packages, got nil")
+	}
+
+	if len(runner.ran("--replacepkgs")) != 0 {
+		t.Errorf("no rpm install should have been run, got %v", runner.cmds)
+	}
+}
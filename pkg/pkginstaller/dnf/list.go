@@ -0,0 +1,100 @@
+package dnf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+type lister interface {
+	Installed(context.Context) (*localPackages, error)
+}
+
+type cmdList struct {
+	log  logging.Logger
+	cmds *commander
+}
+
+// Installed returns the list of packages in the install root RPM database.
+// If none are found, an empty slice is returned. If an error occurs,
+// the package list is nil.
+func (c *cmdList) Installed(ctx context.Context) (*localPackages, error) {
+	cmd := c.cmds.rpmCmd(
+		"rpm query all",
+		0,
+		"--query",
+		"--all",
+		`--queryformat=%{NAME} %{VERSION}-%{RELEASE}.%{ARCH}\n`,
+	)
+
+	cmd.Run(shell.Context(ctx))
+	if err := cmd.Err(); err != nil {
+		c.log.Error(
+			"Unable to retrieve locally installed package list",
+			logging.ErrField(err),
+		)
+		c.log.ErrorL(cmd.Result().Stderr())
+		return nil, fmt.Errorf("rpm query all - command failed: %w", err)
+	}
+
+	return c.parseInstalled(cmd.Result().Stdout()), nil
+}
+
+// parseInstalled parses the lines returned by the rpm query
+func (c *cmdList) parseInstalled(lines []string) *localPackages {
+	var packages = localPackages{}
+	for _, line := range lines {
+		tokens := strings.Fields(line)
+		if len(tokens) != 2 {
+			c.log.Info(
+				"rpm query all - skipping unexpected line",
+				logging.F("l", line),
+			)
+			continue
+		}
+
+		packages = append(packages, &localPackage{tokens[0], tokens[1]})
+	}
+
+	return &packages
+}
+
+// ----------------------------------------------------------------------
+
+// localPackage is a locally installed RPM package
+type localPackage struct {
+	Name    string
+	Version string
+}
+
+// FullName returns the name-version-release.arch of the
+// package, which is the RPM file name without extension
+func (p *localPackage) FullName() string {
+	return fmt.Sprintf("%s-%s", p.Name, p.Version)
+}
+
+type localPackages []*localPackage
+
+// matching splits the given RPM names into those
+// already installed and those not yet installed
+func (lp *localPackages) matching(rpmNames ...string) ([]string, []string) {
+	var d = map[string]bool{}
+	for _, p := range *lp {
+		d[p.FullName()] = true
+	}
+
+	var installed, notinstalled []string
+	for _, name := range rpmNames {
+		if d[name] {
+			installed = append(installed, name)
+			continue
+		}
+
+		notinstalled = append(notinstalled, name)
+	}
+
+	return installed, notinstalled
+}
@@ -0,0 +1,136 @@
+package dnf
+
+import (
+	"path/filepath"
+
+	"github.com/brinick/logging"
+)
+
+// New creates a new Dnf instance
+func New(opts *Opts, log logging.Logger) *Dnf {
+	return newDnf(opts, log, nil)
+}
+
+// newDnf creates a Dnf instance whose commands are executed by
+// the given runner, or by the default shell runner if nil
+func newDnf(opts *Opts, log logging.Logger, runner shellRunner) *Dnf {
+	binary := opts.Binary
+	if binary == "" {
+		binary = "/usr/bin/dnf"
+	}
+
+	rpmBinary := opts.RPMBinary
+	if rpmBinary == "" {
+		rpmBinary = "/usr/bin/rpm"
+	}
+
+	reposDir := filepath.Join(opts.WorkDir, "yum.repos.d")
+
+	cmds := &commander{
+		dnf:     binary,
+		rpm:     rpmBinary,
+		conf:    filepath.Join(opts.WorkDir, "dnf.conf"),
+		root:    opts.InstallDir,
+		dbpath:  filepath.Join(opts.InstallDir, "var/lib/rpm"),
+		timeout: opts.Timeout,
+		runner:  runner,
+	}
+
+	relocs := &relocations{}
+
+	d := &Dnf{
+		Binary:     binary,
+		WorkDir:    opts.WorkDir,
+		InstallDir: opts.InstallDir,
+		log:        log,
+		downloader: &cmdDownload{
+			workDir:  opts.WorkDir,
+			reposDir: reposDir,
+			log:      log,
+			cmds:     cmds,
+		},
+		rpmRepoAdder: &rpmRepoAdd{
+			reposDir:    reposDir,
+			relocations: relocs,
+		},
+		configurer: &cmdConfigure{
+			installDir: opts.InstallDir,
+			workDir:    opts.WorkDir,
+			reposDir:   reposDir,
+			log:        log,
+			cmds:       cmds,
+		},
+		installer: &cmdInstall{
+			lister: &cmdList{
+				log:  log,
+				cmds: cmds,
+			},
+			relocations:    relocs,
+			installTimeout: opts.InstallTimeout,
+			log:            log,
+			cmds:           cmds,
+		},
+		cleaner: &cmdClean{
+			log:  log,
+			cmds: cmds,
+		},
+	}
+
+	return d
+}
+
+// Opts configures the dnf instance
+type Opts struct {
+	// Binary is the path to the dnf executable
+	Binary string
+
+	// RPMBinary is the path to the rpm executable, used to
+	// install the (relocated) packages that dnf resolves
+	RPMBinary string
+
+	// WorkDir is the directory in which the dnf configuration,
+	// repo files and package cache are created
+	WorkDir string
+
+	// InstallDir is the dnf install root, containing the RPM database
+	InstallDir string
+
+	// Timeout is the general maximum number of seconds allowed
+	// to perform a dnf command
+	Timeout int
+
+	// InstallTimeout is the maximum number of seconds allowed
+	// in the install attempt
+	InstallTimeout int
+}
+
+// Dnf is the dnf wrapper
+type Dnf struct {
+	downloader
+	configurer
+	cleaner
+	rpmRepoAdder
+	installer
+
+	// Binary is the path to the dnf executable
+	Binary string
+
+	// WorkDir is the directory holding the dnf configuration
+	WorkDir string
+
+	// InstallDir is the root dir of the install path
+	InstallDir string
+
+	// log is a logger instance
+	log logging.Logger
+}
+
+// Name returns the name of the dnf executable
+func (d *Dnf) Name() string {
+	return "dnf"
+}
+
+// Log retrieves the logging instance to which dnf output is sent
+func (d *Dnf) Log() logging.Logger {
+	return d.log
+}
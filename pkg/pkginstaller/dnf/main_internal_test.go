@@ -0,0 +1,158 @@
+package dnf
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/brinick/logging"
+	"github.com/brinick/shell"
+)
+
+// fakeResult is a canned command result
+type fakeResult struct {
+	stdout   []string
+	stderr   []string
+	exitCode int
+}
+
+func (r *fakeResult) Stdout() []string  { return r.stdout }
+func (r *fakeResult) Stderr() []string  { return r.stderr }
+func (r *fakeResult) TimedOut() bool    { return false }
+func (r *fakeResult) Canceled() bool    { return false }
+func (r *fakeResult) Duration() float64 { return 0 }
+func (r *fakeResult) ExitCode() int     { return r.exitCode }
+func (r *fakeResult) Err() error        { return nil }
+
+// fakeRunner records the commands it is asked to run, and returns
+// the result registered against the first matching command fragment
+type fakeRunner struct {
+	cmds    []string
+	results map[string]*fakeResult
+}
+
+func (fr *fakeRunner) Run(cmd string, opts ...shell.Option) shellResulter {
+	fr.cmds = append(fr.cmds, cmd)
+	for fragment, res := range fr.results {
+		if strings.Contains(cmd, fragment) {
+			return res
+		}
+	}
+
+	return &fakeResult{}
+}
+
+// ran returns the recorded commands containing the given fragment
+func (fr *fakeRunner) ran(fragment string) []string {
+	var found []string
+	for _, cmd := range fr.cmds {
+		if strings.Contains(cmd, fragment) {
+			found = append(found, cmd)
+		}
+	}
+
+	return found
+}
+
+func makeDnf(t *testing.T, runner *fakeRunner) (*Dnf, func()) {
+	dir, err := ioutil.TempDir("", "dnf.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+
+	opts := &Opts{
+		WorkDir:    dir + "/work",
+		InstallDir: dir + "/install/master",
+	}
+
+	return newDnf(opts, logging.NullLogger{}, runner), func() { os.RemoveAll(dir) }
+}
+
+// ----------------------------------------------------
+
+func TestDownloadCreatesReposDir(t *testing.T) {
+	runner := &fakeRunner{}
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	if err := d.Download(context.Background()); err != nil {
+		t.Fatalf("download returned an error: %v", err)
+	}
+
+	if _, err := os.Stat(d.WorkDir + "/yum.repos.d"); err != nil {
+		t.Errorf("repos dir was not created (%v)", err)
+	}
+
+	if len(runner.ran("'/usr/bin/dnf' '--version'")) != 1 {
+		t.Errorf("expected dnf version check, got commands %v", runner.cmds)
+	}
+}
+
+func TestDownloadFailsIfNoDnf(t *testing.T) {
+	runner := &fakeRunner{
+		results: map[string]*fakeResult{
+			"--version": &fakeResult{exitCode: 127},
+		},
+	}
+
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	if err := d.Download(context.Background()); err == nil {
+		t.Errorf("expected an error if dnf cannot run, got nil")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	runner := &fakeRunner{}
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	if err := d.Download(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Configure(context.Background()); err != nil {
+		t.Fatalf("configure returned an error: %v", err)
+	}
+
+	conf, err := ioutil.ReadFile(d.WorkDir + "/dnf.conf")
+	if err != nil {
+		t.Fatalf("unable to read dnf.conf (%v)", err)
+	}
+
+	expect := "reposdir=" + d.WorkDir + "/yum.repos.d\n"
+	if !strings.Contains(string(conf), expect) {
+		t.Errorf("dnf.conf should contain %q, got:\n%s", expect, conf)
+	}
+
+	cmds := runner.ran("makecache")
+	if len(cmds) != 1 || !strings.Contains(cmds[0], "--installroot="+d.InstallDir) {
+		t.Errorf("expected a makecache in the install root, got %v", runner.cmds)
+	}
+}
+
+func TestCleanAll(t *testing.T) {
+	runner := &fakeRunner{}
+	d, cleanup := makeDnf(t, runner)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		if err := d.CleanAll(context.Background(), "atlas-offline-nightly"); err != nil {
+			t.Fatalf("clean all returned an error: %v", err)
+		}
+	}
+
+	cmds := runner.ran("'--disablerepo=*' '--enablerepo=atlas-offline-nightly' 'clean' 'all'")
+	if len(cmds) != 2 {
+		t.Errorf("expected 2 clean all commands, got %v", runner.cmds)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, expect := quote("it's *"), `'it'\''s *'`; got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+}
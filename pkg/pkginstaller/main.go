@@ -1,22 +1,47 @@
 package pkginstaller
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/ayum"
 	"github.com/brinick/atlas-rpm-installer/pkg/pkginstaller/dnf"
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+	"github.com/brinick/logging"
 )
 
-func choose(name string) func(opts, logpath) PkgInstaller {
+// Names lists the package installers that may be chosen
+var Names = []string{"ayum", "dnf"}
+
+// Opts groups the options of each of the available package installers
+type Opts struct {
+	Ayum *ayum.Opts
+	Dnf  *dnf.Opts
+}
+
+// New returns the package installer with the given name,
+// configured with its options and sending output to the logger
+func New(name string, opts *Opts, log logging.Logger) (PkgInstaller, error) {
 	switch name {
 	case "ayum":
-		return ayum.New
+		return ayum.New(opts.Ayum, log), nil
 	case "dnf":
-		panic("dnf installer not yet implemented")
+		return dnf.New(opts.Dnf, log), nil
 	default:
-		panic(fmt.Sprintf("%s: unknown package installer"))
+		return nil, fmt.Errorf("%s: unknown package installer", name)
 	}
 }
 
+// PkgInstaller is the interface that the package
+// installers provide for installing RPMs
 type PkgInstaller interface {
+	Name() string
+	Download(context.Context) error
+	PreConfigure(string) error
+	Configure(context.Context) error
+	AddRemoteRepos([]*rpm.Repo) error
+	CleanAll(context.Context, string) error
+	Install(context.Context, ...string) error
+	Classify(context.Context, ...string) ([]string, []string, error)
+	Log() logging.Logger
 }
@@ -0,0 +1,198 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Header tags holding the digests of the package,
+// see rpm's lib/rpmtag.h
+const (
+	sigTagSize           = 1000
+	sigTagLongSize       = 270
+	sigTagMD5            = 1004
+	sigTagSHA256         = 273
+	tagPayloadDigest     = 5092
+	tagPayloadDigestAlgo = 5093
+)
+
+// NewChecker returns a Checker of RPM digests which, if given
+// armored public key files, also checks RPM signatures
+func NewChecker(keyFiles ...string) (*Checker, error) {
+	c := &Checker{}
+	if len(keyFiles) == 0 {
+		return c, nil
+	}
+
+	keyring, err := rpm.KeyRingFromFiles(keyFiles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the GPG keys %s (%w)", strings.Join(keyFiles, ", "), err)
+	}
+
+	c.keyring = keyring
+	return c, nil
+}
+
+// Checker checks that RPMs are intact, and optionally signed
+type Checker struct {
+	keyring openpgp.KeyRing
+}
+
+// Check checks the SHA256 digest of the RPM header, the digest
+// of its payload and its size, rejecting a truncated or tampered
+// RPM. Given a keyring, it also checks the RPM signature.
+func (c *Checker) Check(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := checkDigests(file); err != nil {
+		return err
+	}
+
+	if c.keyring == nil {
+		return nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := rpm.GPGCheck(file, c.keyring); err != nil {
+		return fmt.Errorf("bad signature (%w)", err)
+	}
+
+	return nil
+}
+
+// CheckAll checks each RPM, returning a CheckError listing those failing
+func (c *Checker) CheckAll(rpms RPMs) error {
+	failed := map[string]error{}
+	for _, r := range rpms {
+		if err := c.Check(r.Path); err != nil {
+			failed[r.Path] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return CheckError{failed}
+	}
+
+	return nil
+}
+
+// checkDigests reads the RPM, checking the digests in its signature
+// header, and in its header for the payload, match its content
+func checkDigests(r io.Reader) error {
+	if _, err := rpm.ReadPackageLead(r); err != nil {
+		return err
+	}
+
+	sig, err := rpm.ReadPackageHeader(r)
+	if err != nil {
+		return fmt.Errorf("bad signature header (%w)", err)
+	}
+
+	// The signature header is padded to 8 bytes
+	if _, err := io.CopyN(ioutil.Discard, r, int64(8-(sig.Length%8))%8); err != nil {
+		return err
+	}
+
+	var raw bytes.Buffer
+	header, err := rpm.ReadPackageHeader(io.TeeReader(r, &raw))
+	if err != nil {
+		return fmt.Errorf("bad header (%w)", err)
+	}
+
+	newHash := digestAlgos[8]
+	if algo := header.Indexes.IntByTag(tagPayloadDigestAlgo); algo != 0 {
+		if newHash = digestAlgos[algo]; newHash == nil {
+			return fmt.Errorf("unknown payload digest algorithm %d", algo)
+		}
+	}
+
+	headerSum, md5Sum, payloadSum := sha256.New(), md5.New(), newHash()
+	headerSum.Write(raw.Bytes())
+	md5Sum.Write(raw.Bytes())
+
+	n, err := io.Copy(io.MultiWriter(md5Sum, payloadSum), r)
+	if err != nil {
+		return err
+	}
+
+	size := int64(raw.Len()) + n
+	if expected := sigSize(sig); expected != 0 && expected != size {
+		return fmt.Errorf("truncated or padded: header and payload are %d bytes, expected %d", size, expected)
+	}
+
+	expected := sig.Indexes.StringByTag(sigTagSHA256)
+	if expected == "" {
+		return fmt.Errorf("no SHA256 header digest")
+	}
+
+	if got := hex.EncodeToString(headerSum.Sum(nil)); got != expected {
+		return fmt.Errorf("header SHA256 digest %s, expected %s", got, expected)
+	}
+
+	// Older RPMs have no payload digest, only an MD5
+	// digest of the header and payload together
+	if digests := header.Indexes.StringsByTag(tagPayloadDigest); len(digests) > 0 {
+		if got := hex.EncodeToString(payloadSum.Sum(nil)); got != digests[0] {
+			return fmt.Errorf("payload digest %s, expected %s", got, digests[0])
+		}
+		return nil
+	}
+
+	if expected := sig.Indexes.BytesByTag(sigTagMD5); expected != nil {
+		if got := md5Sum.Sum(nil); !bytes.Equal(got, expected) {
+			return fmt.Errorf("MD5 digest %x, expected %x", got, expected)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no payload digest")
+}
+
+// sigSize returns the size of the header and payload
+// recorded in the signature header, 0 if there is none
+func sigSize(sig *rpm.Header) int64 {
+	if size := sig.Indexes.IntByTag(sigTagLongSize); size != 0 {
+		return size
+	}
+
+	// The size is an unsigned 32 bit integer
+	return int64(uint32(sig.Indexes.IntByTag(sigTagSize)))
+}
+
+// CheckError lists the RPMs failing their checks, and why
+type CheckError struct {
+	Failed map[string]error
+}
+
+func (c CheckError) Error() string {
+	var paths []string
+	for path := range c.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	lines := []string{fmt.Sprintf("%d RPMs failed their digest or signature checks:", len(paths))}
+	for _, path := range paths {
+		lines = append(lines, fmt.Sprintf("%s: %v", path, c.Failed[path]))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,189 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// headerEntry is a header tag value, of the given go-rpm index data type
+type headerEntry struct {
+	tag, typ, count int
+	value           []byte
+}
+
+func stringEntry(tag, typ int, values ...string) headerEntry {
+	return headerEntry{tag, typ, len(values), []byte(strings.Join(values, "\x00") + "\x00")}
+}
+
+func int32Entry(tag int, value uint32) headerEntry {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], value)
+	return headerEntry{tag, 4, 1, b[:]}
+}
+
+// encodeHeader encodes the entries as an RPM header structure
+func encodeHeader(entries ...headerEntry) []byte {
+	var index, store bytes.Buffer
+	for _, e := range entries {
+		for _, v := range []int{e.tag, e.typ, store.Len(), e.count} {
+			binary.Write(&index, binary.BigEndian, uint32(v))
+		}
+		store.Write(e.value)
+	}
+
+	var h bytes.Buffer
+	h.Write([]byte{0x8E, 0xAD, 0xE8, 0x01, 0, 0, 0, 0})
+	binary.Write(&h, binary.BigEndian, uint32(len(entries)))
+	binary.Write(&h, binary.BigEndian, uint32(store.Len()))
+	h.Write(index.Bytes())
+	h.Write(store.Bytes())
+	return h.Bytes()
+}
+
+// makeRPM returns the bytes of an RPM with the given payload, its
+// digests, any extra header entries and, given a signer, its signature
+func makeRPM(t *testing.T, payload string, signer *openpgp.Entity, extra ...headerEntry) []byte {
+	payloadSum := sha256.Sum256([]byte(payload))
+	header := encodeHeader(append([]headerEntry{
+		int32Entry(tagPayloadDigestAlgo, 8),
+		stringEntry(1000, 6, "AtlasOffline"),
+		stringEntry(tagPayloadDigest, 8, hex.EncodeToString(payloadSum[:])),
+	}, extra...)...)
+
+	headerSum := sha256.Sum256(header)
+	sigEntries := []headerEntry{
+		int32Entry(sigTagSize, uint32(len(header)+len(payload))),
+		stringEntry(sigTagSHA256, 6, hex.EncodeToString(headerSum[:])),
+	}
+
+	if signer != nil {
+		var sig bytes.Buffer
+		signed := append(append([]byte{}, header...), payload...)
+		if err := openpgp.DetachSign(&sig, signer, bytes.NewReader(signed), nil); err != nil {
+			t.Fatal(err)
+		}
+		sigEntries = append(sigEntries, headerEntry{1005, 7, sig.Len(), sig.Bytes()})
+	}
+
+	sigHeader := encodeHeader(sigEntries...)
+
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xED, 0xAB, 0xEE, 0xDB, 3, 0})
+	binary.BigEndian.PutUint16(lead[78:80], 5)
+
+	var rpm bytes.Buffer
+	rpm.Write(lead)
+	rpm.Write(sigHeader)
+	rpm.Write(make([]byte, (8-len(sigHeader)%8)%8))
+	rpm.Write(header)
+	rpm.WriteString(payload)
+	return rpm.Bytes()
+}
+
+// writeKey writes the armored public key of the entity to a file in dir
+func writeKey(t *testing.T, dir string, e *openpgp.Entity) string {
+	path := filepath.Join(dir, e.PrimaryKey.KeyIdShortString()+".asc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	signer, err := openpgp.NewEntity("atnight", "", "atnight@cern.ch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openpgp.NewEntity("other", "", "other@cern.ch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := makeRPM(t, "payload", signer)
+	tampered := makeRPM(t, "payload", signer)
+	tampered[len(tampered)-1] = 'D'
+
+	rpms := map[string][]byte{
+		"good.rpm":      good,
+		"truncated.rpm": good[:len(good)-2],
+		"tampered.rpm":  tampered,
+	}
+
+	var all RPMs
+	for name, data := range rpms {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, &RPM{Path: path})
+	}
+
+	checker, err := NewChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checker.CheckAll(all)
+	checkErr, ok := err.(CheckError)
+	if !ok || len(checkErr.Failed) != 2 {
+		t.Fatalf("expected the truncated and tampered RPMs to fail, got %v", err)
+	}
+
+	for _, name := range []string{"truncated.rpm", "tampered.rpm"} {
+		if checkErr.Failed[filepath.Join(dir, name)] == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %s to be listed as failing, got %v", name, err)
+		}
+	}
+
+	goodPath := filepath.Join(dir, "good.rpm")
+	signed, err := NewChecker(writeKey(t, dir, signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := signed.Check(goodPath); err != nil {
+		t.Errorf("expected the signature to be good, got %v", err)
+	}
+
+	unknown, err := NewChecker(writeKey(t, dir, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unknown.Check(goodPath); err == nil {
+		t.Error("expected a signature by an unknown key to fail")
+	}
+}
@@ -1,6 +1,7 @@
 package rpm
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -49,7 +50,24 @@ func NewFinder(path string) *Finder {
 
 // Finder is the object that locates RPMs below a given base directory
 type Finder struct {
-	basedir string
+	basedir          string
+	generateRepodata bool
+	checker          *Checker
+	wait             *WaitOpts
+}
+
+// WithRepodataGeneration has the Finder generate the yum repository
+// metadata in the source directory, if it does not already exist
+func (f *Finder) WithRepodataGeneration() *Finder {
+	f.generateRepodata = true
+	return f
+}
+
+// WithChecks has the Finder check the RPMs found, rejecting those
+// whose digests, or signatures, do not match their content
+func (f *Finder) WithChecks(c *Checker) *Finder {
+	f.checker = c
+	return f
 }
 
 // SrcDir returns the path to the root directory below which RPMs are found
@@ -59,7 +77,19 @@ func (f *Finder) SrcDir() string {
 
 type pathGlob func(string) ([]string, error)
 
-// findTopRPM finds the top RPM which we need to install (with its dependencies)
+// SeveralTopRPMsError is returned when more than one RPM in the source
+// directory matches the top RPM of the project and platform, so that
+// which to install is ambiguous
+type SeveralTopRPMsError struct {
+	Matches []string
+}
+
+func (s SeveralTopRPMsError) Error() string {
+	return fmt.Sprintf("%d top RPMs found to install (%s)", len(s.Matches), strings.Join(s.Matches, ", "))
+}
+
+// findTopRPM finds the top RPM which we need to install (with its
+// dependencies), returning a SeveralTopRPMsError if it is not unique
 func (f *Finder) findTopRPM(glob pathGlob, project, platform string) (string, error) {
 	fname := fmt.Sprintf("%s_*_%s.rpm", project, platform)
 	fpath := filepath.Join(f.basedir, fname)
@@ -72,27 +102,41 @@ func (f *Finder) findTopRPM(glob pathGlob, project, platform string) (string, er
 		return "", fmt.Errorf("no top RPM found to install (%s)", fpath)
 	}
 
+	if len(matches) > 1 {
+		return "", SeveralTopRPMsError{matches}
+	}
+
 	return matches[0], nil
 }
 
-// Find is the method that finds RPMs
+// Find is the method that finds RPMs: the top RPM for the project and
+// platform, followed by all of the RPMs in the source directory which it
+// requires, directly or otherwise. Requirements not provided by any RPM
+// in the source directory are left to the package manager to resolve
+// from its remote repositories: they are returned as an UnresolvedError,
+// along with the RPMs found.
 func (f *Finder) Find(project, platform string) (*RPMs, error) {
 	path, err := f.findTopRPM(filepath.Glob, project, platform)
 	if err != nil {
 		return nil, err
 	}
 	topRPM, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+
 	if topRPM.Size == 0 {
 		return nil, fmt.Errorf("%s: RPM has zero size", path)
 	}
 
-	deps, err := topRPM.LocalDependencies()
-	if err != nil {
+	var unresolved UnresolvedError
+	allRPMs, err := f.Dependencies(path)
+	if err != nil && !errors.As(err, &unresolved) {
 		return nil, err
 	}
 
 	// Ensure that no dependencies have zero size, else fail
-	emptyDeps := deps.ZeroSize()
+	emptyDeps := allRPMs.ZeroSize()
 	if len(emptyDeps) > 0 {
 		err = fmt.Errorf(
 			"%d rpm dependencies in %s have zero size:\n%s",
@@ -103,9 +147,80 @@ func (f *Finder) Find(project, platform string) (*RPMs, error) {
 		return nil, err
 	}
 
-	// Prepend the topRPM
-	allRPMs := RPMs(append([]*RPM{topRPM}, *deps...))
-	return &allRPMs, nil
+	// Reject truncated, or tampered, RPMs before they are installed
+	if f.checker != nil {
+		if err := f.checker.CheckAll(*allRPMs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unresolved.Unresolved) > 0 {
+		return allRPMs, unresolved
+	}
+
+	return allRPMs, nil
+}
+
+// headers returns the headers of all RPMs in the source directory, from
+// its yum repository metadata if it is up to date, else from the RPMs.
+// Missing or stale metadata is (re)generated first, if asked to.
+func (f *Finder) headers() ([]*Header, error) {
+	exists, err := HasRepodata(f.basedir)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		var stale StaleRepodataError
+		headers, err := ReadRepodata(f.basedir)
+		if !errors.As(err, &stale) {
+			return headers, err
+		}
+	}
+
+	// A failure to generate, for example in a read-only directory, or to
+	// read back, as the RPMs changed meanwhile, is not fatal: the RPMs
+	// are read instead
+	if f.generateRepodata && WriteRepodata(f.basedir) == nil {
+		if headers, err := ReadRepodata(f.basedir); err == nil {
+			return headers, nil
+		}
+	}
+
+	return ReadHeaders(f.basedir)
+}
+
+// Dependencies reads the headers of all RPMs in the source directory,
+// and returns the RPM at the given path followed by the RPMs it requires,
+// directly or transitively. Requirements that no RPM in the source
+// directory provides are returned as an UnresolvedError, along with
+// the dependencies that were found.
+func (f *Finder) Dependencies(path string) (*RPMs, error) {
+	headers, err := f.headers()
+	if err != nil {
+		return nil, err
+	}
+
+	var top *Header
+	for _, h := range headers {
+		if h.Path == path {
+			top = h
+			break
+		}
+	}
+
+	if top == nil {
+		return nil, fmt.Errorf("%s: RPM not found in %s", path, f.basedir)
+	}
+
+	closure, err := NewResolver(headers).Resolve(top)
+
+	var rpms RPMs
+	for _, h := range closure {
+		rpms = append(rpms, h.RPM())
+	}
+
+	return &rpms, err
 }
 
 // ---------------------------------------------------------------------
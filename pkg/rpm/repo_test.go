@@ -1,6 +1,7 @@
 package rpm
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -68,7 +69,7 @@ func TestRPMsZeroLength(t *testing.T) {
 
 func TestRPMFinderInexistantPath(t *testing.T) {
 	// Inexistant path, so expect an error
-	f := Finder{"/blip/blop"}
+	f := Finder{basedir: "/blip/blop"}
 	_, err := f.findTopRPM(filepath.Glob, "project", "platform")
 	if err == nil {
 		t.Errorf("RPM finder should have returned an error, got nil")
@@ -77,7 +78,7 @@ func TestRPMFinderInexistantPath(t *testing.T) {
 
 func TestRPMFinderTopRPM(t *testing.T) {
 	// Inexistant path, so expect an error
-	f := Finder{"/blip/blop"}
+	f := Finder{basedir: "/blip/blop"}
 	getMatches := func(string) ([]string, error) {
 		return []string{"topRPM.rpm"}, nil
 	}
@@ -88,6 +89,19 @@ func TestRPMFinderTopRPM(t *testing.T) {
 	}
 }
 
+func TestRPMFinderSeveralTopRPMs(t *testing.T) {
+	f := Finder{basedir: "/blip/blop"}
+	getMatches := func(string) ([]string, error) {
+		return []string{"topRPM_1.rpm", "topRPM_2.rpm"}, nil
+	}
+
+	_, err := f.findTopRPM(getMatches, "project", "platform")
+	var several SeveralTopRPMsError
+	if !errors.As(err, &several) {
+		t.Errorf("expected a SeveralTopRPMsError, got %v", err)
+	}
+}
+
 func TestNewRPM(t *testing.T) {
 	dir, err := ioutil.TempDir("", "atlas-rpm-installer-test")
 	if err != nil {
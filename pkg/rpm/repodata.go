@@ -0,0 +1,575 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+)
+
+const (
+	repodataDir = "repodata"
+	repomdFile  = "repomd.xml"
+
+	nsRepo   = "http://linux.duke.edu/metadata/repo"
+	nsCommon = "http://linux.duke.edu/metadata/common"
+	nsRPM    = "http://linux.duke.edu/metadata/rpm"
+)
+
+// primaryFiles matches the files which createrepo lists in primary.xml
+var primaryFiles = regexp.MustCompile(`^(.*/)*bin/.*|^/etc/.*|^/usr/lib/sendmail$`)
+
+// HasRepodata indicates if the given directory contains yum repository metadata
+func HasRepodata(dir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, repodataDir, repomdFile))
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// StaleRepodataError is returned when the yum repository metadata no
+// longer matches the RPMs in the directory, added, removed or replaced
+// since it was written
+type StaleRepodataError struct {
+	Dir    string
+	Reason string
+}
+
+func (s StaleRepodataError) Error() string {
+	return fmt.Sprintf("%s: stale repodata (%s)", s.Dir, s.Reason)
+}
+
+// ReadRepodata reads the RPM headers from the primary metadata of
+// the yum repository in the given directory, without opening any
+// of the RPM files themselves. The metadata must list every RPM in
+// the directory, with its current size and modification time, else
+// a StaleRepodataError is returned.
+func ReadRepodata(dir string) ([]*Header, error) {
+	repomdPath := filepath.Join(dir, repodataDir, repomdFile)
+	data, err := ioutil.ReadFile(repomdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var md repomd
+	if err := xml.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("unable to parse %s (%w)", repomdPath, err)
+	}
+
+	primary := md.find("primary")
+	if primary == nil {
+		return nil, fmt.Errorf("%s: no primary metadata listed", repomdPath)
+	}
+
+	primaryPath := filepath.Join(dir, primary.Location.Href)
+	data, err = ioutil.ReadFile(primaryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	newHash, ok := checksumTypes[primary.Checksum.Type]
+	if !ok {
+		return nil, StaleRepodataError{
+			dir,
+			fmt.Sprintf("unknown %s checksum type %q", primary.Location.Href, primary.Checksum.Type),
+		}
+	}
+
+	if sum := hashHex(newHash(), data); sum != primary.Checksum.Value {
+		return nil, fmt.Errorf(
+			"%s: checksum mismatch, expected %s, got %s",
+			primaryPath,
+			primary.Checksum.Value,
+			sum,
+		)
+	}
+
+	if strings.HasSuffix(primaryPath, ".gz") {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress %s (%w)", primaryPath, err)
+		}
+
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("unable to decompress %s (%w)", primaryPath, err)
+		}
+	}
+
+	var meta primaryMetadata
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("unable to parse %s (%w)", primaryPath, err)
+	}
+
+	files, err := rpmFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != len(meta.Packages) {
+		return nil, StaleRepodataError{
+			dir,
+			fmt.Sprintf("%d RPMs listed, %d found", len(meta.Packages), len(files)),
+		}
+	}
+
+	var headers []*Header
+	for _, p := range meta.Packages {
+		fi, found := files[p.Location.Href]
+		switch {
+		case !found:
+			return nil, StaleRepodataError{dir, fmt.Sprintf("%s not found", p.Location.Href)}
+		case fi.Size() != p.Size.Package || fi.ModTime().Unix() != p.Time.File:
+			return nil, StaleRepodataError{dir, fmt.Sprintf("%s changed", p.Location.Href)}
+		}
+
+		// The size is that on disk, so that truncated RPMs are caught
+		h := p.header(dir)
+		h.Size = fi.Size()
+		headers = append(headers, h)
+	}
+
+	return headers, nil
+}
+
+// rpmFiles returns the file info of each RPM in the directory, by name
+func rpmFiles(dir string) (map[string]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]os.FileInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".rpm" {
+			files[entry.Name()] = entry
+		}
+	}
+
+	return files, nil
+}
+
+// WriteRepodata generates the yum repository metadata (repomd.xml and
+// primary.xml.gz) from the headers of the RPMs in the given directory.
+// Any existing metadata is replaced.
+func WriteRepodata(dir string) error {
+	packages, err := openPackages(dir)
+	if err != nil {
+		return err
+	}
+
+	// Besides the usual primary files, also list those
+	// files which some RPM in the directory requires
+	required := requiredFiles(packages)
+
+	var meta = primaryMetadata{
+		XMLNS:    nsCommon,
+		XMLNSRPM: nsRPM,
+	}
+
+	for _, p := range packages {
+		pkg, err := newRepoPackage(p, required)
+		if err != nil {
+			return err
+		}
+
+		meta.Packages = append(meta.Packages, pkg)
+	}
+
+	return writeRepodata(dir, &meta)
+}
+
+// writeRepodata writes the primary metadata and the repomd.xml
+// file pointing to it into a temporary directory, which then
+// replaces the repodata directory.
+func writeRepodata(dir string, meta *primaryMetadata) error {
+	meta.Count = len(meta.Packages)
+	primary, err := xml.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode primary metadata (%w)", err)
+	}
+
+	primary = append([]byte(xml.Header), primary...)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(primary); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	sum := sha256Hex(gz.Bytes())
+	primaryName := fmt.Sprintf("%s-primary.xml.gz", sum)
+	now := time.Now().Unix()
+
+	md := repomd{
+		XMLNS:    nsRepo,
+		XMLNSRPM: nsRPM,
+		Revision: strconv.FormatInt(now, 10),
+		Data: []repomdData{
+			repomdData{
+				Type:         "primary",
+				Checksum:     checksum{Type: "sha256", Value: sum},
+				OpenChecksum: checksum{Type: "sha256", Value: sha256Hex(primary)},
+				Location:     location{Href: filepath.Join(repodataDir, primaryName)},
+				Timestamp:    now,
+				Size:         int64(gz.Len()),
+				OpenSize:     int64(len(primary)),
+			},
+		},
+	}
+
+	repomdData, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode repomd (%w)", err)
+	}
+
+	tmpDir := filepath.Join(dir, "."+repodataDir)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	for name, data := range map[string][]byte{
+		primaryName: gz.Bytes(),
+		repomdFile:  append([]byte(xml.Header), repomdData...),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			return fmt.Errorf("unable to write repodata file %s (%w)", name, err)
+		}
+	}
+
+	repodata := filepath.Join(dir, repodataDir)
+	if err := os.RemoveAll(repodata); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDir, repodata)
+}
+
+// checksumTypes are the hashes of the checksum types of the metadata
+// which may be read, "sha" being the sha1 of older createrepo versions
+var checksumTypes = map[string]func() hash.Hash{
+	"sha":    sha1.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func sha256Hex(data []byte) string {
+	return hashHex(sha256.New(), data)
+}
+
+func hashHex(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ---------------------------------------------------------------------
+// repomd.xml
+// ---------------------------------------------------------------------
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	XMLNSRPM string       `xml:"xmlns:rpm,attr"`
+	Revision string       `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+func (r *repomd) find(dataType string) *repomdData {
+	for i := range r.Data {
+		if r.Data[i].Type == dataType {
+			return &r.Data[i]
+		}
+	}
+
+	return nil
+}
+
+type repomdData struct {
+	Type         string   `xml:"type,attr"`
+	Checksum     checksum `xml:"checksum"`
+	OpenChecksum checksum `xml:"open-checksum"`
+	Location     location `xml:"location"`
+	Timestamp    int64    `xml:"timestamp"`
+	Size         int64    `xml:"size"`
+	OpenSize     int64    `xml:"open-size"`
+}
+
+type checksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type location struct {
+	Href string `xml:"href,attr"`
+}
+
+// ---------------------------------------------------------------------
+// primary.xml
+// ---------------------------------------------------------------------
+
+type primaryMetadata struct {
+	XMLName  xml.Name       `xml:"metadata"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	XMLNSRPM string         `xml:"xmlns:rpm,attr"`
+	Count    int            `xml:"packages,attr"`
+	Packages []*repoPackage `xml:"package"`
+}
+
+type repoPackage struct {
+	Type     string      `xml:"type,attr"`
+	Name     string      `xml:"name"`
+	Arch     string      `xml:"arch"`
+	Version  repoVersion `xml:"version"`
+	Checksum checksum    `xml:"checksum"`
+	Summary  string      `xml:"summary"`
+	Packager string      `xml:"packager"`
+	URL      string      `xml:"url"`
+	Time     repoTime    `xml:"time"`
+	Size     repoSize    `xml:"size"`
+	Location location    `xml:"location"`
+	Format   repoFormat  `xml:"format"`
+}
+
+type repoVersion struct {
+	Epoch   int    `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+}
+
+type repoTime struct {
+	File  int64 `xml:"file,attr"`
+	Build int64 `xml:"build,attr"`
+}
+
+type repoSize struct {
+	Package   int64 `xml:"package,attr"`
+	Installed int64 `xml:"installed,attr"`
+	Archive   int64 `xml:"archive,attr"`
+}
+
+type headerRange struct {
+	Start int64 `xml:"start,attr"`
+	End   int64 `xml:"end,attr"`
+}
+
+type repoEntry struct {
+	Name    string `xml:"name,attr"`
+	Flags   string `xml:"flags,attr,omitempty"`
+	Epoch   string `xml:"epoch,attr,omitempty"`
+	Version string `xml:"ver,attr,omitempty"`
+	Release string `xml:"rel,attr,omitempty"`
+	Pre     string `xml:"pre,attr,omitempty"`
+}
+
+// repoFormat is the <format> element, whose rpm:-prefixed children are
+// written as is. Reading is done via UnmarshalXML, as encoding/xml
+// would otherwise only match the prefixed names on its namespace.
+type repoFormat struct {
+	License     string      `xml:"rpm:license"`
+	Vendor      string      `xml:"rpm:vendor"`
+	Group       string      `xml:"rpm:group"`
+	BuildHost   string      `xml:"rpm:buildhost"`
+	SourceRPM   string      `xml:"rpm:sourcerpm"`
+	HeaderRange headerRange `xml:"rpm:header-range"`
+	Provides    []repoEntry `xml:"rpm:provides>rpm:entry"`
+	Requires    []repoEntry `xml:"rpm:requires>rpm:entry"`
+	Files       []string    `xml:"file"`
+}
+
+func (f *repoFormat) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var in struct {
+		License     string      `xml:"license"`
+		Vendor      string      `xml:"vendor"`
+		Group       string      `xml:"group"`
+		BuildHost   string      `xml:"buildhost"`
+		SourceRPM   string      `xml:"sourcerpm"`
+		HeaderRange headerRange `xml:"header-range"`
+		Provides    []repoEntry `xml:"provides>entry"`
+		Requires    []repoEntry `xml:"requires>entry"`
+		Files       []string    `xml:"file"`
+	}
+
+	if err := d.DecodeElement(&in, &start); err != nil {
+		return err
+	}
+
+	*f = repoFormat(in)
+	return nil
+}
+
+// newRepoPackage creates the primary metadata entry for the RPM
+func newRepoPackage(p *rpm.PackageFile, requiredFiles map[string]struct{}) (*repoPackage, error) {
+	sum, err := p.Checksum()
+	if err != nil {
+		return nil, fmt.Errorf("unable to checksum %s (%w)", p.Path(), err)
+	}
+
+	pkg := &repoPackage{
+		Type: "rpm",
+		Name: p.Name(),
+		Arch: p.Architecture(),
+		Version: repoVersion{
+			Epoch:   p.Epoch(),
+			Version: p.Version(),
+			Release: p.Release(),
+		},
+		Checksum: checksum{Type: "sha256", PkgID: "YES", Value: sum},
+		Summary:  p.Summary(),
+		Packager: p.Packager(),
+		URL:      p.URL(),
+		Time: repoTime{
+			File:  p.FileTime().Unix(),
+			Build: p.BuildTime().Unix(),
+		},
+		Size: repoSize{
+			Package:   int64(p.FileSize()),
+			Installed: int64(p.Size()),
+			Archive:   int64(p.ArchiveSize()),
+		},
+		Location: location{Href: filepath.Base(p.Path())},
+		Format: repoFormat{
+			License:     p.License(),
+			Vendor:      p.Vendor(),
+			BuildHost:   p.BuildHost(),
+			SourceRPM:   p.SourceRPM(),
+			HeaderRange: headerRangeOf(p),
+		},
+	}
+
+	if groups := p.Groups(); len(groups) > 0 {
+		pkg.Format.Group = groups[0]
+	}
+
+	for _, dep := range p.Provides() {
+		pkg.Format.Provides = append(pkg.Format.Provides, newRepoEntry(dep))
+	}
+
+	for _, dep := range p.Requires() {
+		if dep.Flags()&rpm.DepFlagRpmlib != 0 {
+			continue
+		}
+		pkg.Format.Requires = append(pkg.Format.Requires, newRepoEntry(dep))
+	}
+
+	for _, f := range p.Files() {
+		_, required := requiredFiles[f.Name()]
+		if required || primaryFiles.MatchString(f.Name()) {
+			pkg.Format.Files = append(pkg.Format.Files, f.Name())
+		}
+	}
+
+	return pkg, nil
+}
+
+// headerRangeOf returns the byte range of the main header in the RPM
+// file: after the 96 byte lead and the 8-byte aligned signature header
+func headerRangeOf(p *rpm.PackageFile) headerRange {
+	sig, hdr := p.Headers[0], p.Headers[1]
+	sigSize := int64(16 + 16*sig.IndexCount + sig.Length)
+	start := 96 + sigSize + (8-sigSize%8)%8
+	end := start + int64(16+16*hdr.IndexCount+hdr.Length)
+	return headerRange{start, end}
+}
+
+func newRepoEntry(dep rpm.Dependency) repoEntry {
+	c := NewCapability(dep.Name(), dep.Flags(), dep.Version())
+	e := repoEntry{Name: c.Name}
+	if c.Version != "" {
+		e.Flags = flagNames[c.sense()]
+		e.Epoch = strconv.Itoa(c.Epoch)
+		e.Version = c.Version
+		e.Release = c.Release
+	}
+
+	if dep.Flags()&rpm.DepFlagPrereq != 0 {
+		e.Pre = "1"
+	}
+
+	return e
+}
+
+// capability converts a primary metadata entry into a Capability
+func (e repoEntry) capability() Capability {
+	epoch, _ := strconv.Atoi(e.Epoch)
+	return Capability{
+		Name:    e.Name,
+		Flags:   flagValues[e.Flags],
+		Epoch:   epoch,
+		Version: e.Version,
+		Release: e.Release,
+	}
+}
+
+var flagNames = map[int]string{
+	rpm.DepFlagEqual:          "EQ",
+	rpm.DepFlagLesser:         "LT",
+	rpm.DepFlagLesserOrEqual:  "LE",
+	rpm.DepFlagGreater:        "GT",
+	rpm.DepFlagGreaterOrEqual: "GE",
+}
+
+var flagValues = map[string]int{
+	"EQ": rpm.DepFlagEqual,
+	"LT": rpm.DepFlagLesser,
+	"LE": rpm.DepFlagLesserOrEqual,
+	"GT": rpm.DepFlagGreater,
+	"GE": rpm.DepFlagGreaterOrEqual,
+}
+
+// header converts the primary metadata entry into an RPM Header,
+// whose path is relative to the given repository directory
+func (p *repoPackage) header(dir string) *Header {
+	h := &Header{
+		Path: filepath.Join(dir, p.Location.Href),
+		Size: p.Size.Package,
+		Self: Capability{
+			Name:    p.Name,
+			Flags:   rpm.DepFlagEqual,
+			Epoch:   p.Version.Epoch,
+			Version: p.Version.Version,
+			Release: p.Version.Release,
+		},
+		Files: p.Format.Files,
+	}
+
+	for _, e := range p.Format.Provides {
+		h.Provides = append(h.Provides, e.capability())
+	}
+
+	for _, e := range p.Format.Requires {
+		h.Requires = append(h.Requires, e.capability())
+	}
+
+	return h
+}
@@ -0,0 +1,241 @@
+package rpm
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeRepodata(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "repodata.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+
+	meta := &primaryMetadata{
+		XMLNS:    nsCommon,
+		XMLNSRPM: nsRPM,
+		Packages: []*repoPackage{
+			&repoPackage{
+				Type:     "rpm",
+				Name:     "AtlasOffline",
+				Version:  repoVersion{Version: "22.0.1", Release: "1"},
+				Size:     repoSize{Package: 1024},
+				Location: location{Href: "AtlasOffline-22.0.1-1.noarch.rpm"},
+				Format: repoFormat{
+					Requires: []repoEntry{
+						repoEntry{Name: "AtlasExternals", Flags: "GE", Epoch: "0", Version: "2.0"},
+						repoEntry{Name: "/bin/setup.sh"},
+					},
+				},
+			},
+			&repoPackage{
+				Type:     "rpm",
+				Name:     "AtlasExternals",
+				Version:  repoVersion{Version: "2.0.3", Release: "1"},
+				Size:     repoSize{Package: 2048},
+				Location: location{Href: "AtlasExternals-2.0.3-1.x86_64.rpm"},
+				Format: repoFormat{
+					Provides: []repoEntry{
+						repoEntry{Name: "AtlasExternals", Flags: "EQ", Epoch: "0", Version: "2.0.3", Release: "1"},
+					},
+					Files: []string{"/bin/setup.sh"},
+				},
+			},
+		},
+	}
+
+	if err := writeRepodata(dir, meta); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to write repodata (%v)", err)
+	}
+
+	// The RPMs listed, with their size and modification time
+	for _, p := range meta.Packages {
+		path := filepath.Join(dir, p.Location.Href)
+		if err := ioutil.WriteFile(path, make([]byte, p.Size.Package), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+
+		mtime := time.Unix(p.Time.File, 0)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRepodataRoundTrip(t *testing.T) {
+	dir, cleanup := makeRepodata(t)
+	defer cleanup()
+
+	exists, err := HasRepodata(dir)
+	if err != nil || !exists {
+		t.Fatalf("repodata should exist in %s (%v)", dir, err)
+	}
+
+	headers, err := ReadRepodata(dir)
+	if err != nil {
+		t.Fatalf("unable to read repodata (%v)", err)
+	}
+
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 headers, got %d", len(headers))
+	}
+
+	top := headers[0]
+	if top.Path != filepath.Join(dir, "AtlasOffline-22.0.1-1.noarch.rpm") || top.Size != 1024 {
+		t.Errorf("unexpected top header path/size: %s, %d", top.Path, top.Size)
+	}
+
+	if got := top.Requires[0].String(); got != "AtlasExternals >= 2.0" {
+		t.Errorf("requirement should be 'AtlasExternals >= 2.0', got %q", got)
+	}
+
+	closure, err := NewResolver(headers).Resolve(top)
+	if err != nil {
+		t.Fatalf("resolve returned an error: %v", err)
+	}
+
+	if got := strings.Join(names(closure), ","); got != "AtlasOffline,AtlasExternals" {
+		t.Errorf("closure should be AtlasOffline,AtlasExternals, got %s", got)
+	}
+}
+
+func TestRepodataPrimaryIsNamespaced(t *testing.T) {
+	dir, cleanup := makeRepodata(t)
+	defer cleanup()
+
+	matches, err := filepath.Glob(filepath.Join(dir, repodataDir, "*-primary.xml.gz"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected a single primary.xml.gz, got %v (%v)", matches, err)
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		`<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2">`,
+		`<rpm:requires>`,
+		`<rpm:entry name="AtlasExternals" flags="GE" epoch="0" ver="2.0"></rpm:entry>`,
+		`<file>/bin/setup.sh</file>`,
+	} {
+		if !strings.Contains(string(data), expect) {
+			t.Errorf("primary.xml should contain %s, got:\n%s", expect, data)
+		}
+	}
+}
+
+func TestReadRepodataChecksumMismatch(t *testing.T) {
+	dir, cleanup := makeRepodata(t)
+	defer cleanup()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, repodataDir, "*-primary.xml.gz"))
+	if err := ioutil.WriteFile(matches[0], []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadRepodata(dir); err == nil {
+		t.Errorf("expected a checksum mismatch error, got nil")
+	}
+}
+
+func TestReadRepodataStale(t *testing.T) {
+	for name, change := range map[string]func(dir string) error{
+		"added": func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "AtlasHLT-22.0.1-1.x86_64.rpm"), []byte("rpm"), 0644)
+		},
+		"removed": func(dir string) error {
+			return os.Remove(filepath.Join(dir, "AtlasExternals-2.0.3-1.x86_64.rpm"))
+		},
+		"replaced": func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "AtlasOffline-22.0.1-1.noarch.rpm"), []byte("truncated"), 0644)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := makeRepodata(t)
+			defer cleanup()
+
+			if err := change(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			var stale StaleRepodataError
+			if _, err := ReadRepodata(dir); !errors.As(err, &stale) {
+				t.Errorf("expected a StaleRepodataError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadRepodataChecksumType(t *testing.T) {
+	for typ, sum := range map[string]func([]byte) string{
+		"sha1":   func(data []byte) string { return hashHex(sha1.New(), data) },
+		"sha512": func(data []byte) string { return hashHex(sha512.New(), data) },
+		"md5":    nil,
+	} {
+		t.Run(typ, func(t *testing.T) {
+			dir, cleanup := makeRepodata(t)
+			defer cleanup()
+
+			// Rewrite the primary checksum with the given type
+			repomdPath := filepath.Join(dir, repodataDir, repomdFile)
+			repomd, err := ioutil.ReadFile(repomdPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(dir, repodataDir, "*-primary.xml.gz"))
+			primary, err := ioutil.ReadFile(matches[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value := "unknown"
+			if sum != nil {
+				value = sum(primary)
+			}
+
+			old := fmt.Sprintf(`<checksum type="sha256">%s</checksum>`, sha256Hex(primary))
+			replaced := fmt.Sprintf(`<checksum type="%s">%s</checksum>`, typ, value)
+			if !strings.Contains(string(repomd), old) {
+				t.Fatalf("expected repomd.xml to contain %s, got:\n%s", old, repomd)
+			}
+
+			repomd = []byte(strings.Replace(string(repomd), old, replaced, 1))
+			if err := ioutil.WriteFile(repomdPath, repomd, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stale StaleRepodataError
+			_, err = ReadRepodata(dir)
+			switch {
+			case sum != nil && err != nil:
+				t.Errorf("expected the %s checksum to match, got %v", typ, err)
+			case sum == nil && !errors.As(err, &stale):
+				t.Errorf("expected a StaleRepodataError, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package rpm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+	"github.com/cavaliercoder/go-rpm/version"
+)
+
+// Capability is something, possibly versioned, that an RPM provides or requires
+type Capability struct {
+	Name    string
+	Flags   int
+	Epoch   int
+	Version string
+	Release string
+}
+
+// NewCapability creates a Capability from its name, go-rpm
+// dependency flags and "[epoch:]version[-release]" string
+func NewCapability(name string, flags int, evr string) Capability {
+	epoch, ver, rel := parseEVR(evr)
+	return Capability{
+		Name:    name,
+		Flags:   flags,
+		Epoch:   epoch,
+		Version: ver,
+		Release: rel,
+	}
+}
+
+func (c Capability) String() string {
+	s := c.Name
+	if op := c.operator(); op != "" && c.Version != "" {
+		s = fmt.Sprintf("%s %s %s", s, op, c.evr())
+	}
+
+	return s
+}
+
+func (c Capability) operator() string {
+	switch c.sense() {
+	case rpm.DepFlagLesserOrEqual:
+		return "<="
+	case rpm.DepFlagLesser:
+		return "<"
+	case rpm.DepFlagGreaterOrEqual:
+		return ">="
+	case rpm.DepFlagGreater:
+		return ">"
+	case rpm.DepFlagEqual:
+		return "="
+	}
+
+	return ""
+}
+
+func (c Capability) evr() string {
+	s := c.Version
+	if c.Epoch > 0 {
+		s = fmt.Sprintf("%d:%s", c.Epoch, s)
+	}
+
+	if c.Release != "" {
+		s = fmt.Sprintf("%s-%s", s, c.Release)
+	}
+
+	return s
+}
+
+// sense returns just the version comparison flags
+func (c Capability) sense() int {
+	return c.Flags & (rpm.DepFlagLesser | rpm.DepFlagGreater | rpm.DepFlagEqual)
+}
+
+// isRPMLib indicates if the capability is one provided by rpm itself
+func (c Capability) isRPMLib() bool {
+	return c.Flags&rpm.DepFlagRpmlib != 0 || strings.HasPrefix(c.Name, "rpmlib(")
+}
+
+// SatisfiedBy indicates if the provided capability satisfies this
+// required one: the names must match, and the version ranges overlap,
+// following the rules of rpm's rpmdsCompare.
+func (c Capability) SatisfiedBy(p Capability) bool {
+	if c.Name != p.Name {
+		return false
+	}
+
+	// An unversioned requirement, or provide, matches anything
+	reqSense, provSense := c.sense(), p.sense()
+	if reqSense == 0 || provSense == 0 || c.Version == "" || p.Version == "" {
+		return true
+	}
+
+	cmp := compareEVR(p, c)
+	switch {
+	case cmp < 0:
+		return provSense&rpm.DepFlagGreater != 0 || reqSense&rpm.DepFlagLesser != 0
+	case cmp > 0:
+		return provSense&rpm.DepFlagLesser != 0 || reqSense&rpm.DepFlagGreater != 0
+	default:
+		return (provSense&rpm.DepFlagEqual != 0 && reqSense&rpm.DepFlagEqual != 0) ||
+			(provSense&rpm.DepFlagLesser != 0 && reqSense&rpm.DepFlagLesser != 0) ||
+			(provSense&rpm.DepFlagGreater != 0 && reqSense&rpm.DepFlagGreater != 0)
+	}
+}
+
+// evrOnly adapts the version parts of a Capability to the go-rpm version.Interface
+type evrOnly struct {
+	epoch   int
+	version string
+	release string
+}
+
+func (e evrOnly) Name() string    { return "" }
+func (e evrOnly) Epoch() int      { return e.epoch }
+func (e evrOnly) Version() string { return e.version }
+func (e evrOnly) Release() string { return e.release }
+
+// compareEVR compares the epoch, version and release of a and b, per
+// rpmvercmp rules. Releases are only compared if both a and b have one.
+func compareEVR(a, b Capability) int {
+	ea := evrOnly{a.Epoch, a.Version, a.Release}
+	eb := evrOnly{b.Epoch, b.Version, b.Release}
+	if a.Release == "" || b.Release == "" {
+		ea.release, eb.release = "", ""
+	}
+
+	return version.Compare(ea, eb)
+}
+
+// parseEVR splits a "[epoch:]version[-release]" string into its parts
+func parseEVR(evr string) (int, string, string) {
+	var epoch int
+	if i := strings.Index(evr, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(evr[:i])
+		evr = evr[i+1:]
+	}
+
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		return epoch, evr[:i], evr[i+1:]
+	}
+
+	return epoch, evr, ""
+}
+
+// ---------------------------------------------------------------------
+
+// Header holds those parts of an RPM header needed to resolve dependencies
+type Header struct {
+	Path     string
+	Size     int64
+	Self     Capability
+	Provides []Capability
+	Requires []Capability
+
+	// Files lists the files in the RPM that are
+	// required by some RPM, rather than all files
+	Files []string
+}
+
+// RPM returns the RPM for this header
+func (h *Header) RPM() *RPM {
+	return &RPM{Path: h.Path, Size: h.Size}
+}
+
+// ReadHeaders reads the header of every RPM in the given directory.
+// Only those files that some RPM in the directory requires are kept.
+func ReadHeaders(dir string) ([]*Header, error) {
+	packages, err := openPackages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	required := requiredFiles(packages)
+
+	var headers []*Header
+	for _, p := range packages {
+		headers = append(headers, newHeader(p, required))
+	}
+
+	return headers, nil
+}
+
+// openPackages reads the header of every RPM in the given directory
+func openPackages(dir string) ([]*rpm.PackageFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []*rpm.PackageFile
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".rpm" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		p, err := rpm.OpenPackageFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read RPM header %s (%w)", path, err)
+		}
+
+		packages = append(packages, p)
+	}
+
+	return packages, nil
+}
+
+// requiredFiles returns the file paths required by the packages,
+// to be looked for in each package's file list
+func requiredFiles(packages []*rpm.PackageFile) map[string]struct{} {
+	var files = map[string]struct{}{}
+	for _, p := range packages {
+		for _, dep := range p.Requires() {
+			if strings.HasPrefix(dep.Name(), "/") {
+				files[dep.Name()] = struct{}{}
+			}
+		}
+	}
+
+	return files
+}
+
+func newHeader(p *rpm.PackageFile, requiredFiles map[string]struct{}) *Header {
+	h := &Header{
+		Path: p.Path(),
+		Size: int64(p.FileSize()),
+		Self: Capability{
+			Name:    p.Name(),
+			Flags:   rpm.DepFlagEqual,
+			Epoch:   p.Epoch(),
+			Version: p.Version(),
+			Release: p.Release(),
+		},
+	}
+
+	for _, dep := range p.Provides() {
+		h.Provides = append(h.Provides, NewCapability(dep.Name(), dep.Flags(), dep.Version()))
+	}
+
+	for _, dep := range p.Requires() {
+		h.Requires = append(h.Requires, NewCapability(dep.Name(), dep.Flags(), dep.Version()))
+	}
+
+	if len(requiredFiles) > 0 {
+		for _, f := range p.Files() {
+			if _, required := requiredFiles[f.Name()]; required {
+				h.Files = append(h.Files, f.Name())
+			}
+		}
+	}
+
+	return h
+}
+
+// ---------------------------------------------------------------------
+
+// Unresolved is a requirement of an RPM that no RPM provides
+type Unresolved struct {
+	RPM         string
+	Requirement string
+}
+
+func (u Unresolved) String() string {
+	return fmt.Sprintf("%s requires %s", u.RPM, u.Requirement)
+}
+
+// UnresolvedError lists the requirements that could not be resolved
+type UnresolvedError struct {
+	Unresolved []Unresolved
+}
+
+func (u UnresolvedError) Error() string {
+	var lines []string
+	for _, unres := range u.Unresolved {
+		lines = append(lines, unres.String())
+	}
+
+	return fmt.Sprintf(
+		"%d unresolved requirement(s):\n%s",
+		len(u.Unresolved),
+		strings.Join(lines, "\n"),
+	)
+}
+
+// ---------------------------------------------------------------------
+
+type provider struct {
+	header *Header
+	cap    Capability
+}
+
+// NewResolver creates a dependency resolver over the given RPM headers
+func NewResolver(headers []*Header) *Resolver {
+	r := &Resolver{providers: map[string][]provider{}}
+	for _, h := range headers {
+		r.add(h)
+	}
+
+	return r
+}
+
+// Resolver finds the RPMs that provide the requirements of other RPMs
+type Resolver struct {
+	providers map[string][]provider
+}
+
+func (r *Resolver) add(h *Header) {
+	// Every RPM provides itself, and its files
+	caps := append([]Capability{h.Self}, h.Provides...)
+	for _, f := range h.Files {
+		caps = append(caps, Capability{Name: f})
+	}
+
+	for _, c := range caps {
+		r.providers[c.Name] = append(r.providers[c.Name], provider{h, c})
+	}
+}
+
+// Resolve returns the transitive closure of the RPMs required by the
+// top RPM, starting with the top RPM itself. If some requirements are
+// not provided by any RPM, these are returned in an UnresolvedError,
+// along with the closure of everything that could be resolved.
+func (r *Resolver) Resolve(top *Header) ([]*Header, error) {
+	var (
+		closure    = []*Header{top}
+		seen       = map[*Header]bool{top: true}
+		unresolved []Unresolved
+	)
+
+	// Breadth-first walk of the requirements
+	for i := 0; i < len(closure); i++ {
+		h := closure[i]
+		for _, req := range h.Requires {
+			if req.isRPMLib() {
+				continue
+			}
+
+			p := r.choose(req, seen)
+			if p == nil {
+				unresolved = append(unresolved, Unresolved{
+					RPM:         filepath.Base(h.Path),
+					Requirement: req.String(),
+				})
+				continue
+			}
+
+			if !seen[p] {
+				seen[p] = true
+				closure = append(closure, p)
+			}
+		}
+	}
+
+	if len(unresolved) > 0 {
+		sort.Slice(unresolved, func(i, j int) bool {
+			if unresolved[i].RPM != unresolved[j].RPM {
+				return unresolved[i].RPM < unresolved[j].RPM
+			}
+			return unresolved[i].Requirement < unresolved[j].Requirement
+		})
+		return closure, UnresolvedError{unresolved}
+	}
+
+	return closure, nil
+}
+
+// choose returns the RPM to satisfy the requirement, or nil if none
+// can. An RPM already chosen is preferred, otherwise the one with
+// the most recent version.
+func (r *Resolver) choose(req Capability, chosen map[*Header]bool) *Header {
+	var best *Header
+	for _, p := range r.providers[req.Name] {
+		if !req.SatisfiedBy(p.cap) {
+			continue
+		}
+
+		if chosen[p.header] {
+			return p.header
+		}
+
+		if best == nil || compareEVR(p.header.Self, best.Self) > 0 {
+			best = p.header
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,192 @@
+package rpm
+
+import (
+	"errors"
+	"testing"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+)
+
+func header(name, evr string, requires []Capability, provides ...Capability) *Header {
+	self := NewCapability(name, rpm.DepFlagEqual, evr)
+	return &Header{
+		Path:     "/rpms/" + name + "-" + evr + ".rpm",
+		Self:     self,
+		Requires: requires,
+		Provides: provides,
+	}
+}
+
+func req(name string, flags int, evr string) Capability {
+	return NewCapability(name, flags, evr)
+}
+
+func names(headers []*Header) []string {
+	var n []string
+	for _, h := range headers {
+		n = append(n, h.Self.Name)
+	}
+	return n
+}
+
+func TestParseEVR(t *testing.T) {
+	var tests = []struct {
+		evr     string
+		epoch   int
+		version string
+		release string
+	}{
+		{"1.0", 0, "1.0", ""},
+		{"1.0-2", 0, "1.0", "2"},
+		{"3:1.0-2.el7", 3, "1.0", "2.el7"},
+		{"22.0.1-1-2", 0, "22.0.1-1", "2"},
+		{"", 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		e, v, r := parseEVR(tt.evr)
+		if e != tt.epoch || v != tt.version || r != tt.release {
+			t.Errorf(
+				"parseEVR(%q) should give (%d, %q, %q), got (%d, %q, %q)",
+				tt.evr, tt.epoch, tt.version, tt.release, e, v, r,
+			)
+		}
+	}
+}
+
+func TestSatisfiedBy(t *testing.T) {
+	var (
+		eq = rpm.DepFlagEqual
+		ge = rpm.DepFlagGreaterOrEqual
+		gt = rpm.DepFlagGreater
+		lt = rpm.DepFlagLesser
+		le = rpm.DepFlagLesserOrEqual
+	)
+
+	var tests = []struct {
+		name   string
+		req    Capability
+		prov   Capability
+		expect bool
+	}{
+		{"different names", req("a", 0, ""), req("b", 0, ""), false},
+		{"unversioned requirement", req("a", 0, ""), req("a", eq, "1.0"), true},
+		{"unversioned provide", req("a", ge, "2.0"), req("a", 0, ""), true},
+		{"equal", req("a", eq, "1.0"), req("a", eq, "1.0"), true},
+		{"equal, release ignored", req("a", eq, "1.0"), req("a", eq, "1.0-3"), true},
+		{"equal, release differs", req("a", eq, "1.0-2"), req("a", eq, "1.0-3"), false},
+		{">= satisfied", req("a", ge, "1.9"), req("a", eq, "1.10"), true},
+		{">= not satisfied", req("a", ge, "1.10"), req("a", eq, "1.9"), false},
+		{"> at boundary", req("a", gt, "1.0"), req("a", eq, "1.0"), false},
+		{"< satisfied", req("a", lt, "2.0"), req("a", eq, "1.0"), true},
+		{"<= at boundary", req("a", le, "2.0"), req("a", eq, "2.0"), true},
+		{"epoch wins", req("a", ge, "2.0"), req("a", eq, "1:1.0"), true},
+		{"tilde sorts before", req("a", ge, "1.0"), req("a", eq, "1.0~rc1"), false},
+		{"provided range overlaps", req("a", lt, "2.0"), req("a", ge, "1.0"), true},
+		{"provided range disjoint", req("a", lt, "1.0"), req("a", gt, "2.0"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.SatisfiedBy(tt.prov); got != tt.expect {
+				t.Errorf("%s satisfied by %s should be %t, got %t", tt.req, tt.prov, tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestResolveTransitive(t *testing.T) {
+	top := header("AtlasOffline", "22.0.1-1", []Capability{
+		req("AtlasExternals", rpm.DepFlagGreaterOrEqual, "22.0.1"),
+		req("rpmlib(PayloadFilesHavePrefix)", rpm.DepFlagLesserOrEqual|rpm.DepFlagRpmlib, "4.0-1"),
+	})
+
+	externals := header("AtlasExternals", "22.0.1-1", []Capability{
+		req("libGaudi.so()(64bit)", 0, ""),
+		req("/usr/bin/setup.sh", 0, ""),
+	})
+
+	gaudi := header("Gaudi", "33.0-1", nil, req("libGaudi.so()(64bit)", 0, ""))
+
+	setup := header("AtlasSetup", "1.0-1", nil)
+	setup.Files = []string{"/usr/bin/setup.sh"}
+
+	unrelated := header("Unrelated", "1.0-1", nil)
+
+	r := NewResolver([]*Header{top, externals, gaudi, setup, unrelated})
+	closure, err := r.Resolve(top)
+	if err != nil {
+		t.Fatalf("resolve returned an error: %v", err)
+	}
+
+	expect := []string{"AtlasOffline", "AtlasExternals", "Gaudi", "AtlasSetup"}
+	got := names(closure)
+	if len(got) != len(expect) {
+		t.Fatalf("closure should be %v, got %v", expect, got)
+	}
+
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("closure should be %v, got %v", expect, got)
+			break
+		}
+	}
+}
+
+func TestResolveChoosesMatchingVersion(t *testing.T) {
+	top := header("Top", "1.0-1", []Capability{
+		req("Dep", rpm.DepFlagLesser, "2.0"),
+	})
+
+	old := header("Dep", "1.0-1", nil)
+	older := header("Dep", "0.9-1", nil)
+	newer := header("Dep", "2.0-1", nil)
+
+	closure, err := NewResolver([]*Header{top, newer, older, old}).Resolve(top)
+	if err != nil {
+		t.Fatalf("resolve returned an error: %v", err)
+	}
+
+	if len(closure) != 2 || closure[1] != old {
+		t.Errorf("expected the most recent Dep < 2.0 (1.0-1) to be chosen, got %v", closure[1].Self)
+	}
+}
+
+func TestResolveUnresolved(t *testing.T) {
+	top := header("Top", "1.0-1", []Capability{
+		req("Dep", rpm.DepFlagGreaterOrEqual, "3.0"),
+		req("Present", 0, ""),
+		req("Virtual", 0, ""),
+	})
+
+	dep := header("Dep", "2.0-1", nil)
+	present := header("Present", "1.0-1", []Capability{req("/bin/missing", 0, "")})
+
+	closure, err := NewResolver([]*Header{top, dep, present}).Resolve(top)
+
+	var unresolved UnresolvedError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected an UnresolvedError, got %v", err)
+	}
+
+	expect := []Unresolved{
+		{"Present-1.0-1.rpm", "/bin/missing"},
+		{"Top-1.0-1.rpm", "Dep >= 3.0"},
+		{"Top-1.0-1.rpm", "Virtual"},
+	}
+
+	if len(unresolved.Unresolved) != len(expect) {
+		t.Fatalf("expected unresolved %v, got %v", expect, unresolved.Unresolved)
+	}
+
+	for i := range expect {
+		if unresolved.Unresolved[i] != expect[i] {
+			t.Errorf("expected unresolved %v, got %v", expect[i], unresolved.Unresolved[i])
+		}
+	}
+
+	// What could be resolved is still returned
+	if got := names(closure); len(got) != 2 || got[1] != "Present" {
+		t.Errorf("expected closure [Top Present], got %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package rpm
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+)
+
+// Header tags read to verify the payload,
+// see rpm's lib/rpmtag.h
+const (
+	tagPrefixes       = 1098
+	tagFileDigestAlgo = 5011
+)
+
+// The kinds of problem found verifying an installed payload file
+const (
+	ProblemMissing = "missing"
+	ProblemType    = "type"
+	ProblemSize    = "size"
+	ProblemDigest  = "digest"
+	ProblemMode    = "mode"
+)
+
+// digestAlgos are the hashes, by rpm's PGPHASHALGO
+// value, with which payload files may be digested
+var digestAlgos = map[int64]func() hash.Hash{
+	1:  md5.New,
+	2:  sha1.New,
+	8:  sha256.New,
+	9:  sha512.New384,
+	10: sha512.New,
+	11: sha256.New224,
+}
+
+// Problem is an installed payload file not matching the RPM header
+type Problem struct {
+	RPM      string `json:"rpm"`
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Got      string `json:"got,omitempty"`
+}
+
+// Verification reports the verification of installed RPM payloads
+type Verification struct {
+	RPMs     int       `json:"rpms"`
+	Files    int       `json:"files"`
+	Skipped  int       `json:"skipped"`
+	Problems []Problem `json:"problems"`
+}
+
+// Add adds the other verification to this one
+func (v *Verification) Add(other *Verification) {
+	v.RPMs += other.RPMs
+	v.Files += other.Files
+	v.Skipped += other.Skipped
+	v.Problems = append(v.Problems, other.Problems...)
+}
+
+// payloadFile is a file listed in the RPM header
+type payloadFile struct {
+	Name   string
+	Size   int64
+	Mode   os.FileMode
+	Digest string
+	Flags  int64
+}
+
+// Verify checks the payload files listed in the RPM header against those
+// installed, the RPM being relocated to the given prefix. Files outside
+// the relocatable prefix, ghost files and, as they may be edited, config
+// files are skipped, as are digests unless asked for.
+func (r *RPM) Verify(ctx context.Context, prefix string, digests bool) (*Verification, error) {
+	p, err := rpm.OpenPackageFile(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RPM header %s (%w)", r.Path, err)
+	}
+
+	var oldPrefix string
+	if prefixes := p.GetStrings(1, tagPrefixes); len(prefixes) > 0 {
+		oldPrefix = prefixes[0]
+	}
+
+	newHash := digestAlgos[1]
+	if algo := p.GetInt(1, tagFileDigestAlgo); algo != 0 {
+		if newHash = digestAlgos[algo]; newHash == nil {
+			return nil, fmt.Errorf("unknown file digest algorithm %d in %s", algo, r.Path)
+		}
+	}
+
+	var files []payloadFile
+	for _, f := range p.Files() {
+		files = append(files, payloadFile{f.Name(), f.Size(), f.Mode(), f.Digest(), f.Flags()})
+	}
+
+	if !digests {
+		newHash = nil
+	}
+
+	return r.verify(ctx, files, oldPrefix, prefix, newHash)
+}
+
+// verify checks the files, relocated from the old to the new prefix,
+// also checking their digests if given the hash with which to compute them
+func (r *RPM) verify(ctx context.Context, files []payloadFile, oldPrefix, newPrefix string, newHash func() hash.Hash) (*Verification, error) {
+	v := &Verification{RPMs: 1}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if oldPrefix == "" || !strings.HasPrefix(f.Name, oldPrefix) ||
+			f.Flags&(rpm.FileFlagGhost|rpm.FileFlagConfig) != 0 {
+			v.Skipped++
+			continue
+		}
+
+		v.Files++
+		path := filepath.Join(newPrefix, strings.TrimPrefix(f.Name, oldPrefix))
+		if problem := verifyFile(path, f, newHash); problem != nil {
+			problem.RPM = r.Name()
+			problem.Path = path
+			v.Problems = append(v.Problems, *problem)
+		}
+	}
+
+	return v, nil
+}
+
+// verifyFile checks the installed file against its header entry,
+// returning the first problem found, if any
+func verifyFile(path string, f payloadFile, newHash func() hash.Hash) *Problem {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return &Problem{Kind: ProblemMissing, Got: err.Error()}
+	}
+
+	expected, got := f.Mode, info.Mode()
+	if expected&os.ModeType != got&os.ModeType {
+		return &Problem{Kind: ProblemType, Expected: expected.String(), Got: got.String()}
+	}
+
+	// Symlink permissions are meaningless
+	if got&os.ModeSymlink == 0 && expected.Perm() != got.Perm() {
+		return &Problem{Kind: ProblemMode, Expected: expected.String(), Got: got.String()}
+	}
+
+	if !got.IsRegular() {
+		return nil
+	}
+
+	if f.Size != info.Size() {
+		return &Problem{
+			Kind:     ProblemSize,
+			Expected: fmt.Sprintf("%d", f.Size),
+			Got:      fmt.Sprintf("%d", info.Size()),
+		}
+	}
+
+	if newHash == nil || f.Digest == "" {
+		return nil
+	}
+
+	digest, err := fileDigest(path, newHash())
+	if err != nil {
+		return &Problem{Kind: ProblemDigest, Expected: f.Digest, Got: err.Error()}
+	}
+
+	if digest != f.Digest {
+		return &Problem{Kind: ProblemDigest, Expected: f.Digest, Got: digest}
+	}
+
+	return nil
+}
+
+// fileDigest returns the hex encoded digest of the file
+func fileDigest(path string, h hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
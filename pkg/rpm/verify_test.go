@@ -0,0 +1,98 @@
+package rpm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rpm "github.com/cavaliercoder/go-rpm"
+)
+
+func sha256Of(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"ok":       "payload",
+		"modified": "PAYLOAD",
+		"resized":  "payload plus",
+		"chmoded":  "payload",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "chmoded"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("ok", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	file := func(name string, mode os.FileMode, flags int64) payloadFile {
+		return payloadFile{"/opt/atlas/" + name, 7, mode, sha256Of("payload"), flags}
+	}
+
+	files := []payloadFile{
+		file("ok", 0644, 0),
+		file("modified", 0644, 0),
+		file("resized", 0644, 0),
+		file("chmoded", 0644, 0),
+		file("link", os.ModeSymlink|0777, 0),
+		file("missing", 0644, 0),
+		file("ghost", 0644, rpm.FileFlagGhost),
+		file("config", 0644, rpm.FileFlagConfig),
+		{"/etc/not-relocated", 7, 0644, "", 0},
+	}
+
+	r := &RPM{Path: "/rpms/AtlasOffline-22.0.1-1.x86_64.rpm"}
+	v, err := r.verify(context.Background(), files, "/opt/atlas", dir, sha256.New)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.RPMs != 1 || v.Files != 6 || v.Skipped != 3 {
+		t.Errorf("expected 6 files checked, 3 skipped, got %+v", v)
+	}
+
+	expect := map[string]string{
+		filepath.Join(dir, "modified"): ProblemDigest,
+		filepath.Join(dir, "resized"):  ProblemSize,
+		filepath.Join(dir, "chmoded"):  ProblemMode,
+		filepath.Join(dir, "missing"):  ProblemMissing,
+	}
+
+	if len(v.Problems) != len(expect) {
+		t.Errorf("expected %d problems, got %+v", len(expect), v.Problems)
+	}
+
+	for _, p := range v.Problems {
+		if expect[p.Path] != p.Kind || p.RPM != r.Name() {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	}
+
+	// Without digests, the modified file goes unnoticed
+	v, err = r.verify(context.Background(), files, "/opt/atlas", dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.Problems) != len(expect)-1 {
+		t.Errorf("expected no digest problem, got %+v", v.Problems)
+	}
+}
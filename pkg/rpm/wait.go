@@ -0,0 +1,195 @@
+package rpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WaitOpts configures the wait for the nightly RPMs to be
+// fully copied to the source directory. Times are in seconds.
+type WaitOpts struct {
+	// Timeout is the longest wait (0: no timeout but the context's)
+	Timeout int `json:"timeout"`
+
+	// Poll is the interval between checks
+	Poll int `json:"poll"`
+
+	// Settle is how long the RPM sizes must be stable
+	Settle int `json:"settle"`
+
+	// Marker is the file whose presence marks the copy as complete
+	Marker string `json:"marker"`
+}
+
+// WithWait has the Finder wait, on calling Wait, for the
+// nightly RPMs to be fully copied to the source directory
+func (f *Finder) WithWait(opts *WaitOpts) *Finder {
+	f.wait = opts
+	return f
+}
+
+// WaitError is returned when the nightly was not complete in time
+type WaitError struct {
+	Waited time.Duration
+	Reason string
+	err    error
+}
+
+func (w WaitError) Error() string {
+	return fmt.Sprintf("nightly still incomplete after waiting %s: %s (%v)", w.Waited.Round(time.Second), w.Reason, w.err)
+}
+
+// Unwrap returns the error ending the wait, e.g. the context cancellation
+func (w WaitError) Unwrap() error {
+	return w.err
+}
+
+// Wait waits, if asked to, until the marker file appears in the source
+// directory or, failing that, until the top RPM of the project and platform
+// exists, the RPM sizes have been stable for the settle interval, and
+// the top RPM and its dependencies can all be read. Requirements that no
+// RPM in the directory provides are left to the remote repositories, so
+// do not hold the wait. It returns how long it
+// waited, with a WaitError if the nightly is still incomplete at the deadline.
+func (f *Finder) Wait(ctx context.Context, project, platform string) (time.Duration, error) {
+	start := time.Now()
+	if f.wait == nil {
+		return 0, nil
+	}
+
+	// The wait timing out is a failure, rather than a cancellation
+	waitCtx := ctx
+	if f.wait.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, time.Duration(f.wait.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	w := &completion{finder: f, project: project, platform: platform}
+	for {
+		reason, err := w.check()
+		if err != nil {
+			return time.Since(start), err
+		}
+
+		if reason == "" {
+			return time.Since(start), nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			err := ctx.Err()
+			if err == nil {
+				err = fmt.Errorf("timed out after %ds", f.wait.Timeout)
+			}
+			return time.Since(start), WaitError{time.Since(start), reason, err}
+		case <-time.After(time.Duration(f.wait.Poll) * time.Second):
+		}
+	}
+}
+
+// completion tracks the completion of the copy of the nightly RPMs
+type completion struct {
+	finder            *Finder
+	project, platform string
+	sizes             map[string]int64
+	stableSince       time.Time
+}
+
+// check returns why the nightly is not yet complete, or "" if it is
+func (c *completion) check() (string, error) {
+	f := c.finder
+	if f.wait.Marker != "" {
+		if _, err := os.Stat(filepath.Join(f.basedir, f.wait.Marker)); err == nil {
+			return "", nil
+		}
+	}
+
+	sizes, err := rpmSizes(f.basedir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "no source directory yet", nil
+		}
+		return "", err
+	}
+
+	if !sameSizes(sizes, c.sizes) {
+		c.sizes, c.stableSince = sizes, time.Now()
+	}
+
+	// Several top RPMs are not resolved by waiting
+	top, err := f.findTopRPM(filepath.Glob, c.project, c.platform)
+	var several SeveralTopRPMsError
+	if errors.As(err, &several) {
+		return "", err
+	}
+
+	if err != nil {
+		return "no top RPM yet", nil
+	}
+
+	if time.Since(c.stableSince) < time.Duration(f.wait.Settle)*time.Second {
+		return "RPMs still being copied", nil
+	}
+
+	// Headers of RPMs being copied are unreadable
+	headers, err := ReadHeaders(f.basedir)
+	if err != nil {
+		return fmt.Sprintf("unreadable RPMs (%v)", err), nil
+	}
+
+	for _, h := range headers {
+		if h.Path != top {
+			continue
+		}
+
+		closure, err := NewResolver(headers).Resolve(h)
+		var unresolved UnresolvedError
+		if err != nil && !errors.As(err, &unresolved) {
+			return "", err
+		}
+
+		for _, dep := range closure {
+			if dep.Size == 0 {
+				return fmt.Sprintf("empty dependency %s", filepath.Base(dep.Path)), nil
+			}
+		}
+
+		return "", nil
+	}
+
+	return "top RPM unreadable", nil
+}
+
+// rpmSizes returns the size of each RPM in the directory
+func rpmSizes(dir string) (map[string]int64, error) {
+	files, err := rpmFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := map[string]int64{}
+	for name, fi := range files {
+		sizes[name] = fi.Size()
+	}
+
+	return sizes, nil
+}
+
+func sameSizes(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, size := range a {
+		if other, ok := b[name]; !ok || other != size {
+			return false
+		}
+	}
+
+	return true
+}
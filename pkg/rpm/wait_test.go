@@ -0,0 +1,126 @@
+package rpm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const topRPM = "AtlasOffline_22.0.1_x86_64-centos7-gcc8-opt.rpm"
+
+func waitFinder(t *testing.T, opts *WaitOpts) (*Finder, func()) {
+	dir, err := ioutil.TempDir("", "wait.")
+	if err != nil {
+		t.Fatalf("failed to create temp dir (%v)", err)
+	}
+
+	return NewFinder(dir).WithWait(opts), func() { os.RemoveAll(dir) }
+}
+
+func TestWait(t *testing.T) {
+	f, cleanup := waitFinder(t, &WaitOpts{Timeout: 5, Poll: 1})
+	defer cleanup()
+
+	// The top RPM is still being copied
+	data := makeRPM(t, "payload", nil)
+	path := filepath.Join(f.SrcDir(), topRPM)
+	if err := ioutil.WriteFile(path, data[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(1200 * time.Millisecond)
+		ioutil.WriteFile(path, data, 0644)
+	}()
+
+	waited, err := f.Wait(context.Background(), "AtlasOffline", "x86_64-centos7-gcc8-opt")
+	if err != nil {
+		t.Fatalf("expected the nightly to be complete, got %v", err)
+	}
+
+	if waited < time.Second {
+		t.Errorf("expected to wait for the copy, waited %s", waited)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	f, cleanup := waitFinder(t, &WaitOpts{Timeout: 1, Poll: 1})
+	defer cleanup()
+
+	_, err := f.Wait(context.Background(), "AtlasOffline", "x86_64-centos7-gcc8-opt")
+
+	var waitErr WaitError
+	if !errors.As(err, &waitErr) || waitErr.Reason != "no top RPM yet" {
+		t.Fatalf("expected to time out without a top RPM, got %v", err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait timing out not to be a context error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Wait(ctx, "AtlasOffline", "x86_64-centos7-gcc8-opt"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the wait to be canceled, got %v", err)
+	}
+}
+
+func TestWaitMarker(t *testing.T) {
+	f, cleanup := waitFinder(t, &WaitOpts{Timeout: 1, Poll: 1, Settle: 60, Marker: ".complete"})
+	defer cleanup()
+
+	if err := ioutil.WriteFile(filepath.Join(f.SrcDir(), ".complete"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Wait(context.Background(), "AtlasOffline", "x86_64-centos7-gcc8-opt"); err != nil {
+		t.Errorf("expected the marker to mark the nightly complete, got %v", err)
+	}
+}
+
+func TestWaitUnresolved(t *testing.T) {
+	f, cleanup := waitFinder(t, &WaitOpts{Timeout: 2, Poll: 1})
+	defer cleanup()
+
+	// The top RPM requires an RPM of the remote repositories
+	data := makeRPM(t, "payload", nil,
+		int32Entry(1048, 0),
+		stringEntry(1049, 8, "AtlasExternals"),
+		stringEntry(1050, 8, ""),
+	)
+
+	if err := ioutil.WriteFile(filepath.Join(f.SrcDir(), topRPM), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Wait(context.Background(), "AtlasOffline", "x86_64-centos7-gcc8-opt"); err != nil {
+		t.Errorf("expected unresolved requirements not to hold the wait, got %v", err)
+	}
+}
+
+func TestWaitSeveralTopRPMs(t *testing.T) {
+	f, cleanup := waitFinder(t, &WaitOpts{Timeout: 5, Poll: 1})
+	defer cleanup()
+
+	data := makeRPM(t, "payload", nil)
+	for _, name := range []string{topRPM, "AtlasOffline_22.0.2_x86_64-centos7-gcc8-opt.rpm"} {
+		if err := ioutil.WriteFile(filepath.Join(f.SrcDir(), name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waited, err := f.Wait(context.Background(), "AtlasOffline", "x86_64-centos7-gcc8-opt")
+
+	var several SeveralTopRPMsError
+	if !errors.As(err, &several) || len(several.Matches) != 2 {
+		t.Errorf("expected the wait to fail on several top RPMs, got %v", err)
+	}
+
+	if waited >= time.Second {
+		t.Errorf("expected not to wait for several top RPMs, waited %s", waited)
+	}
+}
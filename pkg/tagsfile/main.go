@@ -167,6 +167,15 @@ func (t *TagsFile) Remove(values ...string) error {
 	return nil
 }
 
+// Load reads the entries of the tags file, if not already loaded
+func (t *TagsFile) Load() error {
+	if t.entries != nil {
+		return nil
+	}
+
+	return t.load()
+}
+
 // GetEntries returns the Entries object containing
 // the list of tags file entries
 func (t *TagsFile) GetEntries() *Entries {
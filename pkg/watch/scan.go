@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+// timestampLayout is the layout of nightly timestamp directory names
+const timestampLayout = "2006-01-02T1504"
+
+// Nightly is a nightly found below the nightly base directory,
+// in a <branch>/<platform>/<timestamp> directory
+type Nightly struct {
+	Branch    string
+	Platform  string
+	Timestamp string
+	Project   string
+
+	// TopRPM is the path to the top RPM of the project
+	TopRPM string
+}
+
+// Release returns the nightly release, <branch>/<platform>/<timestamp>
+func (n *Nightly) Release() string {
+	return filepath.Join(n.Branch, n.Platform, n.Timestamp)
+}
+
+// ID uniquely identifies the nightly
+func (n *Nightly) ID() string {
+	return filepath.Join(n.Release(), n.Project)
+}
+
+// ---------------------------------------------------------------------
+
+// NewScanner creates a scanner for nightlies of the given project
+// below the base directory, ignoring those older than maxAge
+func NewScanner(basedir, project string, maxAge time.Duration, log logging.Logger) *Scanner {
+	return &Scanner{
+		basedir: basedir,
+		project: project,
+		maxAge:  maxAge,
+		seen:    map[string]rpmStat{},
+		log:     log,
+	}
+}
+
+// Scanner finds the nightlies whose top RPM is complete. As RPMs are
+// copied into place, a top RPM is only considered complete once it is
+// of non-zero size, and its size and modification time have not changed
+// since the previous scan.
+type Scanner struct {
+	basedir string
+	project string
+	maxAge  time.Duration
+	log     logging.Logger
+
+	// seen holds the top RPM details from the previous scan
+	seen map[string]rpmStat
+}
+
+type rpmStat struct {
+	size    int64
+	modTime time.Time
+}
+
+// Scan returns the complete nightlies, oldest first
+func (s *Scanner) Scan() ([]*Nightly, error) {
+	pattern := filepath.Join(s.basedir, "*", "*", "*")
+	dirs, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		complete []*Nightly
+		seen     = map[string]rpmStat{}
+	)
+
+	for _, dir := range dirs {
+		n := s.nightly(dir)
+		if n == nil {
+			continue
+		}
+
+		// The top RPM may be being replaced, or removed
+		fi, err := os.Stat(n.TopRPM)
+		if err != nil {
+			s.log.Info(
+				"Skipping nightly, unable to stat its top RPM",
+				logging.F("nightly", n.ID()),
+				logging.ErrField(err),
+			)
+			continue
+		}
+
+		stat := rpmStat{fi.Size(), fi.ModTime()}
+		seen[n.TopRPM] = stat
+
+		if prev, found := s.seen[n.TopRPM]; found && prev == stat && stat.size > 0 {
+			complete = append(complete, n)
+		}
+	}
+
+	s.seen = seen
+
+	sort.Slice(complete, func(i, j int) bool {
+		if complete[i].Timestamp != complete[j].Timestamp {
+			return complete[i].Timestamp < complete[j].Timestamp
+		}
+		return complete[i].ID() < complete[j].ID()
+	})
+
+	return complete, nil
+}
+
+// nightly returns the nightly in the given timestamp directory,
+// or nil if it is not a recent nightly directory with a top RPM
+func (s *Scanner) nightly(dir string) *Nightly {
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	timestamp := filepath.Base(dir)
+	stamp, err := time.ParseInLocation(timestampLayout, timestamp, time.Local)
+	if err != nil || time.Since(stamp) > s.maxAge {
+		return nil
+	}
+
+	platform := filepath.Base(filepath.Dir(dir))
+	branch := filepath.Base(filepath.Dir(filepath.Dir(dir)))
+
+	matches, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s_*_%s.rpm", s.project, platform)))
+	if len(matches) == 0 {
+		return nil
+	}
+
+	return &Nightly{
+		Branch:    branch,
+		Platform:  platform,
+		Timestamp: timestamp,
+		Project:   s.project,
+		TopRPM:    matches[0],
+	}
+}
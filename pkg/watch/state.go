@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Install outcomes recorded in the state
+const (
+	StatusInstalled = "installed"
+	StatusFailed    = "failed"
+)
+
+// Record is the outcome of a nightly install attempt
+type Record struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// LoadState loads the state persisted at the given path,
+// returning an empty state if the file does not yet exist
+func LoadState(path string) (*State, error) {
+	s := &State{
+		path:    path,
+		records: map[string]*Record{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read watch state file %s (%w)", path, err)
+	}
+
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return nil, fmt.Errorf("unable to parse watch state file %s (%w)", path, err)
+	}
+
+	return s, nil
+}
+
+// State is the persistent record of the nightlies that the watcher has
+// attempted to install, keyed by nightly ID. Failed installs are recorded
+// too, and are not retried; remove the entry from the file to retry one.
+type State struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// Has indicates if an install of the nightly was already attempted
+func (s *State) Has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.records[id]
+	return found
+}
+
+// Get returns the record for the nightly, or nil if there is none
+func (s *State) Get(id string) *Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[id]
+}
+
+// Record records the outcome of the nightly install, and saves the state
+func (s *State) Record(id string, err error) error {
+	r := &Record{Status: StatusInstalled, Time: time.Now()}
+	if err != nil {
+		r.Status, r.Error = StatusFailed, err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[id] = r
+	return s.save()
+}
+
+// save writes the state to a temporary file that is then
+// renamed, so that the file is never left half written
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("unable to create watch state directory (%w)", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("unable to write watch state file (%w)", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to save watch state file (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package watch polls the nightly base directory for new nightlies,
+// and installs each of them once.
+package watch
+
+import (
+	"context"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+// InstallFunc installs the given nightly
+type InstallFunc func(ctx context.Context, n *Nightly) error
+
+// New creates a watcher that scans for new nightlies every interval,
+// installing them, in turn, with the install function
+func New(
+	scanner *Scanner,
+	state *State,
+	interval time.Duration,
+	install InstallFunc,
+	log logging.Logger,
+) *Watcher {
+	return &Watcher{
+		scanner:  scanner,
+		state:    state,
+		interval: interval,
+		install:  install,
+		log:      log,
+		queued:   map[string]bool{},
+	}
+}
+
+// Watcher queues the complete nightlies not yet recorded in
+// the state, and installs them one at a time, oldest first
+type Watcher struct {
+	scanner  *Scanner
+	state    *State
+	interval time.Duration
+	install  InstallFunc
+	log      logging.Logger
+
+	queue  []*Nightly
+	queued map[string]bool
+}
+
+// Run polls for, and installs, new nightlies until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll scans for new nightlies, and installs those queued
+func (w *Watcher) poll(ctx context.Context) {
+	nightlies, err := w.scanner.Scan()
+	if err != nil {
+		w.log.Error("Unable to scan for nightlies", logging.ErrField(err))
+	}
+
+	for _, n := range nightlies {
+		w.enqueue(n)
+	}
+
+	for len(w.queue) > 0 && ctx.Err() == nil {
+		n := w.queue[0]
+		w.queue = w.queue[1:]
+		delete(w.queued, n.ID())
+
+		w.log.Info("Installing new nightly", logging.F("nightly", n.ID()))
+		err := w.install(ctx, n)
+
+		// An install interrupted by the context is not recorded,
+		// so that it is attempted again on restart
+		if ctx.Err() != nil {
+			w.log.Info("Nightly install interrupted", logging.F("nightly", n.ID()))
+			return
+		}
+
+		if err != nil {
+			w.log.Error("Nightly install failed", logging.F("nightly", n.ID()), logging.ErrField(err))
+		}
+
+		if err := w.state.Record(n.ID(), err); err != nil {
+			w.log.Error("Unable to record nightly install", logging.F("nightly", n.ID()), logging.ErrField(err))
+		}
+	}
+}
+
+// enqueue adds the nightly to the install queue,
+// unless already queued or installed
+func (w *Watcher) enqueue(n *Nightly) {
+	if w.queued[n.ID()] || w.state.Has(n.ID()) {
+		return
+	}
+
+	w.log.Info("Queueing new nightly", logging.F("nightly", n.ID()))
+	w.queue = append(w.queue, n)
+	w.queued[n.ID()] = true
+}
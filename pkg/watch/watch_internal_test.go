@@ -0,0 +1,155 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/logging"
+)
+
+const testPlatform = "x86_64-centos7-gcc8-opt"
+
+// makeNightly creates a nightly directory below basedir, with a top RPM
+// of the given project whose content is data, returning the release
+func makeNightly(t *testing.T, basedir, branch string, age time.Duration, project, data string) string {
+	release := filepath.Join(branch, testPlatform, time.Now().Add(-age).Format(timestampLayout))
+	dir := filepath.Join(basedir, release)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rpm := filepath.Join(dir, project+"_22.0.1_"+testPlatform+".rpm")
+	if err := ioutil.WriteFile(rpm, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return release
+}
+
+func TestScanWaitsForCompleteTopRPM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release := makeNightly(t, dir, "master", time.Hour, "AthSimulation", "rpm")
+	makeNightly(t, dir, "21.0", time.Hour, "AthSimulation", "")
+	makeNightly(t, dir, "22.0", 40*24*time.Hour, "AthSimulation", "rpm")
+	makeNightly(t, dir, "22.0", time.Hour, "AtlasOffline", "rpm")
+
+	// A top RPM removed as it is found does not stop the scan
+	removed := filepath.Join(dir, makeNightly(t, dir, "23.0", time.Hour, "AthSimulation", "rpm"))
+	top := filepath.Join(removed, "AthSimulation_22.0.1_"+testPlatform+".rpm")
+	if err := os.Remove(top); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(removed, "gone.rpm"), top); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScanner(dir, "AthSimulation", 30*24*time.Hour, logging.NullLogger{})
+
+	nightlies, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nightlies) != 0 {
+		t.Fatalf("expected no complete nightly on the first scan, got %d", len(nightlies))
+	}
+
+	nightlies, err = s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nightlies) != 1 {
+		t.Fatalf("expected 1 complete nightly, got %d", len(nightlies))
+	}
+
+	if nightlies[0].Release() != release || nightlies[0].Branch != "master" {
+		t.Errorf("expected nightly %s, got %s", release, nightlies[0].Release())
+	}
+}
+
+func TestStatePersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state", "installed.json")
+	s, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Record("a", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Record("b", errors.New("install failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Has("a") || s.Get("a").Status != StatusInstalled {
+		t.Errorf("expected nightly a to be recorded as installed")
+	}
+
+	if r := s.Get("b"); r == nil || r.Status != StatusFailed || r.Error != "install failed" {
+		t.Errorf("expected nightly b to be recorded as failed, got %+v", r)
+	}
+}
+
+func TestWatcherInstallsOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release := makeNightly(t, dir, "master", time.Hour, "AthSimulation", "rpm")
+	done := makeNightly(t, dir, "22.0", time.Hour, "AthSimulation", "rpm")
+
+	state, err := LoadState(filepath.Join(dir, "installed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Record(filepath.Join(done, "AthSimulation"), nil)
+
+	var installed []string
+	w := New(
+		NewScanner(dir, "AthSimulation", 30*24*time.Hour, logging.NullLogger{}),
+		state,
+		time.Minute,
+		func(ctx context.Context, n *Nightly) error {
+			installed = append(installed, n.Release())
+			return nil
+		},
+		logging.NullLogger{},
+	)
+
+	for i := 0; i < 3; i++ {
+		w.poll(context.Background())
+	}
+
+	if len(installed) != 1 || installed[0] != release {
+		t.Errorf("expected only %s to be installed, got %v", release, installed)
+	}
+
+	if !state.Has(filepath.Join(release, "AthSimulation")) {
+		t.Errorf("expected the installed nightly to be recorded")
+	}
+}
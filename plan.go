@@ -0,0 +1,195 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+)
+
+// Plan describes what an install would do, without doing it
+type Plan struct {
+	NightlyID  string `json:"nightly_id"`
+	PkgManager string `json:"pkg_manager"`
+	SrcDir     string `json:"src_dir"`
+	InstallDir string `json:"install_dir"`
+
+	// Installs lists, per package manager install, the
+	// RPMs to be installed and those to be reinstalled
+	Installs []*PlanInstall `json:"installs"`
+
+	// RepoFiles are the repo files that would be written
+	RepoFiles []*PlanRepoFile `json:"repo_files"`
+
+	// CleanDirs are the directories deleted post install
+	CleanDirs []string `json:"clean_dirs"`
+
+	// TagsEntries are the lines appended to the tags file
+	TagsEntries []string `json:"tags_entries"`
+
+	// Unresolved are the requirements that no RPM in the source
+	// directory provides, left to the remote repositories
+	Unresolved []string `json:"unresolved,omitempty"`
+
+	// Warnings are problems met while planning that
+	// make the plan less accurate than it could be
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PlanInstall is a single package manager install of a set of RPMs
+type PlanInstall struct {
+	Install   []string `json:"install"`
+	Reinstall []string `json:"reinstall"`
+}
+
+// PlanRepoFile is a repo file written by the package manager
+type PlanRepoFile struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// JSON returns the plan encoded as indented JSON
+func (p *Plan) JSON() (string, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode install plan (%w)", err)
+	}
+
+	return string(data) + "\n", nil
+}
+
+func (p *Plan) String() string {
+	var lines = []string{
+		fmt.Sprintf("Install plan for nightly %s", p.NightlyID),
+		fmt.Sprintf("- Package manager: %s", p.PkgManager),
+		fmt.Sprintf("- RPM source dir: %s", p.SrcDir),
+		fmt.Sprintf("- Install dir: %s", p.InstallDir),
+	}
+
+	for i, install := range p.Installs {
+		lines = append(lines, fmt.Sprintf("- Install %d/%d:", i+1, len(p.Installs)))
+		lines = append(lines, indentList("install", install.Install)...)
+		lines = append(lines, indentList("reinstall", install.Reinstall)...)
+	}
+
+	lines = append(lines, fmt.Sprintf("- Repo files (%d):", len(p.RepoFiles)))
+	for _, repo := range p.RepoFiles {
+		lines = append(lines, fmt.Sprintf("   - %s:", repo.Filename))
+		for _, line := range strings.Split(strings.TrimSpace(repo.Content), "\n") {
+			lines = append(lines, "        "+line)
+		}
+	}
+
+	lines = append(lines, indentList("Directories to delete", p.CleanDirs)...)
+	lines = append(lines, indentList("Tags file entries to append", p.TagsEntries)...)
+	lines = append(lines, indentList("Requirements left to the remote repos", p.Unresolved)...)
+
+	if len(p.Warnings) > 0 {
+		lines = append(lines, indentList("Warnings", p.Warnings)...)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func indentList(title string, items []string) []string {
+	var lines = []string{fmt.Sprintf("   - %s (%d):", title, len(items))}
+	for _, item := range items {
+		lines = append(lines, "      "+item)
+	}
+
+	return lines
+}
+
+// ---------------------------------------------------------------------
+
+// Plan works out what Execute would do, without opening the
+// file system transaction or changing anything on disk: the RPMs
+// to (re)install, the repo files, the directories to be cleaned
+// and the tags file entries to be added.
+func (inst *Installer) Plan(ctx context.Context) (*Plan, error) {
+	rpmsList, unresolved, err := inst.getRPMs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		NightlyID:  inst.NightlyID(),
+		PkgManager: inst.pkg.Name(),
+		SrcDir:     inst.rpms.SrcDir(),
+		InstallDir: inst.NightlyInstallDir(),
+		CleanDirs:  inst.dirsToClean(),
+	}
+
+	for _, u := range unresolved {
+		plan.Unresolved = append(plan.Unresolved, u.String())
+	}
+
+	for _, rpms := range rpmsList {
+		toReinstall, toInstall, err := inst.pkg.Classify(ctx, rpms.Names()...)
+		if err != nil {
+			// Without the list of installed packages, assume a fresh install
+			plan.Warnings = append(
+				plan.Warnings,
+				fmt.Sprintf("unable to list installed packages, assuming none (%v)", err),
+			)
+			toReinstall, toInstall = nil, rpms.Names()
+		}
+
+		plan.Installs = append(plan.Installs, &PlanInstall{
+			Install:   toInstall,
+			Reinstall: toReinstall,
+		})
+	}
+
+	for _, repo := range inst.getRemoteRepos() {
+		plan.RepoFiles = append(plan.RepoFiles, &PlanRepoFile{
+			Filename: repo.Filename(),
+			Content:  repo.String(),
+		})
+	}
+
+	projects, nextRelease := inst.nightlyProjects(rpmsList)
+	if nextRelease == "" {
+		plan.Warnings = append(
+			plan.Warnings,
+			fmt.Sprintf("no %s RPM found to give the next release for the tags file", inst.opts.Project),
+		)
+	}
+
+	plan.TagsEntries = inst.tagsEntries(projects, nextRelease).AsLines()
+	return plan, nil
+}
+
+// nightlyProjects returns the projects, and the next release of the
+// installed project, from the nightly RPM names, which are of the form
+// <project>_<release>_<platform>.rpm. These are the project directories
+// that the install creates, from which writeTagsFile works.
+func (inst *Installer) nightlyProjects(rpmsList []*rpm.RPMs) ([]string, string) {
+	var (
+		projects    []string
+		nextRelease string
+		suffix      = fmt.Sprintf("_%s.rpm", inst.opts.Platform)
+	)
+
+	for _, rpms := range rpmsList {
+		for _, name := range rpms.Names() {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+
+			tokens := strings.SplitN(strings.TrimSuffix(name, suffix), "_", 2)
+			if len(tokens) != 2 {
+				continue
+			}
+
+			projects = append(projects, tokens[0])
+			if tokens[0] == inst.opts.Project {
+				nextRelease = tokens[1]
+			}
+		}
+	}
+
+	return projects, nextRelease
+}
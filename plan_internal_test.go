@@ -0,0 +1,170 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+	"github.com/brinick/logging"
+)
+
+// fakePkgManager records calls and classifies RPMs against a fixed installed list
+type fakePkgManager struct {
+	installed   map[string]bool
+	classifyErr error
+	calls       []string
+}
+
+func (f *fakePkgManager) Name() string                           { return "fake" }
+func (f *fakePkgManager) Log() logging.Logger                    { return logging.NullLogger{} }
+func (f *fakePkgManager) Download(context.Context) error         { return f.call("download") }
+func (f *fakePkgManager) PreConfigure(string) error              { return f.call("preconfigure") }
+func (f *fakePkgManager) Configure(context.Context) error        { return f.call("configure") }
+func (f *fakePkgManager) AddRemoteRepos([]*rpm.Repo) error       { return f.call("addrepos") }
+func (f *fakePkgManager) CleanAll(context.Context, string) error { return f.call("clean") }
+
+func (f *fakePkgManager) Install(ctx context.Context, rpms ...string) error {
+	return f.call("install " + strings.Join(rpms, " "))
+}
+
+func (f *fakePkgManager) Classify(ctx context.Context, rpms ...string) ([]string, []string, error) {
+	if f.classifyErr != nil {
+		return nil, nil, f.classifyErr
+	}
+
+	var reinstall, install []string
+	for _, r := range rpms {
+		if f.installed[r] {
+			reinstall = append(reinstall, r)
+			continue
+		}
+		install = append(install, r)
+	}
+
+	return reinstall, install, nil
+}
+
+func (f *fakePkgManager) call(name string) error {
+	f.calls = append(f.calls, name)
+	return nil
+}
+
+type fakeFinder struct {
+	rpms rpm.RPMs
+	err  error
+}
+
+func (f *fakeFinder) Find(string, string) (*rpm.RPMs, error) { return &f.rpms, f.err }
+func (f *fakeFinder) SrcDir() string                         { return "/eos/nightlies/master" }
+
+func makePlanInstaller(pkg *fakePkgManager) *Installer {
+	finder := &fakeFinder{
+		rpms: rpm.RPMs{
+			&rpm.RPM{Path: "/eos/AtlasOffline_22.0.1_x86_64-centos7-gcc8-opt.rpm", Size: 10},
+			&rpm.RPM{Path: "/eos/AtlasExternals_22.0.1_x86_64-centos7-gcc8-opt.rpm", Size: 10},
+			&rpm.RPM{Path: "/eos/tdaq-09-00-00.rpm", Size: 10},
+		},
+	}
+
+	opts := &Opts{
+		Branch:         "master",
+		Platform:       "x86_64-centos7-gcc8-opt",
+		Timestamp:      "2020-05-01T2101",
+		Project:        "AtlasOffline",
+		InstallBaseDir: "/cvmfs/sw",
+	}
+
+	return New(opts, nil, pkg, finder, nil, logging.NullLogger{})
+}
+
+func TestPlan(t *testing.T) {
+	pkg := &fakePkgManager{
+		installed: map[string]bool{"tdaq-09-00-00.rpm": true},
+	}
+
+	plan, err := makePlanInstaller(pkg).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("plan returned an error: %v", err)
+	}
+
+	if len(pkg.calls) != 0 {
+		t.Errorf("planning should not change anything, got package manager calls %v", pkg.calls)
+	}
+
+	if len(plan.Installs) != 1 {
+		t.Fatalf("expected a single install, got %d", len(plan.Installs))
+	}
+
+	install := plan.Installs[0]
+	if len(install.Install) != 2 || len(install.Reinstall) != 1 || install.Reinstall[0] != "tdaq-09-00-00.rpm" {
+		t.Errorf("unexpected install/reinstall split: %v / %v", install.Install, install.Reinstall)
+	}
+
+	expectDirs := []string{
+		"/cvmfs/sw/master_AtlasOffline_x86_64-centos7-gcc8-opt/.yumcache",
+		"/cvmfs/sw/master_AtlasOffline_x86_64-centos7-gcc8-opt/tdaq",
+	}
+	for i, d := range expectDirs {
+		if plan.CleanDirs[i] != d {
+			t.Errorf("clean dir %d should be %s, got %s", i, d, plan.CleanDirs[i])
+		}
+	}
+
+	expectTags := []string{
+		"VO-atlas-nightly;master;2020-05-01T2101;AtlasOffline-22.0.1;x86_64-centos7-gcc8-opt",
+		"VO-atlas-nightly;master;2020-05-01T2101;AtlasExternals-22.0.1;x86_64-centos7-gcc8-opt",
+	}
+	if strings.Join(plan.TagsEntries, "\n") != strings.Join(expectTags, "\n") {
+		t.Errorf("tags entries should be:\n%s\ngot:\n%s", strings.Join(expectTags, "\n"), strings.Join(plan.TagsEntries, "\n"))
+	}
+
+	var found bool
+	for _, repo := range plan.RepoFiles {
+		if repo.Filename == "atlas-offline-nightly.repo" {
+			found = strings.Contains(repo.Content, "baseurl=/eos/nightlies/master\n")
+		}
+	}
+	if !found {
+		t.Errorf("expected the nightly repo file in the plan, got %v", plan.RepoFiles)
+	}
+
+	if _, err := plan.JSON(); err != nil {
+		t.Errorf("unable to encode plan as JSON: %v", err)
+	}
+}
+
+func TestPlanWithoutInstalledList(t *testing.T) {
+	pkg := &fakePkgManager{classifyErr: errors.New("not configured")}
+
+	plan, err := makePlanInstaller(pkg).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("plan returned an error: %v", err)
+	}
+
+	if len(plan.Installs[0].Install) != 3 || len(plan.Warnings) != 1 {
+		t.Errorf(
+			"expected all RPMs to be installed, with a warning, got %v, %v",
+			plan.Installs[0].Install,
+			plan.Warnings,
+		)
+	}
+}
+
+func TestPlanUnresolved(t *testing.T) {
+	inst := makePlanInstaller(&fakePkgManager{})
+	inst.rpms.(*fakeFinder).err = rpm.UnresolvedError{
+		Unresolved: []rpm.Unresolved{{RPM: "AtlasOffline_22.0.1_x86_64-centos7-gcc8-opt.rpm", Requirement: "LCG_98python3"}},
+	}
+
+	plan, err := inst.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("unresolved requirements should not fail the plan, got %v", err)
+	}
+
+	expect := "AtlasOffline_22.0.1_x86_64-centos7-gcc8-opt.rpm requires LCG_98python3"
+	if len(plan.Unresolved) != 1 || plan.Unresolved[0] != expect {
+		t.Errorf("expected the unresolved requirement in the plan, got %v", plan.Unresolved)
+	}
+}
@@ -0,0 +1,136 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+)
+
+// Record returns the install history entry of the nightly,
+// which is complete once the installer is done
+func (inst *Installer) Record() *history.Entry {
+	return inst.record
+}
+
+// Timeline returns the phases of the install so far, in the order run
+func (inst *Installer) Timeline() []history.Phase {
+	return inst.record.Phases
+}
+
+// begin starts the history entry of the install
+func (inst *Installer) begin() {
+	opts, _ := json.Marshal(inst.opts)
+	inst.record = &history.Entry{
+		NightlyID: inst.NightlyID(),
+		Branch:    inst.opts.Branch,
+		Platform:  inst.opts.Platform,
+		Project:   inst.opts.Project,
+		Timestamp: inst.opts.Timestamp,
+		Opts:      opts,
+		Start:     time.Now(),
+	}
+}
+
+// finish completes the history entry, once the transaction has ended
+func (inst *Installer) finish(transaction string) {
+	r := inst.record
+	r.End = time.Now()
+	r.Transaction = transaction
+
+	switch {
+	case inst.aborted:
+		r.Outcome = history.OutcomeAborted
+	case inst.failed():
+		r.Outcome = history.OutcomeFailed
+	default:
+		r.Outcome = history.OutcomeOK
+	}
+
+	r.Errors = nil
+	for _, err := range *inst.err {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// timePhase runs the install phase, recording its duration
+func (inst *Installer) timePhase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	inst.recordPhase(name, start, time.Now(), err)
+	return err
+}
+
+// recordPhase records the install phase, run from start to end
+func (inst *Installer) recordPhase(name string, start, end time.Time, err error) {
+	phase := history.Phase{
+		Name:     name,
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+		Outcome:  history.PhaseOK,
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		phase.Outcome, phase.Error = history.PhaseCanceled, err.Error()
+	case err != nil:
+		phase.Outcome, phase.Error = history.PhaseFailed, err.Error()
+	}
+
+	inst.record.Phases = append(inst.record.Phases, phase)
+}
+
+// recordRPMs records the RPMs to install
+func (inst *Installer) recordRPMs(rpmsList []*rpm.RPMs) {
+	for _, rpms := range rpmsList {
+		for _, r := range *rpms {
+			inst.record.RPMs = append(inst.record.RPMs, history.RPM{Name: r.Name(), Size: r.Size})
+		}
+	}
+}
+
+// timelineFile is the name of the timeline report
+// in the nightly install directory
+const timelineFile = "timeline.json"
+
+// timelineReport is the JSON report of the install timeline
+type timelineReport struct {
+	NightlyID string          `json:"nightly_id"`
+	Timestamp string          `json:"timestamp"`
+	Start     time.Time       `json:"start"`
+	Phases    []history.Phase `json:"phases"`
+}
+
+// writeTimeline writes the timeline report next to the package manager log.
+// As the nightly install directory is only writable within the transaction,
+// the report does not include the end of the transaction.
+func (inst *Installer) writeTimeline() error {
+	data, err := json.MarshalIndent(
+		&timelineReport{
+			NightlyID: inst.NightlyID(),
+			Timestamp: inst.opts.Timestamp,
+			Start:     inst.record.Start,
+			Phases:    inst.Timeline(),
+		},
+		"",
+		"  ",
+	)
+
+	if err == nil {
+		path := filepath.Join(inst.NightlyInstallDir(), timelineFile)
+		err = ioutil.WriteFile(path, data, 0644)
+	}
+
+	if err != nil {
+		return TimelineWriteError{fmt.Sprintf("cannot write the install timeline (%v)", err)}
+	}
+
+	return nil
+}
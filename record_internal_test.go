@@ -0,0 +1,93 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+	"github.com/brinick/logging"
+)
+
+func TestTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeline.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ok, _ := makeBatchInstaller(t, dir, "master", nil)
+	bad, _ := makeBatchInstaller(t, dir, "21.0", errors.New("install failed"))
+	canceled, _ := makeBatchInstaller(t, dir, "22.0", fmt.Errorf("install stopped (%w)", context.Canceled))
+
+	// A nightly failing mid-install aborts the others' installs
+	for _, inst := range []*Installer{ok, bad, canceled} {
+		batch := NewBatch(&fakeTransaction{}, []*Installer{inst}, logging.NullLogger{})
+		batch.Execute(context.Background())
+		<-batch.Done()
+	}
+
+	var names []string
+	for _, p := range ok.Timeline() {
+		if p.Outcome != history.PhaseOK || p.End.Before(p.Start) {
+			t.Errorf("%s: expected an ok phase, got %s (%s - %s)", p.Name, p.Outcome, p.Start, p.End)
+		}
+		names = append(names, p.Name)
+	}
+
+	expect := []string{
+		"transaction-open",
+		"find-rpms",
+		"configure",
+		"install",
+		"clean-dirs",
+		"clean-all",
+		"write-tagsfile",
+		"transaction-close",
+	}
+	if fmt.Sprint(names) != fmt.Sprint(expect) {
+		t.Errorf("expected phases %v, got %v", expect, names)
+	}
+
+	for inst, outcome := range map[*Installer]string{bad: history.PhaseFailed, canceled: history.PhaseCanceled} {
+		if p := lastPhase(inst, "install"); p == nil || p.Outcome != outcome || p.Error == "" {
+			t.Errorf("%s: expected the install phase to be %s, got %+v", inst.NightlyID(), outcome, p)
+		}
+
+		if p := lastPhase(inst, "transaction-abort"); p == nil || p.Outcome != history.PhaseOK {
+			t.Errorf("%s: expected the transaction abort in the timeline, got %+v", inst.NightlyID(), p)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(ok.NightlyInstallDir(), timelineFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report timelineReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	// The report is written before the transaction is closed
+	if report.NightlyID != ok.NightlyID() || len(report.Phases) != len(expect)-1 {
+		t.Errorf("unexpected timeline report %s", data)
+	}
+}
+
+// lastPhase returns the last phase of the installer with the given name
+func lastPhase(inst *Installer, name string) *history.Phase {
+	var found *history.Phase
+	for i, p := range inst.Timeline() {
+		if p.Name == name {
+			found = &inst.Timeline()[i]
+		}
+	}
+
+	return found
+}
@@ -67,7 +67,12 @@ func (inst *Installer) getRemoteRepos() []*rpm.Repo {
 			Label:  "atlas-offline-nightly",
 			Name:   "ATLAS offline nightly releases",
 			URL:    inst.rpms.SrcDir(),
-			Prefix: filepath.Join(inst.opts.InstallBaseDir, inst.opts.Timestamp),
+			Prefix: inst.nightlyPrefix(),
 		},
 	}
 }
+
+// nightlyPrefix is the prefix to which the nightly RPMs are relocated
+func (inst *Installer) nightlyPrefix() string {
+	return filepath.Join(inst.opts.InstallBaseDir, inst.opts.Timestamp)
+}
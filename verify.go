@@ -0,0 +1,82 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/rpm"
+	"github.com/brinick/logging"
+)
+
+// Verification returns the report of the verification
+// of the installed RPMs, nil if they were not verified
+func (inst *Installer) Verification() *rpm.Verification {
+	return inst.verification
+}
+
+// verifyRPMs checks the payload files of each installed RPM against its
+// header, writing the report, and failing if too many files are wrong
+func (inst *Installer) verifyRPMs(ctx context.Context, installed []*rpm.RPMs) error {
+	if !inst.opts.Verify || len(installed) == 0 {
+		return nil
+	}
+
+	return inst.timePhase("verify", func() error {
+		report := &rpm.Verification{}
+		for _, rpms := range installed {
+			for _, r := range *rpms {
+				v, err := r.Verify(ctx, inst.nightlyPrefix(), inst.opts.VerifyDigests)
+				if err != nil {
+					return fmt.Errorf("unable to verify %s (%w)", r.Name(), err)
+				}
+				report.Add(v)
+			}
+		}
+
+		inst.verification = report
+		path, err := inst.writeVerification()
+		if err != nil {
+			inst.log.Error("Unable to write the verification report", logging.ErrField(err))
+		}
+
+		inst.log.Info(
+			"Verified installed RPMs",
+			logging.F("nRPMs", report.RPMs),
+			logging.F("nFiles", report.Files),
+			logging.F("nSkipped", report.Skipped),
+			logging.F("nProblems", len(report.Problems)),
+			logging.F("report", path),
+		)
+
+		if len(report.Problems) > inst.opts.VerifyMaxProblems {
+			return VerifyError{
+				Problems:    len(report.Problems),
+				MaxProblems: inst.opts.VerifyMaxProblems,
+				Report:      path,
+			}
+		}
+
+		return nil
+	})
+}
+
+// writeVerification writes the verification report to the work
+// directory, where it is kept should the transaction be aborted
+func (inst *Installer) writeVerification() (string, error) {
+	data, err := json.MarshalIndent(inst.verification, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(inst.opts.WorkBaseDir, "verify")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.json", inst.NightlyID(), inst.opts.Timestamp))
+	return path, ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,36 @@
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/brinick/atlas-rpm-installer/pkg/history"
+)
+
+func TestVerifyFailureAborts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inst, _ := makeBatchInstaller(t, dir, "master", nil)
+	transaction := &fakeTransaction{}
+	inst.transaction = transaction
+	inst.opts.WorkBaseDir = dir
+	inst.opts.Verify = true
+
+	// The RPMs found do not exist, so cannot be verified
+	inst.Execute(context.Background())
+	<-inst.Done()
+
+	if !inst.IsError() || transaction.killed != 1 || transaction.closed != 0 {
+		t.Errorf("expected the install to fail and be aborted (killed %d, closed %d)", transaction.killed, transaction.closed)
+	}
+
+	if p := lastPhase(inst, "verify"); p == nil || p.Outcome != history.PhaseFailed {
+		t.Errorf("expected the verify phase to fail, got %+v", p)
+	}
+}